@@ -0,0 +1,129 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compat checks if publisher's REST API can be consumed the way
+// Heapster consumes kubelet's stats API.
+package compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cadv "github.com/google/cadvisor/info/v1"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+const requestTimeout = 30 * time.Second
+
+// Check queries the server at baseUrl the same way Heapster's kubelet source
+// does and reports any mismatches with what Heapster expects.
+func Check(baseUrl string) []string {
+	mismatches := []string{}
+	now := time.Now()
+	request := exchange.StatsRequest{
+		ContainerName: "/",
+		NumStats:      1,
+		Start:         now.Add(-time.Hour),
+		End:           now,
+		Subcontainers: true,
+	}
+	body, _ := json.Marshal(request)
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Post(strings.TrimRight(baseUrl, "/")+"/stats/container/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return append(mismatches, fmt.Sprintf("request failed: %v", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return append(mismatches, fmt.Sprintf("unexpected status: %s", resp.Status))
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		mismatches = append(mismatches, fmt.Sprintf("unexpected content type: '%s'", contentType))
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return append(mismatches, fmt.Sprintf("failed to read response: %v", err))
+	}
+	var containers map[string]cadv.ContainerInfo
+	if err := json.Unmarshal(content, &containers); err != nil {
+		return append(mismatches, fmt.Sprintf("response can't be decoded as container infos: %v", err))
+	}
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if _, haveRoot := containers["/"]; !haveRoot {
+		mismatches = append(mismatches, "root container '/' is missing")
+	}
+	for _, name := range names {
+		mismatches = append(mismatches, checkContainer(name, containers[name])...)
+	}
+	return mismatches
+}
+
+func checkContainer(key string, info cadv.ContainerInfo) []string {
+	mismatches := []string{}
+	report := func(format string, args ...interface{}) {
+		mismatches = append(mismatches, fmt.Sprintf("container %s: ", key)+fmt.Sprintf(format, args...))
+	}
+	if info.Name != key {
+		report("name '%s' differs from the key", info.Name)
+	}
+	if info.Spec.CreationTime.IsZero() {
+		report("spec lacks creation time")
+	}
+	if len(info.Stats) == 0 {
+		report("no stats")
+	}
+	if len(info.Stats) > 1 {
+		report("got %d stats, requested at most 1", len(info.Stats))
+	}
+	for i, stats := range info.Stats {
+		if stats == nil {
+			report("stats #%d is null", i)
+			continue
+		}
+		if stats.Timestamp.IsZero() {
+			report("stats #%d lacks timestamp", i)
+		}
+		if info.Spec.HasCpu && stats.Cpu.Usage.Total == 0 {
+			report("stats #%d: has_cpu is set but cpu usage is 0", i)
+		}
+		if info.Spec.HasMemory && stats.Memory.Usage == 0 {
+			report("stats #%d: has_memory is set but memory usage is 0", i)
+		}
+		for name, values := range stats.CustomMetrics {
+			for _, value := range values {
+				if value.Timestamp.IsZero() {
+					report("stats #%d: custom metric %s lacks timestamp", i, name)
+					break
+				}
+			}
+		}
+	}
+	return mismatches
+}
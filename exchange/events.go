@@ -0,0 +1,77 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exchange
+
+import (
+	"sync"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Event describes significant occurrence in publisher's operation.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Severity  Severity  `json:"severity"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+}
+
+// EventLog keeps a fixed number of most recent events in memory.
+type EventLog struct {
+	sync.RWMutex
+	events []Event
+	next   int
+	full   bool
+}
+
+func NewEventLog(capacity int) *EventLog {
+	return &EventLog{events: make([]Event, capacity)}
+}
+
+// Record adds new event, overwriting the oldest one if log is full.
+func (l *EventLog) Record(severity Severity, kind, message string) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.events) == 0 {
+		return
+	}
+	l.events[l.next] = Event{Timestamp: time.Now(), Severity: severity, Kind: kind, Message: message}
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Events returns recorded events, oldest first.
+func (l *EventLog) Events() []Event {
+	l.RLock()
+	defer l.RUnlock()
+	if !l.full {
+		return append([]Event{}, l.events[:l.next]...)
+	}
+	return append(append([]Event{}, l.events[l.next:]...), l.events[:l.next]...)
+}
@@ -23,6 +23,7 @@ package exchange
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 	cadv "github.com/google/cadvisor/info/v1"
 )
@@ -50,9 +51,138 @@ type StatsRequest struct {
 	Subcontainers bool `json:"subcontainers,omitempty"`
 }
 
+// InnerState is the write model of the publisher, guarded by the mutex;
+// consumers are served from the read model published after each batch.
+// A single mutex guards all containers, as batches touch many of them at
+// once and readers don't take it.
 type InnerState struct {
 	sync.RWMutex
 	DockerPaths    map[string]string
 	DockerStorage  map[string]interface{}
 	PendingMetrics map[string]map[string][]cadv.MetricVal
+	// StatsIndex holds timestamp index of stats list for each container
+	StatsIndex map[string]StatsIndex
+	Readiness  *StatusBoard
+	Health     *StatusBoard
+	Activity   *ConsumerActivity
+	Events     *EventLog
+	// StatsHistory holds recent samples of publisher's own statistics
+	StatsHistory *StatsHistory
+	// Schema holds JSON Schema of served container objects, derived from
+	// the metric template
+	Schema []byte
+	// Tombstones holds containers removed from the state, keyed by name
+	Tombstones map[string]Tombstone
+	// PodStorage holds pod objects with stats aggregated over containers
+	// of each pod, keyed by pod namespace and name
+	PodStorage map[string]interface{}
+	// Downsampled holds lower-resolution tiers of stats history of each
+	// container, keyed by container name and resolution (e.g. "1m0s")
+	Downsampled map[string]map[string][]interface{}
+	// Resolutions lists resolutions of configured downsampled tiers
+	Resolutions []string
+	// Machine holds info of the node, in layout of cAdvisor's MachineInfo
+	Machine map[string]interface{}
+	// Feed broadcasts stats as they are produced
+	Feed *StatsFeed
+	// Sources counts received metrics by their sources
+	Sources *SourceStats
+	// ReadModel holds snapshot of the state served to consumers
+	ReadModel ReadModelHolder
+}
+
+// ConsumerActivity records when data was last requested by consumers.
+type ConsumerActivity struct {
+	lastAccess int64
+	// wakeAfter and onWake define what's done when a consumer requests data
+	// after a period of inactivity
+	wakeAfter time.Duration
+	onWake    func()
+}
+
+func NewConsumerActivity() *ConsumerActivity {
+	return &ConsumerActivity{lastAccess: time.Now().UnixNano()}
+}
+
+// OnWake sets fn to be called on consumer's request following longer
+// inactivity than idleTimeout, before the request is served. It must be set
+// before consumers are served.
+func (a *ConsumerActivity) OnWake(idleTimeout time.Duration, fn func()) {
+	a.wakeAfter, a.onWake = idleTimeout, fn
+}
+
+// Touch records consumer's request.
+func (a *ConsumerActivity) Touch() {
+	now := time.Now().UnixNano()
+	prev := atomic.SwapInt64(&a.lastAccess, now)
+	if a.onWake != nil && time.Duration(now-prev) > a.wakeAfter {
+		a.onWake()
+	}
+}
+
+// IdleFor tells how long no consumer requested any data.
+func (a *ConsumerActivity) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&a.lastAccess)))
+}
+
+// StatusBoard tracks condition of components the publisher depends on;
+// component is considered degraded until it is reported ready. Optional
+// features may be impaired instead, which is reported but doesn't make
+// the publisher unavailable.
+type StatusBoard struct {
+	sync.RWMutex
+	degraded map[string]string
+	impaired map[string]string
+}
+
+func NewStatusBoard() *StatusBoard {
+	return &StatusBoard{degraded: map[string]string{}, impaired: map[string]string{}}
+}
+
+// SetDegraded records the reason why component is not available yet.
+func (r *StatusBoard) SetDegraded(component, reason string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.impaired, component)
+	r.degraded[component] = reason
+}
+
+// SetImpaired records the reason why optional feature doesn't work, while
+// the rest of the publisher does.
+func (r *StatusBoard) SetImpaired(feature, reason string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.degraded, feature)
+	r.impaired[feature] = reason
+}
+
+// SetReady marks component or feature as available.
+func (r *StatusBoard) SetReady(component string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.degraded, component)
+	delete(r.impaired, component)
+}
+
+// Status tells if all components are ready, returning reasons for
+// the degraded ones otherwise.
+func (r *StatusBoard) Status() (bool, map[string]string) {
+	r.RLock()
+	defer r.RUnlock()
+	res := make(map[string]string, len(r.degraded))
+	for k, v := range r.degraded {
+		res[k] = v
+	}
+	return len(res) == 0, res
+}
+
+// Impaired returns reasons for optional features which don't work.
+func (r *StatusBoard) Impaired() map[string]string {
+	r.RLock()
+	defer r.RUnlock()
+	res := make(map[string]string, len(r.impaired))
+	for k, v := range r.impaired {
+		res[k] = v
+	}
+	return res
 }
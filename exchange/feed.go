@@ -0,0 +1,78 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exchange
+
+import (
+	"sync"
+)
+
+// StatsUpdate carries stats object produced for a container; the object
+// is a copy owned by subscribers and must not be modified.
+type StatsUpdate struct {
+	Container string                 `json:"container"`
+	Id        string                 `json:"id"`
+	Stats     map[string]interface{} `json:"stats"`
+}
+
+// StatsFeed broadcasts stats as they are produced to subscribers
+// streaming them to consumers.
+type StatsFeed struct {
+	lock        sync.RWMutex
+	subscribers map[chan StatsUpdate]bool
+}
+
+func NewStatsFeed() *StatsFeed {
+	return &StatsFeed{subscribers: map[chan StatsUpdate]bool{}}
+}
+
+// Subscribe returns channel receiving stats published from now on;
+// updates are dropped for subscribers whose buffer is full.
+func (f *StatsFeed) Subscribe(buffer int) chan StatsUpdate {
+	ch := make(chan StatsUpdate, buffer)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.subscribers[ch] = true
+	return ch
+}
+
+func (f *StatsFeed) Unsubscribe(ch chan StatsUpdate) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.subscribers, ch)
+}
+
+// HasSubscribers tells if published stats would be received by anyone,
+// so publisher can skip copying them otherwise.
+func (f *StatsFeed) HasSubscribers() bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.subscribers) > 0
+}
+
+func (f *StatsFeed) Publish(update StatsUpdate) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
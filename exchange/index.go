@@ -0,0 +1,40 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exchange
+
+import (
+	"sort"
+	"time"
+)
+
+// StatsIndex holds timestamps of container's stats in ascending order,
+// element by element parallel to container's stats list.
+type StatsIndex []time.Time
+
+// Range returns bounds [lo, hi) of stats with timestamps between start
+// and end, inclusive.
+func (i StatsIndex) Range(start, end time.Time) (int, int) {
+	lo := sort.Search(len(i), func(k int) bool { return !i[k].Before(start) })
+	hi := sort.Search(len(i), func(k int) bool { return i[k].After(end) })
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
@@ -0,0 +1,77 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exchange
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ReadModel is an immutable view of publisher's state served to consumers;
+// it is never modified once published, the publisher replaces it as a whole
+// after each processed batch. Consumers must build each response from a
+// single read model, and copy its objects before altering them.
+type ReadModel struct {
+	// Version increases with each published read model
+	Version       uint64
+	DockerStorage map[string]interface{}
+	StatsIndex    map[string]StatsIndex
+	Schema        []byte
+	Tombstones    map[string]Tombstone
+	PodStorage    map[string]interface{}
+	Machine       map[string]interface{}
+	Downsampled   map[string]map[string][]interface{}
+}
+
+var emptyReadModel = &ReadModel{
+	DockerStorage: map[string]interface{}{},
+	StatsIndex:    map[string]StatsIndex{},
+	Tombstones:    map[string]Tombstone{},
+	PodStorage:    map[string]interface{}{},
+	Downsampled:   map[string]map[string][]interface{}{},
+}
+
+// ReadModelHolder publishes read models to consumers without locking.
+type ReadModelHolder struct {
+	model atomic.Value
+}
+
+// Publish replaces the read model served to consumers.
+func (h *ReadModelHolder) Publish(model *ReadModel) {
+	h.model.Store(model)
+}
+
+// Get returns the most recently published read model.
+func (h *ReadModelHolder) Get() *ReadModel {
+	if model, ok := h.model.Load().(*ReadModel); ok {
+		return model
+	}
+	return emptyReadModel
+}
+
+// Tombstone is what remains of a container removed from publisher's state,
+// kept for a while so consumers can tell removed containers from unknown.
+type Tombstone struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	LastSeen  time.Time `json:"last_seen"`
+	RemovedAt time.Time `json:"removed_at"`
+	Reason    string    `json:"reason"`
+}
@@ -0,0 +1,69 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exchange
+
+import (
+	"sync"
+)
+
+// SourceCounters counts metrics received from a single source
+type SourceCounters struct {
+	// Received counts all metrics from the source
+	Received int64 `json:"received"`
+	// Mapped counts metrics put into container objects
+	Mapped int64 `json:"mapped"`
+	// Dropped counts metrics not matching any container or template field
+	Dropped int64 `json:"dropped"`
+}
+
+// SourceStats breaks down counters of received metrics by their sources,
+//e.g. namespace prefixes of collector plugins
+type SourceStats struct {
+	sync.RWMutex
+	counters map[string]SourceCounters
+}
+
+func NewSourceStats() *SourceStats {
+	return &SourceStats{counters: map[string]SourceCounters{}}
+}
+
+// Add accumulates counters of a batch of metrics
+func (s *SourceStats) Add(batch map[string]SourceCounters) {
+	s.Lock()
+	defer s.Unlock()
+	for source, delta := range batch {
+		counters := s.counters[source]
+		counters.Received += delta.Received
+		counters.Mapped += delta.Mapped
+		counters.Dropped += delta.Dropped
+		s.counters[source] = counters
+	}
+}
+
+// Counters returns copy of counters of all sources
+func (s *SourceStats) Counters() map[string]SourceCounters {
+	s.RLock()
+	defer s.RUnlock()
+	res := make(map[string]SourceCounters, len(s.counters))
+	for source, counters := range s.counters {
+		res[source] = counters
+	}
+	return res
+}
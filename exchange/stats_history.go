@@ -0,0 +1,78 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exchange
+
+import (
+	"sync"
+	"time"
+)
+
+// CoreStatsSample summarizes publisher's work over a sampling interval.
+type CoreStatsSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Interval is the length of sampling interval, in seconds
+	Interval      float64 `json:"interval"`
+	Batches       int     `json:"batches"`
+	BatchesPerSec float64 `json:"batches_per_sec"`
+	Metrics       int     `json:"metrics"`
+	MetricsPerSec float64 `json:"metrics_per_sec"`
+	// DroppedMetrics counts metrics not mapped to any container or field
+	DroppedMetrics int64 `json:"dropped_metrics"`
+	Stats          int   `json:"stats"`
+	// Containers is the number of containers known at the end of interval
+	Containers int `json:"containers"`
+}
+
+// StatsHistory keeps a fixed number of most recent samples of publisher's
+// statistics in memory.
+type StatsHistory struct {
+	sync.RWMutex
+	samples []CoreStatsSample
+	next    int
+	full    bool
+}
+
+func NewStatsHistory(capacity int) *StatsHistory {
+	return &StatsHistory{samples: make([]CoreStatsSample, capacity)}
+}
+
+// Record adds new sample, overwriting the oldest one if history is full.
+func (h *StatsHistory) Record(sample CoreStatsSample) {
+	h.Lock()
+	defer h.Unlock()
+	if len(h.samples) == 0 {
+		return
+	}
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Samples returns recorded samples, oldest first.
+func (h *StatsHistory) Samples() []CoreStatsSample {
+	h.RLock()
+	defer h.RUnlock()
+	if !h.full {
+		return append([]CoreStatsSample{}, h.samples[:h.next]...)
+	}
+	return append(append([]CoreStatsSample{}, h.samples[h.next:]...), h.samples[:h.next]...)
+}
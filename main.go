@@ -20,18 +20,103 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/compat"
 	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/publisher"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
 	"github.com/intelsdi-x/snap/control/plugin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "--schema" {
+		templateFile := "builtin"
+		if len(os.Args) > 2 {
+			templateFile = os.Args[2]
+		}
+		schema, err := publisher.ExportSchema(templateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export schema: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--check-template" {
+		templateFile := "builtin"
+		if len(os.Args) > 2 {
+			templateFile = os.Args[2]
+		}
+		mappings, problems, err := publisher.CheckTemplate(templateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load template: %v\n", err)
+			os.Exit(1)
+		}
+		for _, mapping := range mappings {
+			fmt.Println(mapping)
+		}
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "ERROR:", problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == "--check-compat" {
+		mismatches := compat.Check(os.Args[2])
+		for _, mismatch := range mismatches {
+			fmt.Println(mismatch)
+		}
+		if len(mismatches) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("No mismatches found")
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--features" {
+		for _, feature := range util.Features() {
+			fmt.Println(feature)
+		}
+		return
+	}
 	meta := publisher.Meta()
-	if publisherCore, err := publisher.NewCore(); err != nil {
-		panic(err)
-	} else {
-		//publisherCore.LoadMetricTemplate("/home/marcinol/work/src/github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/metric_tmpl.json")
-		plugin.Start(meta, publisherCore, os.Args[1])
+	publisherCore := publisher.NewPublisher()
+	go shutdownOnSignal(publisherCore)
+	go dumpStateOnSignal(publisherCore)
+	plugin.Start(meta, publisherCore, os.Args[1])
+	publisherCore.Shutdown()
+}
+
+// shutdownOnSignal shuts the publisher down gracefully when the plugin is
+//terminated by a signal rather than by snap
+func shutdownOnSignal(publisherCore interface {
+	Shutdown() error
+}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+	publisherCore.Shutdown()
+	os.Exit(0)
+}
+
+// dumpStateOnSignal writes state of the publisher to files in the state
+//dump directory whenever the plugin gets SIGUSR1
+func dumpStateOnSignal(publisherCore interface {
+	DumpState() ([]string, error)
+}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	for range signals {
+		fileNames, err := publisherCore.DumpState()
+		for _, fileName := range fileNames {
+			fmt.Fprintln(os.Stderr, "State dumped to", fileName)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "State not dumped:", err)
+		}
 	}
 }
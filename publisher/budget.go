@@ -0,0 +1,261 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// approximate overheads of Go values, in bytes, used to estimate size
+//of container objects
+const (
+	sizeOfMap       = 48
+	sizeOfMapEntry  = 32
+	sizeOfList      = 24
+	sizeOfListEntry = 16
+	sizeOfValue     = 16
+)
+
+// memoryBudget accounts approximate size of container objects held in
+//the state, so the oldest stats (and then the least recently seen
+//containers) can be evicted once it exceeds the limit
+type memoryBudget struct {
+	limit int64
+	sizes map[string]int64
+	total int64
+}
+
+func newMemoryBudget(limitMb int) *memoryBudget {
+	return &memoryBudget{limit: int64(limitMb) << 20, sizes: map[string]int64{}}
+}
+
+func (b *memoryBudget) account(path string, size int64) {
+	b.total += size - b.sizes[path]
+	b.sizes[path] = size
+}
+
+func (b *memoryBudget) forget(path string) {
+	b.total -= b.sizes[path]
+	delete(b.sizes, path)
+}
+
+func (b *memoryBudget) exceeded() bool {
+	return b.total > b.limit
+}
+
+// estimateContainerSize estimates memory taken by container object without
+//walking all of its stats: stats of a container share their shape, so
+//the most recent one stands for the rest
+func estimateContainerSize(dockerMap map[string]interface{}) int64 {
+	size := int64(sizeOfMap)
+	for key, value := range dockerMap {
+		size += sizeOfMapEntry + int64(len(key))
+		if key != "stats" {
+			size += approxSize(value)
+		}
+	}
+	statsList, _ := dockerMap["stats"].([]interface{})
+	size += sizeOfList
+	if len(statsList) > 0 {
+		size += int64(len(statsList)) * (sizeOfListEntry + approxSize(statsList[len(statsList)-1]))
+	}
+	return size
+}
+
+// estimateTiersSize estimates memory taken by downsampled history of
+//container, including samples collected for the current intervals
+func (f *core) estimateTiersSize(path string) int64 {
+	size := int64(0)
+	for _, statsList := range f.state.Downsampled[path] {
+		size += sizeOfMapEntry + sizeOfList
+		if len(statsList) > 0 {
+			size += int64(len(statsList)) * (sizeOfListEntry + approxSize(statsList[len(statsList)-1]))
+		}
+	}
+	for _, bucket := range f.tierBuckets[path] {
+		if bucket == nil {
+			continue
+		}
+		for _, sample := range bucket.samples {
+			size += int64(len(bucket.samples)) * (sizeOfMapEntry + approxSize(sample))
+			break
+		}
+	}
+	return size
+}
+
+// accountContainer updates size estimate of container, along with its
+//downsampled history
+func (f *core) accountContainer(path string, dockerMap map[string]interface{}) {
+	f.memoryBudget.account(path, estimateContainerSize(dockerMap)+f.estimateTiersSize(path))
+}
+
+// approxSize estimates memory taken by decoded JSON-like object
+func approxSize(obj interface{}) int64 {
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		size := int64(sizeOfMap)
+		for key, value := range obj {
+			size += sizeOfMapEntry + int64(len(key)) + approxSize(value)
+		}
+		return size
+	case []interface{}:
+		size := int64(sizeOfList)
+		for _, value := range obj {
+			size += sizeOfListEntry + approxSize(value)
+		}
+		return size
+	case string:
+		return sizeOfValue + int64(len(obj))
+	}
+	return sizeOfValue
+}
+
+type evictionCandidate struct {
+	path  string
+	stamp time.Time
+	size  int64
+}
+
+type evictionCandidates []evictionCandidate
+
+func (c evictionCandidates) Len() int {
+	return len(c)
+}
+
+func (c evictionCandidates) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c evictionCandidates) Less(i, j int) bool {
+	return c[i].stamp.Before(c[j].stamp)
+}
+
+func lastStatsStamp(dockerMap map[string]interface{}) time.Time {
+	statsList, _ := dockerMap["stats"].([]interface{})
+	if len(statsList) == 0 {
+		return time.Time{}
+	}
+	stamp, _ := util.ParseTime(statsList[len(statsList)-1].(map[string]interface{})["timestamp"].(string))
+	return stamp
+}
+
+// lastSeenStamp tells when stats of container were last merged, falling
+//back to its most recent stats for containers not seen since restored
+func (f *core) lastSeenStamp(path string, dockerMap map[string]interface{}) time.Time {
+	if seen, haveSeen := f.lastSeen[path]; haveSeen {
+		return seen
+	}
+	return lastStatsStamp(dockerMap)
+}
+
+// leastRecentlySeen returns given containers in order they were last seen,
+//the stalest first
+func (f *core) leastRecentlySeen(paths []string) evictionCandidates {
+	candidates := make(evictionCandidates, 0, len(paths))
+	for _, path := range paths {
+		dockerMap := f.state.DockerStorage[path].(map[string]interface{})
+		candidates = append(candidates, evictionCandidate{path: path, stamp: f.lastSeenStamp(path, dockerMap)})
+	}
+	sort.Stable(candidates)
+	return candidates
+}
+
+// enforceMemoryBudget updates size estimates of containers modified since
+//the read model was last published and evicts data exceeding the budget;
+//containers removed meanwhile were already forgotten by dropContainer.
+//Must be called with the state locked
+func (f *core) enforceMemoryBudget() {
+	if f.memoryBudget == nil {
+		return
+	}
+	for path := range f.dirty {
+		if dockerObj, haveDocker := f.state.DockerStorage[path]; haveDocker {
+			f.accountContainer(path, dockerObj.(map[string]interface{}))
+		}
+	}
+	if !f.memoryBudget.exceeded() {
+		return
+	}
+	evictedStats := f.evictOldestStats()
+	evictedContainers := 0
+	if f.memoryBudget.exceeded() {
+		evictedContainers = f.evictStaleContainers()
+	}
+	f.logger.WithFields(log.Fields{"evicted_stats": evictedStats, "evicted_containers": evictedContainers}).Warn("Memory budget exceeded")
+	f.state.Events.Record(exchange.SeverityWarning, "memory_budget",
+		fmt.Sprintf("memory budget of %d MB exceeded, evicted %d stats and %d containers",
+			f.memoryBudget.limit>>20, evictedStats, evictedContainers))
+}
+
+// evictOldestStats drops the oldest stats across all containers until
+//the budget is met; the most recent stats of each container are kept
+func (f *core) evictOldestStats() int {
+	candidates := evictionCandidates{}
+	for path, dockerObj := range f.state.DockerStorage {
+		statsList := dockerObj.(map[string]interface{})["stats"].([]interface{})
+		for idx := 0; idx < len(statsList)-1; idx++ {
+			statsMap := statsList[idx].(map[string]interface{})
+			stamp, _ := util.ParseTime(statsMap["timestamp"].(string))
+			candidates = append(candidates, evictionCandidate{path: path, stamp: stamp, size: sizeOfListEntry + approxSize(statsMap)})
+		}
+	}
+	sort.Stable(candidates)
+	dropped := map[string]int{}
+	total := f.memoryBudget.total
+	evicted := 0
+	for _, candidate := range candidates {
+		if total <= f.memoryBudget.limit {
+			break
+		}
+		// stats are kept in order of timestamps, so the oldest go first
+		dropped[candidate.path]++
+		total -= candidate.size
+		evicted++
+	}
+	for path, count := range dropped {
+		f.dropOldestStats(path, f.state.DockerStorage[path].(map[string]interface{}), count)
+	}
+	return evicted
+}
+
+// evictStaleContainers removes containers seen least recently until
+//the budget is met
+func (f *core) evictStaleContainers() int {
+	paths := make([]string, 0, len(f.state.DockerStorage))
+	for path := range f.state.DockerStorage {
+		paths = append(paths, path)
+	}
+	evicted := 0
+	for _, candidate := range f.leastRecentlySeen(paths) {
+		if !f.memoryBudget.exceeded() {
+			break
+		}
+		f.removeContainer(candidate.path, "memory budget exceeded")
+		evicted++
+	}
+	return evicted
+}
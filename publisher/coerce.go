@@ -0,0 +1,126 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// typeAliases maps alternative names of value spec types to the ones
+//known to the template
+var typeAliases = map[string]string{
+	"integer": "int",
+	"float":   "float64",
+	"number":  "float64",
+	"string":  "str",
+	"boolean": "bool",
+}
+
+// canonicalType returns the name template knows given type by
+func canonicalType(specType string) string {
+	if canonical, isAlias := typeAliases[specType]; isAlias {
+		return canonical
+	}
+	return specType
+}
+
+// coerceInt64Value converts numeric, numeric string or bool value to
+//int64, clamping values out of range
+func coerceInt64Value(value interface{}) (interface{}, bool) {
+	if intVal, isNumber := toInt64(value); isNumber {
+		return intVal, true
+	}
+	switch v := value.(type) {
+	case string:
+		text := strings.TrimSpace(v)
+		if intVal, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return intVal, true
+		}
+		if floatVal, err := strconv.ParseFloat(text, 64); err == nil {
+			intVal, isNumber := toInt64(floatVal)
+			return intVal, isNumber
+		}
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+	return nil, false
+}
+
+// coerceFloat64Value converts numeric, numeric string or bool value to
+//float64; NaN and infinities are rejected, as they can't be encoded in JSON
+func coerceFloat64Value(value interface{}) (interface{}, bool) {
+	floatVal, isNumber := toFloat64(value)
+	switch v := value.(type) {
+	case string:
+		var err error
+		floatVal, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+		isNumber = err == nil
+	case bool:
+		floatVal, isNumber = 0, true
+		if v {
+			floatVal = 1
+		}
+	}
+	if !isNumber || math.IsNaN(floatVal) || math.IsInf(floatVal, 0) {
+		return nil, false
+	}
+	return floatVal, true
+}
+
+// coerceStringValue formats scalar value as a string
+func coerceStringValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	if _, isNumber := toInt64(value); isNumber {
+		return fmt.Sprint(value), true
+	}
+	return nil, false
+}
+
+// coerceBoolValue converts bool, boolean string or number (true if
+//non-zero) to bool
+func coerceBoolValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		boolVal, err := strconv.ParseBool(strings.TrimSpace(v))
+		return boolVal, err == nil
+	}
+	if floatVal, isNumber := toFloat64(value); isNumber {
+		return floatVal != 0, true
+	}
+	return nil, false
+}
@@ -0,0 +1,252 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap/core/ctypes"
+)
+
+// configKind tells which type of value a config option takes
+type configKind int
+
+const (
+	configString configKind = iota
+	configInt
+	configBool
+	configDuration
+)
+
+// configKinds lists options taking other values than plain strings
+var configKinds = map[string]configKind{
+	cfgStatsDepth:       configInt,
+	cfgServerPort:       configInt,
+	cfgAdminServerPort:  configInt,
+	cfgWatchdogMissed:   configInt,
+	cfgIdleStatsDepth:   configInt,
+	cfgPushBatchSize:    configInt,
+	cfgInfluxBatchSize:  configInt,
+	cfgProxyDiscPort:    configInt,
+	cfgMemWatermark:     configInt,
+	cfgGrpcPort:         configInt,
+	cfgMaxMemory:        configInt,
+	cfgPortFallback:     configInt,
+	cfgMaxResponse:      configInt,
+	cfgNamespaceQuota:   configInt,
+	cfgPrefixQuota:      configInt,
+	cfgLogMaxSize:       configInt,
+	cfgLogMaxBackups:    configInt,
+	cfgProcWorkers:      configInt,
+	cfgIdentityStitch:   configBool,
+	cfgPruneDefaults:    configBool,
+	cfgValidateOutput:   configBool,
+	cfgCaptureNew:       configBool,
+	cfgUnmappedCustom:   configBool,
+	cfgPodAggregation:   configBool,
+	cfgCompression:      configBool,
+	cfgDebugPprof:       configBool,
+	cfgTmplFallback:     configBool,
+	cfgMemReleaseOS:     configBool,
+	cfgStatsSpan:        configDuration,
+	cfgTmplReload:       configDuration,
+	cfgStateSnapshot:    configDuration,
+	cfgTombstoneTTL:     configDuration,
+	cfgContainerTTL:     configDuration,
+	cfgJanitorInterval:  configDuration,
+	cfgStatsBucket:      configDuration,
+	cfgWatchdogInterval: configDuration,
+	cfgIdleTimeout:      configDuration,
+	cfgMemCheckInterval: configDuration,
+	cfgProxyCacheTTL:    configDuration,
+	cfgKubeRefresh:      configDuration,
+	cfgDockerRefresh:    configDuration,
+	cfgPodMemberTimeout: configDuration,
+	cfgPushInterval:     configDuration,
+	cfgPushTimeout:      configDuration,
+	cfgTstampDelta:      configDuration,
+	cfgShutdownTimeout:  configDuration,
+}
+
+// configMinimums lists least values of integer options having any
+var configMinimums = map[string]int{
+	cfgWatchdogMissed: 1,
+}
+
+// configNonNegative lists duration options which may not be negative;
+//0 turns their feature off. timestamp_delta, shifting timestamps either
+//way, isn't among them
+var configNonNegative = map[string]bool{
+	cfgStatsSpan:        true,
+	cfgTmplReload:       true,
+	cfgStateSnapshot:    true,
+	cfgTombstoneTTL:     true,
+	cfgContainerTTL:     true,
+	cfgJanitorInterval:  true,
+	cfgStatsBucket:      true,
+	cfgWatchdogInterval: true,
+	cfgIdleTimeout:      true,
+	cfgMemCheckInterval: true,
+	cfgProxyCacheTTL:    true,
+	cfgKubeRefresh:      true,
+	cfgDockerRefresh:    true,
+	cfgPodMemberTimeout: true,
+	cfgPushInterval:     true,
+	cfgPushTimeout:      true,
+	cfgShutdownTimeout:  true,
+}
+
+// coerceInt reads integer from config value, converting strings and
+//whole floats
+func coerceInt(value ctypes.ConfigValue) (int, error) {
+	switch v := value.(type) {
+	case ctypes.ConfigValueInt:
+		return v.Value, nil
+	case ctypes.ConfigValueStr:
+		if res, err := strconv.Atoi(strings.TrimSpace(v.Value)); err == nil {
+			return res, nil
+		}
+		return 0, fmt.Errorf("expected an integer, got string %q", v.Value)
+	case ctypes.ConfigValueFloat:
+		if v.Value == math.Trunc(v.Value) {
+			return int(v.Value), nil
+		}
+	}
+	return 0, fmt.Errorf("expected an integer, got %s", describeConfigValue(value))
+}
+
+// coerceBool reads boolean from config value, converting strings
+//(e.g. "true", "0") and integers 0 and 1
+func coerceBool(value ctypes.ConfigValue) (bool, error) {
+	switch v := value.(type) {
+	case ctypes.ConfigValueBool:
+		return v.Value, nil
+	case ctypes.ConfigValueStr:
+		if res, err := strconv.ParseBool(strings.TrimSpace(v.Value)); err == nil {
+			return res, nil
+		}
+		return false, fmt.Errorf("expected a boolean, got string %q", v.Value)
+	case ctypes.ConfigValueInt:
+		if v.Value == 0 || v.Value == 1 {
+			return v.Value == 1, nil
+		}
+	}
+	return false, fmt.Errorf("expected a boolean, got %s", describeConfigValue(value))
+}
+
+// coerceStr reads string from config value, formatting values of other
+//types
+func coerceStr(value ctypes.ConfigValue) (string, error) {
+	switch v := value.(type) {
+	case ctypes.ConfigValueStr:
+		return v.Value, nil
+	case ctypes.ConfigValueInt:
+		return strconv.Itoa(v.Value), nil
+	case ctypes.ConfigValueFloat:
+		return strconv.FormatFloat(v.Value, 'g', -1, 64), nil
+	case ctypes.ConfigValueBool:
+		return strconv.FormatBool(v.Value), nil
+	}
+	return "", fmt.Errorf("expected a string, got %s", describeConfigValue(value))
+}
+
+// coerceDuration reads duration from config value, given as a string
+//(e.g. "10s") or as a number of seconds
+func coerceDuration(value ctypes.ConfigValue) (time.Duration, error) {
+	switch v := value.(type) {
+	case ctypes.ConfigValueStr:
+		str := strings.TrimSpace(v.Value)
+		if res, err := time.ParseDuration(str); err == nil {
+			return res, nil
+		}
+		if seconds, err := strconv.ParseFloat(str, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second)), nil
+		}
+		return 0, fmt.Errorf("expected a duration (e.g. \"10s\") or number of seconds, got string %q", v.Value)
+	case ctypes.ConfigValueInt:
+		return time.Duration(v.Value) * time.Second, nil
+	case ctypes.ConfigValueFloat:
+		return time.Duration(v.Value * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("expected a duration, got %s", describeConfigValue(value))
+}
+
+func describeConfigValue(value ctypes.ConfigValue) string {
+	if value == nil {
+		return "no value"
+	}
+	return fmt.Sprintf("%s %v", value.Type(), value)
+}
+
+// Validate checks that all options have values of expected types, or
+//values which can be converted to them, reporting all invalid options
+func (m ConfigMap) Validate() error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	problems := []string{}
+	for _, key := range keys {
+		var err error
+		switch configKinds[key] {
+		case configInt:
+			var value int
+			if value, err = coerceInt(m[key]); err == nil {
+				if minimum, haveMinimum := configMinimums[key]; haveMinimum && value < minimum {
+					err = fmt.Errorf("expected at least %d, got %d", minimum, value)
+				}
+			}
+		case configBool:
+			_, err = coerceBool(m[key])
+		case configDuration:
+			var value time.Duration
+			if value, err = coerceDuration(m[key]); err == nil && value < 0 && configNonNegative[key] {
+				err = fmt.Errorf("expected a non-negative duration, got %v", value)
+			}
+		default:
+			var value string
+			if value, err = coerceStr(m[key]); err == nil && key == cfgStateStore {
+				err = checkStateStore(value)
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// GetDuration reads duration option, given as a string (e.g. "10s")
+//or as a number of seconds; defValue is parsed if option is missing
+func (m ConfigMap) GetDuration(key string, defValue string) (time.Duration, error) {
+	if value, gotIt := m[key]; gotIt {
+		return coerceDuration(value)
+	}
+	return time.ParseDuration(defValue)
+}
@@ -0,0 +1,130 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+	"github.com/intelsdi-x/snap/core/ctypes"
+)
+
+// secretOptions are masked in config reported by debug stats; credentials
+//embedded in URLs of any option (e.g. push_sink_url) are masked as well
+var secretOptions = map[string]bool{
+	cfgAuthToken:      true,
+	cfgAuthBasic:      true,
+	cfgTmplAuthHeader: true,
+	cfgInfluxUsername: true,
+	cfgInfluxPassword: true,
+}
+
+const maskedValue = "******"
+
+// debugSnapshot is a copy of publisher's statistics and template info,
+//taken whenever the read model is published, so they're reported without
+//waiting for the batch in progress
+type debugSnapshot struct {
+	stats           coreStats
+	containers      int
+	templateSource  string
+	templateLoaded  bool
+	templateModTime time.Time
+	walEnabled      bool
+	walOverflows    int
+}
+
+// publishDebugSnapshot takes a snapshot of statistics; caller must hold
+//the state lock
+func (f *core) publishDebugSnapshot() {
+	snapshot := debugSnapshot{
+		stats:           f.stats,
+		containers:      len(f.state.DockerStorage),
+		templateSource:  f.exportTmplFile,
+		templateLoaded:  f.templateLoaded,
+		templateModTime: f.templateModTime,
+	}
+	if f.wal != nil {
+		snapshot.walEnabled, snapshot.walOverflows = true, f.wal.overflows
+	}
+	f.debugSnapshot.Store(snapshot)
+}
+
+// lastDebugSnapshot returns the snapshot published last
+func (f *core) lastDebugSnapshot() debugSnapshot {
+	snapshot, _ := f.debugSnapshot.Load().(debugSnapshot)
+	return snapshot
+}
+
+// DebugStats reports publisher's own statistics, along with info of the
+//metric template and config of the task, secrets masked
+func (f *core) DebugStats() map[string]interface{} {
+	snapshot := f.lastDebugSnapshot()
+	stats := snapshot.stats
+	template := map[string]interface{}{
+		"source": snapshot.templateSource,
+		"loaded": snapshot.templateLoaded,
+	}
+	if !snapshot.templateModTime.IsZero() {
+		template["mod_time"] = snapshot.templateModTime
+	}
+	config := map[string]interface{}{}
+	for key, value := range f.config {
+		if secretOptions[key] {
+			config[key] = maskedValue
+		} else {
+			config[key] = configValue(value)
+		}
+	}
+	coreInfo := map[string]interface{}{
+		"batches_total":          stats.batchesTotal,
+		"metrics_rx_total":       stats.metricsRxTotal,
+		"metrics_rx_recently":    stats.metricsRxRecently,
+		"containers_rx_recently": stats.containersRxRecently,
+		"containers_rx_max":      stats.containersRxMax,
+		"stats_rx_recently":      stats.statsRxRecently,
+		"stats_rx_max":           stats.statsRxMax,
+		"stats_rx_total":         stats.statsRxTotal,
+		"containers":             snapshot.containers,
+	}
+	if snapshot.walEnabled {
+		coreInfo["wal_overflows"] = snapshot.walOverflows
+	}
+	return map[string]interface{}{
+		"core":     coreInfo,
+		"template": template,
+		"config":   config,
+	}
+}
+
+// configValue unwraps value of config option
+func configValue(value ctypes.ConfigValue) interface{} {
+	switch v := value.(type) {
+	case ctypes.ConfigValueInt:
+		return v.Value
+	case ctypes.ConfigValueStr:
+		return util.RedactUrls(v.Value, maskedValue)
+	case ctypes.ConfigValueFloat:
+		return v.Value
+	case ctypes.ConfigValueBool:
+		return v.Value
+	}
+	return describeConfigValue(value)
+}
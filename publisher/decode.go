@@ -0,0 +1,228 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap/control/plugin"
+)
+
+// gobTypes lists types of metric data which may be registered for GOB
+//decoding on demand, keyed by names accepted in configuration
+var gobTypes = map[string]interface{}{
+	"map[string]interface{}": map[string]interface{}{},
+	"map[string]string":      map[string]string{},
+	"map[string]int64":       map[string]int64{},
+	"map[string]uint64":      map[string]uint64{},
+	"[]interface{}":          []interface{}{},
+	"time.Time":              time.Time{},
+}
+
+// registerGobTypes registers comma-separated list of metric data types
+//for GOB decoding; unknown types are reported and ignored
+func registerGobTypes(typesStr string) {
+	for _, name := range strings.Split(typesStr, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if value, known := gobTypes[name]; known {
+			gob.Register(value)
+		} else {
+			log.Warnf("Unknown GOB type '%s' ignored", name)
+		}
+	}
+}
+
+// metricShape is a historical layout of snap's MetricType which older
+//snap daemons may still send; decoded metrics are mapped into publisher's
+//metrics
+type metricShape struct {
+	name   string
+	decode func(content []byte) ([]Metric, error)
+}
+
+// metricShapes lists known layouts of MetricType, starting from the
+//current one
+var metricShapes = []metricShape{
+	{name: "current", decode: decodeCurrentMetrics},
+	{name: "string_namespace", decode: decodeStringNamespaceMetrics},
+}
+
+// legacyMetricType is the layout of MetricType used before namespace
+//became a list of namespace elements
+type legacyMetricType struct {
+	Namespace_          []string
+	LastAdvertisedTime_ time.Time
+	Version_            int
+	Data_               interface{}
+	Tags_               map[string]string
+	Labels_             []legacyLabel
+	Unit_               string
+	Description_        string
+	Timestamp_          time.Time
+	Source_             string
+}
+
+type legacyLabel struct {
+	Index int
+	Name  string
+}
+
+func decodeCurrentMetrics(content []byte) ([]Metric, error) {
+	var metrics []plugin.MetricType
+	if err := gob.NewDecoder(bytes.NewBuffer(content)).Decode(&metrics); err != nil {
+		return nil, err
+	}
+	return fromPluginMetrics(metrics), nil
+}
+
+func decodeStringNamespaceMetrics(content []byte) ([]Metric, error) {
+	var legacyMetrics []legacyMetricType
+	if err := gob.NewDecoder(bytes.NewBuffer(content)).Decode(&legacyMetrics); err != nil {
+		return nil, err
+	}
+	metrics := make([]Metric, 0, len(legacyMetrics))
+	for _, legacy := range legacyMetrics {
+		metrics = append(metrics, Metric{
+			Namespace:          legacy.Namespace_,
+			Timestamp:          legacy.Timestamp_,
+			LastAdvertisedTime: legacy.LastAdvertisedTime_,
+			Value:              legacy.Data_,
+			Tags:               legacy.Tags_,
+		})
+	}
+	return metrics, nil
+}
+
+// decodeGobMetrics decodes GOB-encoded metrics trying known layouts of
+//MetricType in turn; error of decoding with the current layout is
+//returned if none of them fits
+func (f *core) decodeGobMetrics(content []byte) ([]Metric, error) {
+	var firstErr error
+	for _, shape := range metricShapes {
+		metrics, err := shape.decode(content)
+		if err == nil {
+			if shape.name != metricShapes[0].name {
+				f.logger.Debugf("decoded %d metrics using %s layout", len(metrics), shape.name)
+			}
+			return metrics, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, fmt.Errorf("couldn't decode metrics with any known layout: %v", firstErr)
+}
+
+// jsonMetricType is the JSON layout of snap's MetricType; namespace is
+//accepted both as a list of namespace elements and a list of strings
+type jsonMetricType struct {
+	Namespace          json.RawMessage   `json:"namespace"`
+	Data               interface{}       `json:"data"`
+	Tags               map[string]string `json:"tags"`
+	Timestamp          time.Time         `json:"timestamp"`
+	LastAdvertisedTime time.Time         `json:"last_advertised_time"`
+}
+
+// decodeJsonMetrics decodes JSON-encoded metrics; metric data is brought
+//to the types GOB-encoded metrics carry, so both are processed alike
+func decodeJsonMetrics(content []byte) ([]Metric, error) {
+	var jsonMetrics []jsonMetricType
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&jsonMetrics); err != nil {
+		return nil, err
+	}
+	metrics := make([]Metric, 0, len(jsonMetrics))
+	for _, jsonMetric := range jsonMetrics {
+		ns, err := decodeJsonNamespace(jsonMetric.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, Metric{
+			Namespace:          ns,
+			Timestamp:          jsonMetric.Timestamp,
+			LastAdvertisedTime: jsonMetric.LastAdvertisedTime,
+			Value:              normalizeJsonValue(jsonMetric.Data),
+			Tags:               jsonMetric.Tags,
+		})
+	}
+	return metrics, nil
+}
+
+func decodeJsonNamespace(raw json.RawMessage) ([]string, error) {
+	var ns []string
+	if err := json.Unmarshal(raw, &ns); err == nil {
+		return ns, nil
+	}
+	var elements []struct{ Value string }
+	if err := json.Unmarshal(raw, &elements); err != nil {
+		return nil, fmt.Errorf("invalid metric namespace %s: %v", raw, err)
+	}
+	ns = make([]string, 0, len(elements))
+	for _, element := range elements {
+		ns = append(ns, element.Value)
+	}
+	return ns, nil
+}
+
+// normalizeJsonValue converts integral JSON numbers to int64 and other
+//numbers to float64; objects holding only numbers become map[string]float64
+func normalizeJsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		fl, _ := value.Float64()
+		return fl
+	case map[string]interface{}:
+		numbers := make(map[string]float64, len(value))
+		for k, v := range value {
+			number, isNumber := v.(json.Number)
+			if !isNumber {
+				numbers = nil
+				break
+			}
+			numbers[k], _ = number.Float64()
+		}
+		if numbers != nil {
+			return numbers
+		}
+		for k, v := range value {
+			value[k] = normalizeJsonValue(v)
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			value[i] = normalizeJsonValue(v)
+		}
+		return value
+	}
+	return value
+}
@@ -0,0 +1,91 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+func init() {
+	registerSubsystem(featureKubernetes, setupProxyDiscovery)
+}
+
+// setupProxyDiscovery enables discovery of publishers running on other
+//nodes, as pods matching configured label selector listed by Kubernetes
+//API; the API is reached the way Kubernetes enrichment reaches it, from
+//within the cluster if not configured
+func setupProxyDiscovery(f *core, config ConfigMap) {
+	selector := config.GetStr(cfgProxyDiscovery, defProxyDiscovery)
+	if selector == "" {
+		return
+	}
+	kubeApi := config.GetStr(cfgKubeApi, defKubeApi)
+	if kubeApi == "" {
+		kubeApi = kubeInCluster
+	}
+	client, err := newKubeClient(kubeApi)
+	if err != nil {
+		f.logger.Errorf("couldn't set up Kubernetes client for node discovery: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "proxy_discovery", err.Error())
+		return
+	}
+	port := config.GetInt(cfgProxyDiscPort, defProxyDiscPort)
+	if port <= 0 {
+		port = config.GetInt(cfgServerPort, defServerPort)
+	}
+	f.discoverNodes = func() (map[string]string, error) {
+		return client.listPublishers(selector, port)
+	}
+}
+
+// listPublishers returns base URLs of publishers running in pods matching
+//label selector, keyed by names of nodes the pods are scheduled to; pods
+//not running or not assigned an IP yet are skipped
+func (c *kubeClient) listPublishers(selector string, port int) (map[string]string, error) {
+	var podList struct {
+		Items []struct {
+			Spec struct {
+				NodeName string `json:"nodeName"`
+			} `json:"spec"`
+			Status struct {
+				Phase string `json:"phase"`
+				PodIP string `json:"podIP"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := c.get("/api/v1/pods", url.Values{"labelSelector": {selector}}, &podList); err != nil {
+		return nil, fmt.Errorf("couldn't list publisher pods: %v", err)
+	}
+	res := map[string]string{}
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != "Running" || pod.Status.PodIP == "" || pod.Spec.NodeName == "" {
+			continue
+		}
+		res[pod.Spec.NodeName] = "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port))
+	}
+	return res, nil
+}
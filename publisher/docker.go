@@ -0,0 +1,237 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const dockerRequestTimeout = 10 * time.Second
+
+// dockerClient talks to Docker Engine API, over unix socket or TCP
+type dockerClient struct {
+	server string
+	client *http.Client
+}
+
+// dockerContainer holds data of container listed by Docker Engine API
+type dockerContainer struct {
+	Id      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	Created int64             `json:"Created"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+// newDockerClient sets up client of Docker daemon listening at given
+//endpoint, either unix:///path/to/socket or tcp://host:port
+func newDockerClient(endpoint string) (*dockerClient, error) {
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		socket := strings.TrimPrefix(endpoint, "unix://")
+		return &dockerClient{
+			server: "http://docker",
+			client: &http.Client{
+				Timeout: dockerRequestTimeout,
+				Transport: &http.Transport{Dial: func(_, _ string) (net.Conn, error) {
+					return net.DialTimeout("unix", socket, dockerRequestTimeout)
+				}},
+			},
+		}, nil
+	case strings.HasPrefix(endpoint, "tcp://"):
+		return &dockerClient{
+			server: "http://" + strings.TrimPrefix(endpoint, "tcp://"),
+			client: &http.Client{Timeout: dockerRequestTimeout},
+		}, nil
+	}
+	return nil, fmt.Errorf("Invalid docker endpoint '%s', expected unix:///path or tcp://host:port", endpoint)
+}
+
+// listContainers returns running containers, keyed by container ID
+func (c *dockerClient) listContainers() (map[string]dockerContainer, error) {
+	resp, err := c.client.Get(c.server + "/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Docker daemon replied with status %s", resp.Status)
+	}
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	res := map[string]dockerContainer{}
+	for _, container := range containers {
+		res[container.Id] = container
+	}
+	return res, nil
+}
+
+func init() {
+	registerSubsystem(featureDocker, setupDockerEnrichment)
+}
+
+func setupDockerEnrichment(f *core, config ConfigMap) {
+	endpoint := config.GetStr(cfgDockerEndpoint, defDockerEndpoint)
+	if endpoint == "" {
+		return
+	}
+	client, err := newDockerClient(endpoint)
+	if err != nil {
+		f.logger.Errorf("couldn't set up Docker client: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "docker", err.Error())
+		f.state.Readiness.SetImpaired(featureDocker, err.Error())
+		return
+	}
+	interval, err := config.GetDuration(cfgDockerRefresh, defDockerRefreshStr)
+	if err != nil || interval <= 0 {
+		interval = defDockerRefresh
+	}
+	enricher := &dockerEnricher{core: f}
+	f.newContainerHooks = append(f.newContainerHooks, enricher.enrichContainer)
+	go enricher.watchDocker(client, interval)
+}
+
+// dockerEnricher annotates containers with names, image, labels and
+//creation time reported by Docker daemon
+type dockerEnricher struct {
+	*core
+	containers map[string]dockerContainer
+}
+
+// watchDocker waits for Docker daemon to become available, retrying with
+//exponential backoff, as its socket may be mounted after publisher starts;
+//meanwhile readiness is degraded. Containers are refreshed periodically then,
+//until the publisher is shut down
+func (f *dockerEnricher) watchDocker(client *dockerClient, interval time.Duration) {
+	connected := util.RetryWithBackoff(templateRetryInitial, templateRetryMax, f.stopped, func() error {
+		return f.refreshDocker(client)
+	}, func(err error, delay time.Duration) {
+		f.state.Readiness.SetDegraded(featureDocker, "Docker daemon not reachable: "+err.Error())
+		f.logger.Warnf("couldn't list containers of Docker daemon, retrying in %v: %s", delay, err)
+	})
+	if !connected {
+		return
+	}
+	f.tick(interval, func(time.Time) {
+		if err := f.refreshDocker(client); err != nil {
+			f.logger.Errorf("couldn't list containers of Docker daemon: %s", err)
+			f.state.Events.Record(exchange.SeverityWarning, "docker", err.Error())
+			f.state.Readiness.SetImpaired(featureDocker, err.Error())
+		}
+	})
+}
+
+// refreshDocker lists containers of Docker daemon and annotates known
+//containers with their data
+func (f *dockerEnricher) refreshDocker(client *dockerClient) error {
+	containers, err := client.listContainers()
+	if err != nil {
+		return err
+	}
+	f.state.Lock()
+	defer f.state.Unlock()
+	f.state.Readiness.SetReady(featureDocker)
+	f.containers = containers
+	for path := range f.state.DockerStorage {
+		f.enrichContainer(path)
+	}
+	f.publishReadModel()
+	return nil
+}
+
+// lookupDockerContainer finds container listed by Docker daemon; ID used
+//by collector may be abbreviated
+func (f *dockerEnricher) lookupDockerContainer(id string) (dockerContainer, bool) {
+	if container, found := f.containers[id]; found || id == "" || id == "/" {
+		return container, found
+	}
+	for fullId, container := range f.containers {
+		if strings.HasPrefix(fullId, id) {
+			return container, true
+		}
+	}
+	return dockerContainer{}, false
+}
+
+// enrichContainer fills in names, image, labels and creation time container
+//lacks; must be called with the state locked
+func (f *dockerEnricher) enrichContainer(path string) {
+	dockerObj, haveDocker := f.state.DockerStorage[path]
+	if !haveDocker {
+		return
+	}
+	dockerMap := dockerObj.(map[string]interface{})
+	id, _ := dockerMap["id"].(string)
+	container, found := f.lookupDockerContainer(id)
+	if !found {
+		return
+	}
+	changed := false
+	if aliases, _ := dockerMap["aliases"].([]interface{}); len(aliases) == 0 && len(container.Names) > 0 {
+		aliases = []interface{}{}
+		for _, name := range container.Names {
+			aliases = append(aliases, strings.TrimPrefix(name, "/"))
+		}
+		dockerMap["aliases"] = aliases
+		changed = true
+	}
+	labelMaps := []interface{}{dockerMap["labels"]}
+	specMap, haveSpec := dockerMap["spec"].(map[string]interface{})
+	if haveSpec {
+		labelMaps = append(labelMaps, specMap["labels"])
+	}
+	for _, labelMap := range labelMaps {
+		labels, isMap := labelMap.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		for label, value := range container.Labels {
+			if current, _ := labels[label].(string); current == "" {
+				labels[label] = value
+				changed = true
+			}
+		}
+	}
+	if haveSpec {
+		if image, _ := specMap["image"].(string); container.Image != "" && image != container.Image {
+			specMap["image"] = container.Image
+			changed = true
+		}
+		if creationTime, _ := specMap[specCreationTime].(string); creationTime == "" && container.Created > 0 {
+			specMap[specCreationTime] = time.Unix(container.Created, 0).UTC().Format(time.RFC3339)
+			changed = true
+		}
+	}
+	if changed {
+		f.markDirty(path)
+	}
+}
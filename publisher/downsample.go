@@ -0,0 +1,224 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// downsampleTier is a lower-resolution history of stats: averages over
+//intervals of given resolution, retained for given time
+type downsampleTier struct {
+	resolution time.Duration
+	retention  time.Duration
+}
+
+// tierBucket collects stats falling into the current interval of a tier,
+//keyed by their timestamps, so stats updated in place (merged into time
+//buckets) are counted once
+type tierBucket struct {
+	start   time.Time
+	samples map[string]map[string]interface{}
+}
+
+// listElementKeys tells which field identifies elements of lists found in
+//stats, so they're averaged element-wise
+var listElementKeys = []string{"name", "device"}
+
+// parseDownsampleTiers parses tiers given in form of "1m=6h,5m=24h"
+//(resolution=retention); invalid items are reported and ignored
+func parseDownsampleTiers(tiersStr string) []downsampleTier {
+	tiers := []downsampleTier{}
+	for _, item := range strings.Split(tiersStr, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			log.Warnf("Invalid downsample tier '%s' ignored, expected resolution=retention", item)
+			continue
+		}
+		resolution, err1 := time.ParseDuration(strings.TrimSpace(kv[0]))
+		retention, err2 := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err1 != nil || err2 != nil || resolution <= 0 || retention < resolution {
+			log.Warnf("Invalid downsample tier '%s' ignored", item)
+			continue
+		}
+		tiers = append(tiers, downsampleTier{resolution: resolution, retention: retention})
+	}
+	return tiers
+}
+
+// downsampleStats adds stats merged for container to the current interval
+//of each tier; once stats of a later interval arrive, the average over
+//the previous one is appended to the tier. Must be called with the state
+//locked
+func (f *core) downsampleStats(path string, statsObj map[string]interface{}) {
+	if len(f.downsampleTiers) == 0 {
+		return
+	}
+	stampStr, _ := statsObj["timestamp"].(string)
+	stamp, err := util.ParseTime(stampStr)
+	if err != nil {
+		return
+	}
+	buckets, haveBuckets := f.tierBuckets[path]
+	if !haveBuckets {
+		buckets = make([]*tierBucket, len(f.downsampleTiers))
+		f.tierBuckets[path] = buckets
+	}
+	for i, tier := range f.downsampleTiers {
+		start := stamp.Truncate(tier.resolution)
+		bucket := buckets[i]
+		if bucket != nil && start.Before(bucket.start) {
+			// stats older than the current interval
+			continue
+		}
+		if bucket != nil && start.After(bucket.start) {
+			f.appendDownsampled(path, tier, bucket)
+			bucket = nil
+		}
+		if bucket == nil {
+			bucket = &tierBucket{start: start, samples: map[string]map[string]interface{}{}}
+			buckets[i] = bucket
+		}
+		bucket.samples[stampStr] = util.DeepCopy(statsObj).(map[string]interface{})
+	}
+}
+
+// appendDownsampled appends average of the interval to the tier, dropping
+//averages older than retention of the tier
+func (f *core) appendDownsampled(path string, tier downsampleTier, bucket *tierBucket) {
+	stamps := make([]string, 0, len(bucket.samples))
+	for stamp := range bucket.samples {
+		stamps = append(stamps, stamp)
+	}
+	sort.Strings(stamps)
+	samples := make([]interface{}, 0, len(stamps))
+	for _, stamp := range stamps {
+		samples = append(samples, bucket.samples[stamp])
+	}
+	average := averageValues(samples).(map[string]interface{})
+	average["timestamp"] = bucket.start.Format("2006-01-02T15:04:05Z07:00")
+
+	tiers, haveTiers := f.state.Downsampled[path]
+	if !haveTiers {
+		tiers = map[string][]interface{}{}
+		f.state.Downsampled[path] = tiers
+	}
+	resolution := tier.resolution.String()
+	statsList := append(tiers[resolution], average)
+	oldest := bucket.start.Add(-tier.retention)
+	drop := 0
+	for drop < len(statsList) {
+		stampStr, _ := statsList[drop].(map[string]interface{})["timestamp"].(string)
+		if stamp, err := util.ParseTime(stampStr); err == nil && !stamp.Before(oldest) {
+			break
+		}
+		drop++
+	}
+	tiers[resolution] = append([]interface{}(nil), statsList[drop:]...)
+	f.markDirty(path)
+}
+
+// averageValues averages samples of a stats node: numbers are averaged,
+//objects field by field and lists of objects element-wise, by their
+//names; other values are taken from the most recent sample
+func averageValues(samples []interface{}) interface{} {
+	last := samples[len(samples)-1]
+	switch last.(type) {
+	case map[string]interface{}:
+		fieldSamples := map[string][]interface{}{}
+		for _, sample := range samples {
+			if sampleMap, isMap := sample.(map[string]interface{}); isMap {
+				for field, value := range sampleMap {
+					fieldSamples[field] = append(fieldSamples[field], value)
+				}
+			}
+		}
+		res := make(map[string]interface{}, len(fieldSamples))
+		for field, values := range fieldSamples {
+			res[field] = averageValues(values)
+		}
+		return res
+	case []interface{}:
+		return averageList(samples)
+	case float32, float64:
+		sum := 0.0
+		for _, sample := range samples {
+			value, _ := toFloat64(sample)
+			sum += value
+		}
+		return sum / float64(len(samples))
+	}
+	if _, isNumber := toInt64(last); isNumber {
+		sum := 0.0
+		for _, sample := range samples {
+			value, _ := toFloat64(sample)
+			sum += value
+		}
+		return int64(sum / float64(len(samples)))
+	}
+	return last
+}
+
+// averageList averages samples of a list whose elements are objects
+//identified by name; other lists are taken from the most recent sample
+func averageList(samples []interface{}) interface{} {
+	last := samples[len(samples)-1].([]interface{})
+	elementKey := func(element interface{}) (string, bool) {
+		elementMap, isMap := element.(map[string]interface{})
+		if !isMap {
+			return "", false
+		}
+		for _, keyField := range listElementKeys {
+			if key, haveKey := elementMap[keyField].(string); haveKey {
+				return key, true
+			}
+		}
+		return "", false
+	}
+	keys := []string{}
+	elementSamples := map[string][]interface{}{}
+	for _, sample := range samples {
+		sampleList, _ := sample.([]interface{})
+		for _, element := range sampleList {
+			key, haveKey := elementKey(element)
+			if !haveKey {
+				return last
+			}
+			if _, seen := elementSamples[key]; !seen {
+				keys = append(keys, key)
+			}
+			elementSamples[key] = append(elementSamples[key], element)
+		}
+	}
+	res := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, averageValues(elementSamples[key]))
+	}
+	return res
+}
@@ -0,0 +1,120 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"sync"
+)
+
+// StatsHook is called with name of a container, its object and stats
+//being processed; it may modify stats, e.g. add derived fields
+type StatsHook func(container string, containerObj, stats map[string]interface{})
+
+// ContainerHook is called with name of a container and its object
+type ContainerHook func(container string, containerObj map[string]interface{})
+
+// pipelineHooks are extension points of metrics processing, registered
+//by packages linking the publisher; hooks are called with the state
+//locked, so they must be quick and must not keep references to objects
+//they are given
+type pipelineHooks struct {
+	beforeMerge    []StatsHook
+	afterMerge     []StatsHook
+	onNewContainer []ContainerHook
+}
+
+// clone copies the hooks, so hooks registered later don't affect the copy
+func (h pipelineHooks) clone() pipelineHooks {
+	return pipelineHooks{
+		beforeMerge:    append([]StatsHook(nil), h.beforeMerge...),
+		afterMerge:     append([]StatsHook(nil), h.afterMerge...),
+		onNewContainer: append([]ContainerHook(nil), h.onNewContainer...),
+	}
+}
+
+// defaultHooks are hooks given to every publisher created afterwards
+var defaultHooks struct {
+	sync.Mutex
+	pipelineHooks
+}
+
+func registeredHooks() pipelineHooks {
+	defaultHooks.Lock()
+	defer defaultHooks.Unlock()
+	return defaultHooks.clone()
+}
+
+// RegisterBeforeMerge adds hook called for stats built out of a batch of
+//metrics, before they are merged into the stats list of container; hook
+//applies to publishers created afterwards
+func RegisterBeforeMerge(hook StatsHook) {
+	defaultHooks.Lock()
+	defer defaultHooks.Unlock()
+	defaultHooks.beforeMerge = append(defaultHooks.beforeMerge, hook)
+}
+
+// RegisterAfterMerge adds hook called for the most recent stats after
+//they were merged into the stats list of container, along with custom
+//metrics; stats may be a bucket holding earlier metrics too. Hook applies
+//to publishers created afterwards
+func RegisterAfterMerge(hook StatsHook) {
+	defaultHooks.Lock()
+	defer defaultHooks.Unlock()
+	defaultHooks.afterMerge = append(defaultHooks.afterMerge, hook)
+}
+
+// RegisterOnNewContainer adds hook called for containers discovered in
+//a batch of metrics, once they're set up; hook applies to publishers
+//created afterwards
+func RegisterOnNewContainer(hook ContainerHook) {
+	defaultHooks.Lock()
+	defer defaultHooks.Unlock()
+	defaultHooks.onNewContainer = append(defaultHooks.onNewContainer, hook)
+}
+
+// RegisterBeforeMerge adds hook to instances of this publisher started
+//afterwards only, see the package-level function
+func (p *Publisher) RegisterBeforeMerge(hook StatsHook) {
+	p.Lock()
+	defer p.Unlock()
+	p.hooks.beforeMerge = append(p.hooks.beforeMerge, hook)
+}
+
+// RegisterAfterMerge adds hook to instances of this publisher started
+//afterwards only, see the package-level function
+func (p *Publisher) RegisterAfterMerge(hook StatsHook) {
+	p.Lock()
+	defer p.Unlock()
+	p.hooks.afterMerge = append(p.hooks.afterMerge, hook)
+}
+
+// RegisterOnNewContainer adds hook to instances of this publisher started
+//afterwards only, see the package-level function
+func (p *Publisher) RegisterOnNewContainer(hook ContainerHook) {
+	p.Lock()
+	defer p.Unlock()
+	p.hooks.onNewContainer = append(p.hooks.onNewContainer, hook)
+}
+
+func runStatsHooks(hooks []StatsHook, path string, dockerObj, statsObj map[string]interface{}) {
+	for _, hook := range hooks {
+		hook(path, dockerObj, statsObj)
+	}
+}
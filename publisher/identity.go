@@ -0,0 +1,113 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import "time"
+
+const (
+	labelPodName      = "io.kubernetes.pod.name"
+	labelPodNamespace = "io.kubernetes.pod.namespace"
+	continuityField   = "continuity"
+)
+
+// containerIdentity links consecutive incarnations of the same logical
+//container (same pod and container name) across docker ID changes
+type containerIdentity struct {
+	logicalId  string
+	lastId     string
+	generation int
+	// removedAt tells when the last incarnation was dropped from the state;
+	//identity is kept as long as its tombstone, for a successor to appear
+	removedAt time.Time
+}
+
+// identityKey identifies logical container by its pod namespace, pod name
+//and container name; false is returned if labels don't tell them
+func identityKey(dockerMap map[string]interface{}) (string, bool) {
+	labels, _ := dockerMap["labels"].(map[string]interface{})
+	podName, _ := labels[labelPodName].(string)
+	podNamespace, _ := labels[labelPodNamespace].(string)
+	containerName, _ := labels[labelContainerName].(string)
+	if podName == "" || containerName == "" {
+		return "", false
+	}
+	return podNamespace + "/" + podName + "/" + containerName, true
+}
+
+// stitchIdentity assigns continuity info to a newly discovered container,
+//linking it to its predecessor if one is known
+func (f *processorContext) stitchIdentity(path string) {
+	dockerObj, haveDocker := f.state.DockerStorage[path]
+	if !haveDocker {
+		return
+	}
+	dockerMap := dockerObj.(map[string]interface{})
+	id, _ := dockerMap["id"].(string)
+	key, haveKey := identityKey(dockerMap)
+	if !haveKey {
+		return
+	}
+	continuity := map[string]interface{}{}
+	if identity, known := f.identities[key]; known && identity.lastId != id {
+		continuity["predecessor"] = identity.lastId
+		identity.lastId = id
+		identity.generation++
+		identity.removedAt = time.Time{}
+		f.identities[key] = identity
+	} else if !known {
+		f.identities[key] = containerIdentity{logicalId: id, lastId: id}
+	}
+	identity := f.identities[key]
+	continuity["logical_id"] = identity.logicalId
+	continuity["generation"] = identity.generation
+	dockerMap[continuityField] = continuity
+}
+
+// retireIdentity notes that container was dropped from the state; identity
+//of its logical container is forgotten once tombstone of the container
+//expires, unless a successor shows up by then. Must be called with the
+//state locked
+func (f *core) retireIdentity(dockerMap map[string]interface{}) {
+	key, haveKey := identityKey(dockerMap)
+	if !haveKey {
+		return
+	}
+	identity, known := f.identities[key]
+	if id, _ := dockerMap["id"].(string); !known || identity.lastId != id {
+		return
+	}
+	if f.tombstoneTTL <= 0 {
+		delete(f.identities, key)
+		return
+	}
+	identity.removedAt = time.Now()
+	f.identities[key] = identity
+}
+
+// dropExpiredIdentities forgets identities of logical containers whose
+//last incarnation was dropped longer than tombstone TTL ago; must be called
+//with the state locked
+func (f *core) dropExpiredIdentities() {
+	for key, identity := range f.identities {
+		if !identity.removedAt.IsZero() && time.Since(identity.removedAt) > f.tombstoneTTL {
+			delete(f.identities, key)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap/control/plugin/cpolicy"
+	"github.com/intelsdi-x/snap/core/ctypes"
+)
+
+// instanceRetryInterval defines how long the start error of an instance
+//is returned by publishes of its task, before the instance is started over
+const instanceRetryInterval = time.Minute
+
+// Publisher is the snap plugin: it dispatches published metrics to
+//publisher instances, one per distinct task config, each with its own
+//state and server, so tasks on one node may publish separate subsets
+//of containers to different consumers
+type Publisher struct {
+	sync.Mutex
+	instances map[string]*instanceEntry
+	// hooks are given to instances started afterwards
+	hooks pipelineHooks
+}
+
+// instanceEntry is a publisher instance along with the task it serves,
+//the port it's configured with, and the time it failed to start, if it did
+type instanceEntry struct {
+	core     *core
+	task     string
+	port     int
+	failedAt time.Time
+}
+
+func NewPublisher() *Publisher {
+	return &Publisher{instances: map[string]*instanceEntry{}, hooks: registeredHooks()}
+}
+
+// instanceKey identifies instance by config of the task; tasks configured
+//the same way share an instance
+func instanceKey(config map[string]ctypes.ConfigValue) string {
+	items := make([]string, 0, len(config))
+	for key, value := range config {
+		items = append(items, key+"="+describeConfigValue(value))
+	}
+	sort.Strings(items)
+	return strings.Join(items, "\n")
+}
+
+// instanceTask identifies the task publishing with given config by option
+//task_name; task without the name is identified by its whole config, so
+//its instance is never replaced by another one
+func instanceTask(key string, config map[string]ctypes.ConfigValue) string {
+	if name := ConfigMap(config).GetStr(cfgTaskName, defTaskName); name != "" {
+		return "task_name=" + name
+	}
+	return key
+}
+
+// instance returns publisher instance for the task config, creating it on
+//first publish of the task, in place of the instance serving the earlier
+//config of the task; instance which failed to start is kept, along with
+//its error, for instanceRetryInterval before it's started over
+func (p *Publisher) instance(config map[string]ctypes.ConfigValue) (string, *core, error) {
+	key := instanceKey(config)
+	p.Lock()
+	defer p.Unlock()
+	if entry, exists := p.instances[key]; exists {
+		if entry.failedAt.IsZero() || time.Since(entry.failedAt) < instanceRetryInterval {
+			return key, entry.core, nil
+		}
+		delete(p.instances, key)
+	}
+	task := instanceTask(key, config)
+	port := ConfigMap(config).GetInt(cfgServerPort, defServerPort)
+	if err := p.checkPortFree(task, port); err != nil {
+		return key, nil, err
+	}
+	p.retireTaskInstances(task)
+	instance, err := NewCore()
+	if err != nil {
+		return key, nil, err
+	}
+	instance.hooks = p.hooks.clone()
+	p.instances[key] = &instanceEntry{core: instance, task: task, port: port}
+	return key, instance, nil
+}
+
+// checkPortFree fails if instance of another task runs on given port; port
+//0 is chosen by the system, so it doesn't collide. Must be called with the
+//publisher locked
+func (p *Publisher) checkPortFree(task string, port int) error {
+	if port == 0 {
+		return nil
+	}
+	for _, entry := range p.instances {
+		if entry.port == port && entry.task != task && entry.failedAt.IsZero() {
+			return fmt.Errorf("server_port %d is served by publisher instance of another task (set distinct %s for tasks sharing the plugin)", port, cfgServerPort)
+		}
+	}
+	return nil
+}
+
+// retireTaskInstances shuts down instances serving given task, as its config
+//changed. Must be called with the publisher locked
+func (p *Publisher) retireTaskInstances(task string) {
+	for key, entry := range p.instances {
+		if entry.task != task {
+			continue
+		}
+		delete(p.instances, key)
+		if entry.failedAt.IsZero() {
+			entry.core.logger.WithField("server_port", entry.port).Info("Publisher replaced by instance with changed config")
+			entry.core.Shutdown()
+		}
+	}
+}
+
+// failed notes that instance failed to start, stopping its background
+//work; its start error is returned by publishes until it's started over
+func (p *Publisher) failed(key string, instance *core) {
+	p.Lock()
+	defer p.Unlock()
+	entry, exists := p.instances[key]
+	if !exists || entry.core != instance || !entry.failedAt.IsZero() {
+		return
+	}
+	entry.failedAt = time.Now()
+	instance.Shutdown()
+}
+
+func (p *Publisher) Publish(contentType string, content []byte, config map[string]ctypes.ConfigValue) error {
+	key, instance, err := p.instance(config)
+	if err != nil {
+		return err
+	}
+	if err := instance.Publish(contentType, content, config); err != nil {
+		if instance.startErr != nil {
+			// instance failed to start, e.g. its port is taken
+			p.failed(key, instance)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *Publisher) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
+	return configPolicy()
+}
+
+// Shutdown shuts all publisher instances down
+func (p *Publisher) Shutdown() error {
+	p.Lock()
+	instances := p.instances
+	p.instances = map[string]*instanceEntry{}
+	p.Unlock()
+	var firstErr error
+	for _, entry := range instances {
+		if entry.failedAt.IsZero() {
+			if err := entry.core.Shutdown(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,124 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"net"
+	"testing"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core/ctypes"
+)
+
+func testInstanceConfig(port int, extra string) map[string]ctypes.ConfigValue {
+	return map[string]ctypes.ConfigValue{
+		cfgServerPort: ctypes.ConfigValueInt{Value: port},
+		cfgServerAddr: ctypes.ConfigValueStr{Value: "127.0.0.1"},
+		cfgLogLevel:   ctypes.ConfigValueStr{Value: extra},
+	}
+}
+
+func testTaskConfig(port int, extra, task string) map[string]ctypes.ConfigValue {
+	config := testInstanceConfig(port, extra)
+	config[cfgTaskName] = ctypes.ConfigValueStr{Value: task}
+	return config
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestPublisherCachesStartError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	p := NewPublisher()
+	defer p.Shutdown()
+	config := testInstanceConfig(listener.Addr().(*net.TCPAddr).Port, "info")
+	if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), config); err == nil {
+		t.Fatal("publish succeeded with port taken")
+	}
+	_, failed, _ := p.instance(config)
+	if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), config); err == nil {
+		t.Fatal("publish succeeded with port taken")
+	}
+	if _, instance, _ := p.instance(config); instance != failed {
+		t.Errorf("failed instance started over before retry interval")
+	}
+}
+
+func TestPublisherRetiresInstanceOnChangedConfig(t *testing.T) {
+	for _, port := range []int{freePort(t), 0} {
+		p := NewPublisher()
+		before := testTaskConfig(port, "info", "task-1")
+		if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), before); err != nil {
+			t.Fatal(err)
+		}
+		_, replaced, _ := p.instance(before)
+		after := testTaskConfig(port, "debug", "task-1")
+		if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), after); err != nil {
+			t.Fatalf("instance with changed config not started on port %d: %v", port, err)
+		}
+		select {
+		case <-replaced.stopped:
+		default:
+			t.Errorf("replaced instance not shut down on port %d", port)
+		}
+		if got := len(p.instances); got != 1 {
+			t.Errorf("publisher holds %d instances on port %d, want 1", got, port)
+		}
+		p.Shutdown()
+	}
+}
+
+func TestPublisherRejectsPortOfAnotherTask(t *testing.T) {
+	p := NewPublisher()
+	defer p.Shutdown()
+	port := freePort(t)
+	first := testTaskConfig(port, "info", "task-1")
+	if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), first); err != nil {
+		t.Fatal(err)
+	}
+	_, kept, _ := p.instance(first)
+	for _, second := range []map[string]ctypes.ConfigValue{
+		testTaskConfig(port, "debug", "task-2"),
+		testInstanceConfig(port, "debug"),
+	} {
+		if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), second); err == nil {
+			t.Errorf("publish of another task succeeded on port taken")
+		}
+	}
+	select {
+	case <-kept.stopped:
+		t.Errorf("instance shut down by another task")
+	default:
+	}
+	if err := p.Publish(plugin.SnapJSONContentType, []byte("[]"), first); err != nil {
+		t.Errorf("publish of the task holding the port failed: %v", err)
+	}
+}
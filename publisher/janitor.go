@@ -0,0 +1,79 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// runJanitor periodically ages out stats of containers which stopped
+//reporting; regular retention applies only when stats of container arrive
+func (f *core) runJanitor(interval time.Duration) {
+	f.tick(interval, func(now time.Time) {
+		f.state.Lock()
+		if f.sweepStaleStats(now) > 0 {
+			f.publishReadModel()
+		}
+		f.state.Unlock()
+	})
+}
+
+// sweepStaleStats drops stats older than retention span relative to now
+//from containers not seen within the span, removing containers left without
+//stats; returns number of containers affected. Must be called with the
+//state locked.
+func (f *core) sweepStaleStats(now time.Time) int {
+	affected := 0
+	for path, dockerObj := range f.state.DockerStorage {
+		_, span := f.retentionLimits(path)
+		span = f.effectiveStatsSpan(span)
+		if span <= 0 {
+			continue
+		}
+		// stats of reporting containers are trimmed as they arrive
+		if seen, haveSeen := f.lastSeen[path]; haveSeen && now.Sub(seen) <= span {
+			continue
+		}
+		dockerMap := dockerObj.(map[string]interface{})
+		statsList, _ := dockerMap["stats"].([]interface{})
+		validOfs := 0
+		for validOfs < len(statsList) {
+			stamp, _ := util.ParseTime(statsList[validOfs].(map[string]interface{})["timestamp"].(string))
+			if now.Sub(stamp) <= span {
+				break
+			}
+			validOfs++
+		}
+		if validOfs == 0 {
+			continue
+		}
+		affected++
+		if validOfs == len(statsList) {
+			f.removeContainer(path, fmt.Sprintf("no stats within %v", span))
+			continue
+		}
+		f.dropOldestStats(path, dockerMap, validOfs)
+	}
+	return affected
+}
@@ -0,0 +1,448 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	kubeInCluster         = "in-cluster"
+	kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	kubeRequestTimeout    = 30 * time.Second
+	kubernetesField       = "kubernetes"
+)
+
+// kubeClient talks to Kubernetes API server
+type kubeClient struct {
+	server   string
+	token    string
+	username string
+	password string
+	client   *http.Client
+}
+
+// kubeContainer tells which pod container with given ID belongs to,
+//as reported by Kubernetes API
+type kubeContainer struct {
+	podName       string
+	namespace     string
+	podUid        string
+	containerName string
+	labels        map[string]string
+	// startedAt is the start time of running container, if it's running
+	startedAt string
+}
+
+// kubeconfig holds the part of kubeconfig file needed to reach API server
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			Username              string `yaml:"username"`
+			Password              string `yaml:"password"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// newKubeClient sets up client with service account of the pod publisher
+//runs in, if source is 'in-cluster', or with kubeconfig file otherwise
+func newKubeClient(source string) (*kubeClient, error) {
+	if source == kubeInCluster {
+		return newInClusterKubeClient()
+	}
+	return newKubeconfigKubeClient(source)
+}
+
+func newInClusterKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Not running in a cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	caData, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{RootCAs: x509.NewCertPool()}
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("No certificates found in service account's CA")
+	}
+	return &kubeClient{
+		server: "https://" + net.JoinHostPort(host, port),
+		token:  strings.TrimSpace(string(token)),
+		client: newKubeHttpClient(tlsConfig),
+	}, nil
+}
+
+func newKubeconfigKubeClient(path string) (*kubeClient, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Invalid kubeconfig %s: %v", path, err)
+	}
+	clusterName, userName := "", ""
+	for _, context := range config.Contexts {
+		if context.Name == config.CurrentContext {
+			clusterName, userName = context.Context.Cluster, context.Context.User
+		}
+	}
+	client := &kubeClient{}
+	tlsConfig := &tls.Config{}
+	// relative paths in kubeconfig are resolved against its directory
+	readData := func(file, data string) ([]byte, error) {
+		if data != "" {
+			return base64.StdEncoding.DecodeString(data)
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		return ioutil.ReadFile(file)
+	}
+	for _, cluster := range config.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		client.server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+		if cluster.Cluster.CertificateAuthority != "" || cluster.Cluster.CertificateAuthorityData != "" {
+			caData, err := readData(cluster.Cluster.CertificateAuthority, cluster.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+				return nil, fmt.Errorf("No certificates found in CA of cluster %s", clusterName)
+			}
+		}
+	}
+	if client.server == "" {
+		return nil, fmt.Errorf("No cluster found for context '%s' in kubeconfig %s", config.CurrentContext, path)
+	}
+	for _, user := range config.Users {
+		if user.Name != userName {
+			continue
+		}
+		client.token = user.User.Token
+		client.username, client.password = user.User.Username, user.User.Password
+		if user.User.ClientCertificate != "" || user.User.ClientCertificateData != "" {
+			certData, err := readData(user.User.ClientCertificate, user.User.ClientCertificateData)
+			if err != nil {
+				return nil, err
+			}
+			keyData, err := readData(user.User.ClientKey, user.User.ClientKeyData)
+			if err != nil {
+				return nil, err
+			}
+			cert, err := tls.X509KeyPair(certData, keyData)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	client.client = newKubeHttpClient(tlsConfig)
+	return client, nil
+}
+
+func newKubeHttpClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout:   kubeRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+// listContainers returns containers of pods scheduled to given node (or
+//to any node, if none is given), keyed by container ID
+func (c *kubeClient) listContainers(node string) (map[string]kubeContainer, error) {
+	query := url.Values{}
+	if node != "" {
+		query.Set("fieldSelector", "spec.nodeName="+node)
+	}
+	var podList struct {
+		Items []struct {
+			Metadata struct {
+				Name      string            `json:"name"`
+				Namespace string            `json:"namespace"`
+				Uid       string            `json:"uid"`
+				Labels    map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Status struct {
+				ContainerStatuses []struct {
+					Name        string `json:"name"`
+					ContainerID string `json:"containerID"`
+					State       struct {
+						Running *struct {
+							StartedAt string `json:"startedAt"`
+						} `json:"running"`
+					} `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := c.get("/api/v1/pods", query, &podList); err != nil {
+		return nil, err
+	}
+	res := map[string]kubeContainer{}
+	for _, pod := range podList.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			// container IDs are given as RUNTIME://ID
+			id := status.ContainerID
+			if sepIdx := strings.Index(id, "://"); sepIdx >= 0 {
+				id = id[sepIdx+3:]
+			}
+			if id == "" {
+				continue
+			}
+			container := kubeContainer{
+				podName:       pod.Metadata.Name,
+				namespace:     pod.Metadata.Namespace,
+				podUid:        pod.Metadata.Uid,
+				containerName: status.Name,
+				labels:        pod.Metadata.Labels,
+			}
+			if status.State.Running != nil {
+				container.startedAt = status.State.Running.StartedAt
+			}
+			res[id] = container
+		}
+	}
+	return res, nil
+}
+
+// get requests given resource of API server, decoding the JSON response
+//into res
+func (c *kubeClient) get(resource string, query url.Values, res interface{}) error {
+	req, err := http.NewRequest("GET", c.server+resource+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kubernetes API replied with status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+func init() {
+	registerSubsystem(featureKubernetes, setupKubernetesEnrichment)
+}
+
+func setupKubernetesEnrichment(f *core, config ConfigMap) {
+	kubeApi := config.GetStr(cfgKubeApi, defKubeApi)
+	if kubeApi == "" {
+		return
+	}
+	kubeRefresh, err := config.GetDuration(cfgKubeRefresh, defKubeRefreshStr)
+	if err != nil || kubeRefresh <= 0 {
+		kubeRefresh = defKubeRefresh
+	}
+	if err := f.startKubernetesEnrichment(kubeApi, config.GetStr(cfgKubeNode, defKubeNode), kubeRefresh); err != nil {
+		f.logger.Errorf("couldn't set up Kubernetes client: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "kubernetes", err.Error())
+		f.state.Readiness.SetImpaired(featureKubernetes, err.Error())
+	}
+}
+
+// kubeEnricher annotates containers with data of their pods, listed by
+//Kubernetes API
+type kubeEnricher struct {
+	*core
+	containers map[string]kubeContainer
+}
+
+// startKubernetesEnrichment sets up Kubernetes client and starts refreshing
+//pods of the node periodically
+func (f *core) startKubernetesEnrichment(source, node string, interval time.Duration) error {
+	client, err := newKubeClient(source)
+	if err != nil {
+		return err
+	}
+	if node == "" {
+		node = os.Getenv("NODE_NAME")
+	}
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	enricher := &kubeEnricher{core: f}
+	f.newContainerHooks = append(f.newContainerHooks, enricher.enrichContainer)
+	go enricher.watchKubernetes(client, node, interval)
+	return nil
+}
+
+func (f *kubeEnricher) watchKubernetes(client *kubeClient, node string, interval time.Duration) {
+	f.refreshKubernetes(client, node)
+	f.tick(interval, func(time.Time) {
+		f.refreshKubernetes(client, node)
+	})
+}
+
+// refreshKubernetes fetches pods of the node and annotates known
+//containers with data of their pods
+func (f *kubeEnricher) refreshKubernetes(client *kubeClient, node string) {
+	containers, err := client.listContainers(node)
+	f.state.Lock()
+	defer f.state.Unlock()
+	if err != nil {
+		f.logger.Errorf("couldn't list pods in Kubernetes API: %s", err)
+		f.state.Events.Record(exchange.SeverityWarning, "kubernetes", err.Error())
+		f.state.Readiness.SetImpaired(featureKubernetes, err.Error())
+		return
+	}
+	f.state.Readiness.SetReady(featureKubernetes)
+	f.containers = containers
+	for path := range f.state.DockerStorage {
+		f.enrichContainer(path)
+	}
+	f.publishReadModel()
+}
+
+// lookupKubeContainer finds container in the pods listed by Kubernetes API;
+//ID used by collector may be abbreviated
+func (f *kubeEnricher) lookupKubeContainer(id string) (kubeContainer, bool) {
+	if container, found := f.containers[id]; found || id == "" || id == "/" {
+		return container, found
+	}
+	for fullId, container := range f.containers {
+		if strings.HasPrefix(fullId, id) {
+			return container, true
+		}
+	}
+	return kubeContainer{}, false
+}
+
+// enrichContainer annotates container object with pod name, namespace and
+//labels, filling in kubernetes labels container lacks; must be called
+//with the state locked
+func (f *kubeEnricher) enrichContainer(path string) {
+	dockerObj, haveDocker := f.state.DockerStorage[path]
+	if !haveDocker {
+		return
+	}
+	dockerMap := dockerObj.(map[string]interface{})
+	id, _ := dockerMap["id"].(string)
+	container, found := f.lookupKubeContainer(id)
+	if !found {
+		return
+	}
+	podLabels := map[string]interface{}{}
+	for k, v := range container.labels {
+		podLabels[k] = v
+	}
+	kubeMap := map[string]interface{}{
+		"pod_name":       container.podName,
+		"namespace":      container.namespace,
+		"pod_uid":        container.podUid,
+		"container_name": container.containerName,
+		"labels":         podLabels,
+	}
+	changed := false
+	if !reflect.DeepEqual(dockerMap[kubernetesField], kubeMap) {
+		dockerMap[kubernetesField] = kubeMap
+		changed = true
+	}
+	labelMaps := []interface{}{dockerMap["labels"]}
+	if specMap, haveSpec := dockerMap["spec"].(map[string]interface{}); haveSpec {
+		labelMaps = append(labelMaps, specMap["labels"])
+	}
+	for _, labelMap := range labelMaps {
+		labels, isMap := labelMap.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		for label, value := range map[string]string{
+			labelPodName:       container.podName,
+			labelPodNamespace:  container.namespace,
+			labelPodUid:        container.podUid,
+			labelContainerName: container.containerName,
+		} {
+			if _, haveLabel := labels[label]; !haveLabel {
+				labels[label] = value
+				changed = true
+			}
+		}
+	}
+	// start time reported by Kubernetes is more accurate than creation
+	//time derived from stats
+	if specMap, haveSpec := dockerMap["spec"].(map[string]interface{}); haveSpec && container.startedAt != "" {
+		if startedAt, _ := specMap[specCreationTime].(string); startedAt != container.startedAt {
+			specMap[specCreationTime] = container.startedAt
+			changed = true
+		}
+	}
+	if changed {
+		f.markDirty(path)
+	}
+}
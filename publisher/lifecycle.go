@@ -0,0 +1,83 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// tick calls fn with current time every interval, until the publisher is
+//shut down
+func (f *core) tick(interval time.Duration, fn func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stopped:
+			return
+		case now := <-ticker.C:
+			fn(now)
+		}
+	}
+}
+
+// initialized tells if the publisher was set up and its server started
+func (f *core) initialized() bool {
+	return f.server != nil
+}
+
+// Shutdown stops the publisher when the plugin terminates: the embedded
+//server is drained and its listeners closed, so a re-created publisher
+//can bind the same ports, background work is stopped, write-ahead log is
+//written out, and the state is snapshotted and its store closed, if
+//persistence is configured; log file is closed last
+func (f *core) Shutdown() error {
+	f.stopOnce.Do(func() {
+		close(f.stopped)
+	})
+	var err error
+	if f.server != nil {
+		if err = f.server.Shutdown(f.shutdownTimeout); err != nil {
+			f.logger.WithError(err).Warn("Server not drained")
+		}
+	}
+	if f.wal != nil {
+		// records queued before shutdown are written out
+		<-f.wal.done
+	}
+	if f.persister != nil {
+		// periodic snapshot must not race with the final one
+		<-f.persister.done
+		if perr := f.persister.snapshot(); perr != nil {
+			f.logger.WithError(perr).Error("Couldn't snapshot state")
+			f.state.Events.Record(exchange.SeverityError, "state_store", perr.Error())
+		}
+		f.persister.store.close()
+	}
+	f.logger.Info("Publisher shut down")
+	if f.logFile != nil {
+		f.logFile.Close()
+		f.logFile = nil
+	}
+	return err
+}
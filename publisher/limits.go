@@ -0,0 +1,49 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"strconv"
+)
+
+// isUpdatable tells if container-level field described by value spec is
+//refreshed by every metric, not only when container is discovered;
+//template flag `update` enables it, e.g. for limits changing at runtime
+func isUpdatable(spec map[string]string) bool {
+	update, _ := strconv.ParseBool(spec["update"])
+	return update
+}
+
+// deriveCpuMaxLimit sets spec.cpu.max_limit to the hard limit of cpu in
+//millicores, as given by CFS quota and period; containers without quota
+//keep the value from the template
+func deriveCpuMaxLimit(dockerObj map[string]interface{}) {
+	spec, _ := dockerObj["spec"].(map[string]interface{})
+	cpu, _ := spec["cpu"].(map[string]interface{})
+	if cpu == nil {
+		return
+	}
+	quota, haveQuota := toInt64(cpu["quota"])
+	period, havePeriod := toInt64(cpu["period"])
+	if !haveQuota || !havePeriod || quota <= 0 || period <= 0 {
+		return
+	}
+	cpu["max_limit"] = quota * 1000 / period
+}
@@ -0,0 +1,87 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJson = "json"
+)
+
+// logSettings holds level, formatter and destination of publisher's logs;
+//logs go to stderr unless file is given
+type logSettings struct {
+	level      log.Level
+	formatter  log.Formatter
+	file       string
+	maxSize    int64
+	maxBackups int
+}
+
+// parseLogSettings reads log_level and log_format options of the task
+func parseLogSettings(config ConfigMap) (logSettings, error) {
+	res := logSettings{}
+	levelStr := config.GetStr(cfgLogLevel, defLogLevel)
+	level, err := log.ParseLevel(strings.ToLower(levelStr))
+	if err != nil {
+		return res, fmt.Errorf("invalid config: %s: unknown level %q", cfgLogLevel, levelStr)
+	}
+	res.level = level
+	switch format := config.GetStr(cfgLogFormat, defLogFormat); format {
+	case logFormatText:
+		res.formatter = &log.TextFormatter{DisableColors: true}
+	case logFormatJson:
+		res.formatter = &log.JSONFormatter{}
+	default:
+		return res, fmt.Errorf("invalid config: %s: expected %q or %q, got %q", cfgLogFormat, logFormatText, logFormatJson, format)
+	}
+	res.file = config.GetStr(cfgLogFile, defLogFile)
+	res.maxSize = int64(config.GetInt(cfgLogMaxSize, defLogMaxSize)) << 20
+	res.maxBackups = config.GetInt(cfgLogMaxBackups, defLogMaxBackups)
+	return res, nil
+}
+
+// applyLogSettings configures logger of the publisher instance, shared
+//with its server; the standard logger is left alone, as other instances
+//may log differently. If log file can't be opened, logs stay on stderr
+func (f *core) applyLogSettings(settings logSettings) {
+	f.logger.Level = settings.level
+	f.logger.Formatter = settings.formatter
+	if settings.file == "" {
+		return
+	}
+	file, err := util.OpenRotatingFile(settings.file, settings.maxSize, settings.maxBackups)
+	if err != nil {
+		f.logger.WithField("file", settings.file).WithError(err).Error("Couldn't open log file, logging to stderr")
+		f.state.Events.Record(exchange.SeverityError, "config", "couldn't open log file: "+err.Error())
+		return
+	}
+	f.logger.Out = file
+	f.logFile = file
+}
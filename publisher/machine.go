@@ -0,0 +1,50 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+const (
+	// machineSection is the template section describing the node
+	machineSection = "machine"
+	machineObjKey  = "\x00machine"
+)
+
+// resetMachineInfo replaces info of the node with defaults given by
+//machine section of the template
+func (f *core) resetMachineInfo() {
+	f.state.Machine = newObject(f.metricTemplate.machineObj)
+}
+
+// insertIntoMachine stores value of node metric into info of the node,
+//if machine section of the template maps it
+func (f *processorContext) insertIntoMachine(metric *Metric) (didInsert bool) {
+	if f.state.Machine == nil {
+		return false
+	}
+	ns := metric.NamespaceString()
+	sourcePaths, isMachineMetric := f.validateMetricWithMap(metric, f.metricTemplate.mapToMachine, f.metricTemplate.machineIndex)
+	if !isMachineMetric {
+		return false
+	}
+	for _, sourcePath := range sourcePaths {
+		f.storeValue(machineObjKey, f.state.Machine, lookupSpec(f.metricTemplate.mapToMachine, sourcePath), metric.Value, ns)
+		didInsert = true
+	}
+	return
+}
@@ -0,0 +1,89 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap/control/plugin"
+)
+
+// Plugin meta is reported to snap before any task configuration is known,
+// so meta options are chosen at build time (e.g. with
+// -ldflags "-X github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/publisher.metaRouting=config")
+// and may be overridden with environment variables of the plugin process.
+//
+// Defaults suit the publisher keeping state of all tasks in a single
+// plugin process which serves it on fixed ports: the plugin is exclusive
+// and tasks are routed to it stickily.
+var (
+	metaExclusive = "true"
+	metaRouting   = "sticky"
+	metaCacheTTL  = ""
+)
+
+const (
+	envMetaExclusive = "HEAPSTER_PUBLISHER_EXCLUSIVE"
+	envMetaRouting   = "HEAPSTER_PUBLISHER_ROUTING"
+	envMetaCacheTTL  = "HEAPSTER_PUBLISHER_CACHE_TTL"
+)
+
+var routingStrategies = map[string]plugin.RoutingStrategyType{
+	"default": plugin.DefaultRouting,
+	"sticky":  plugin.StickyRouting,
+	"config":  plugin.ConfigRouting,
+}
+
+func metaSetting(envName, buildValue string) string {
+	if value, haveEnv := os.LookupEnv(envName); haveEnv {
+		return value
+	}
+	return buildValue
+}
+
+// applyMetaSettings sets plugin meta options out of build-time and
+//environment settings; invalid settings are reported and ignored
+func applyMetaSettings(meta *plugin.PluginMeta) {
+	exclusive, err := strconv.ParseBool(metaSetting(envMetaExclusive, metaExclusive))
+	if err != nil {
+		log.Warnf("Invalid exclusive setting ignored: %v", err)
+		exclusive = true
+	}
+	opts := []func(*plugin.PluginMeta){plugin.Exclusive(exclusive)}
+	routingName := metaSetting(envMetaRouting, metaRouting)
+	if routing, known := routingStrategies[routingName]; known {
+		opts = append(opts, plugin.RoutingStrategy(routing))
+	} else {
+		log.Warnf("Unknown routing strategy '%s' ignored", routingName)
+	}
+	if cacheTTLStr := metaSetting(envMetaCacheTTL, metaCacheTTL); cacheTTLStr != "" {
+		if cacheTTL, err := time.ParseDuration(cacheTTLStr); err == nil {
+			opts = append(opts, plugin.CacheTTL(cacheTTL))
+		} else {
+			log.Warnf("Invalid cache TTL '%s' ignored", cacheTTLStr)
+		}
+	}
+	for _, opt := range opts {
+		opt(meta)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+)
+
+// Metric is the publisher's own representation of a metric; all decoders
+// map incoming metrics into it so the processing doesn't depend on types
+// of the snap framework.
+type Metric struct {
+	// Namespace holds segments of metric's namespace
+	Namespace []string
+	Timestamp time.Time
+	// LastAdvertisedTime is the time metric was last advertised by its
+	//collector, if known
+	LastAdvertisedTime time.Time
+	Value              interface{}
+	Tags               map[string]string
+}
+
+// NamespaceString returns metric's namespace joined into a path,
+//e.g. /intel/docker/ID/cpu_stats/cpu_usage/total_usage
+func (m *Metric) NamespaceString() string {
+	return "/" + strings.Join(m.Namespace, "/")
+}
+
+// elementAt returns index of namespace element holding given offset of
+//the namespace string; separator preceding an element counts to it
+func (m *Metric) elementAt(offset int) int {
+	end := 0
+	for i, element := range m.Namespace {
+		end += 1 + len(element)
+		if offset < end {
+			return i
+		}
+	}
+	return len(m.Namespace)
+}
+
+// hasPrefix tells if metric's namespace starts with given elements
+func (m *Metric) hasPrefix(prefix []string) bool {
+	if len(m.Namespace) < len(prefix) {
+		return false
+	}
+	for i, elem := range prefix {
+		if m.Namespace[i] != elem {
+			return false
+		}
+	}
+	return true
+}
+
+// splitNamespace splits namespace given as a path into its elements
+func splitNamespace(ns string) []string {
+	return strings.Split(strings.Trim(ns, "/"), "/")
+}
+
+// withSuffix returns copy of the metric with namespace extended by
+//a segment and given value
+func (m *Metric) withSuffix(nsSuffix string, value interface{}) *Metric {
+	res := *m
+	res.Tags = make(map[string]string, len(m.Tags))
+	for k, v := range m.Tags {
+		res.Tags[k] = v
+	}
+	res.Namespace = make([]string, len(m.Namespace), len(m.Namespace)+1)
+	copy(res.Namespace, m.Namespace)
+	if nsSuffix != "" {
+		res.Namespace = append(res.Namespace, nsSuffix)
+	}
+	res.Value = value
+	return &res
+}
+
+// fromPluginMetrics maps metrics of the snap framework into publisher's
+//metrics
+func fromPluginMetrics(pluginMetrics []plugin.MetricType) []Metric {
+	metrics := make([]Metric, 0, len(pluginMetrics))
+	for _, mt := range pluginMetrics {
+		metrics = append(metrics, Metric{
+			Namespace:          mt.Namespace().Strings(),
+			Timestamp:          mt.Timestamp(),
+			LastAdvertisedTime: mt.LastAdvertisedTime(),
+			Value:              mt.Data(),
+			Tags:               mt.Tags(),
+		})
+	}
+	return metrics
+}
@@ -32,8 +32,24 @@ const builtinMetricTemplate = `{
 	},
 	"subcontainers":[
 	],
+	"machine":{
+		"num_cores":"__tmpl|/machine/num_cores|0|int",
+		"cpu_frequency_khz":"__tmpl|/machine/cpu_frequency_khz|0|int",
+		"memory_capacity":"__tmpl|/machine/memory_capacity|0|int",
+		"machine_id":"__tmpl|/machine/machine_id||str",
+		"system_uuid":"__tmpl|/machine/system_uuid||str",
+		"boot_id":"__tmpl|/machine/boot_id||str",
+		"filesystems":[
+		],
+		"disk_map":{
+		},
+		"network_devices":[
+		],
+		"topology":[
+		]
+	},
 	"spec":{
-		"creation_time":"__tmpl|/creation_time|2016-05-16T03:25:47Z|str",
+		"creation_time":"__tmpl|/creation_time||str|no_default=",
 		"labels":{
 			"io.kubernetes.pod.name":"__tmpl|/labels/io_kubernetes_pod_name/value||str|no_default=",
 			"io.kubernetes.container.name":"__tmpl|/labels/io_kubernetes_container_name/value||str|no_default=",
@@ -42,14 +58,16 @@ const builtinMetricTemplate = `{
 		},
 		"has_cpu":true,
 		"cpu":{
-			"limit":2,
+			"limit":"__tmpl|/cgroups/cpu_stats/cpu_shares|2|int|update=true",
 			"max_limit":2,
-			"mask":"0-1"
+			"mask":"__tmpl|/cgroups/cpuset_stats/cpus|0-1|str|update=true",
+			"quota":"__tmpl|/cgroups/cpu_stats/cfs_quota_us|0|int|no_default=,update=true",
+			"period":"__tmpl|/cgroups/cpu_stats/cfs_period_us|0|int|no_default=,update=true"
 		},
 		"has_memory":true,
 		"memory":{
-			"limit":"__tmpl|/cgroups/memory_stats/stats/limit_in_bytes|0|int",
-			"swap_limit":"__tmpl|/cgroups/memory_stats/stats/swap_limit_in_bytes|0|int"
+			"limit":"__tmpl|/cgroups/memory_stats/stats/limit_in_bytes|0|int|update=true",
+			"swap_limit":"__tmpl|/cgroups/memory_stats/stats/swap_limit_in_bytes|0|int|update=true"
 		},
 		"has_network":true,
 		"has_filesystem":true,
@@ -70,6 +88,14 @@ const builtinMetricTemplate = `{
 				},
 				"load_average":"__tmpl|/sched_load|0|int"
 			},
+			"cpu_inst":{
+				"usage":{
+					"total":"__tmpl|/cgroups/cpu_stats/cpu_usage/total_usage|0|int|rate=1,no_default=",
+					"user":"__tmpl|/cgroups/cpu_stats/cpu_usage/usage_in_usermode|0|int|rate=1,no_default=",
+					"system":"__tmpl|/cgroups/cpu_stats/cpu_usage/usage_in_kernelmode|0|int|rate=1,no_default="
+				},
+				"usage_percent":"__tmpl|/cgroups/cpu_stats/cpu_usage/total_usage|0|float64|rate=1e-7,no_default="
+			},
 			"diskio":{
 			},
 			"memory":{
@@ -97,6 +123,8 @@ const builtinMetricTemplate = `{
 				"tx_packets":"__tmpl|/network/tx_packets|0|int",
 				"tx_errors":"__tmpl|/network/tx_errors|0|int",
 				"tx_dropped":"__tmpl|/network/tx_dropped|0|int",
+				"rx_bytes_rate":"__tmpl|/network/rx_bytes|0|float64|rate=1,no_default=",
+				"tx_bytes_rate":"__tmpl|/network/tx_bytes|0|float64|rate=1,no_default=",
 				"interfaces":[
 					{
 						"name":"__tmpl|/network/.../name||str",
@@ -107,7 +135,9 @@ const builtinMetricTemplate = `{
 						"tx_bytes":"__tmpl|/network/.../tx_bytes|0|int",
 						"tx_packets":"__tmpl|/network/.../tx_packets|0|int",
 						"tx_errors":"__tmpl|/network/.../tx_errors|0|int",
-						"tx_dropped":"__tmpl|/network/.../tx_dropped|0|int"
+						"tx_dropped":"__tmpl|/network/.../tx_dropped|0|int",
+						"rx_bytes_rate":"__tmpl|/network/.../rx_bytes|0|float64|rate=1,no_default=",
+						"tx_bytes_rate":"__tmpl|/network/.../tx_bytes|0|float64|rate=1,no_default="
 					}
 				],
 				"tcp":{
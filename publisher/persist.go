@@ -0,0 +1,197 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// stateStore keeps container objects on disk, so history survives
+//restarts of the publisher
+type stateStore interface {
+	// load returns all stored container objects, JSON-encoded, by names
+	load() (map[string][]byte, error)
+	// save stores given container objects and deletes removed ones
+	save(containers map[string][]byte, removed []string) error
+	close() error
+}
+
+const (
+	// stateStoreWal keeps per-container write-ahead logs, written with
+	//every merged sample
+	stateStoreWal = "wal"
+	// stateStoreBolt snapshots changed containers to BoltDB periodically
+	stateStoreBolt = "bolt"
+)
+
+// openStateStore opens store in given directory; it's set only in builds
+//with BoltDB support (tag bolt), keeping bolt out of default dependencies
+var openStateStore func(dir string) (stateStore, error)
+
+// checkStateStore fails for unknown kind of store and for BoltDB store in
+//builds without its support
+func checkStateStore(kind string) error {
+	switch {
+	case kind == stateStoreBolt && openStateStore == nil:
+		return fmt.Errorf("%q not compiled in (build with -tags bolt)", kind)
+	case kind != stateStoreWal && kind != stateStoreBolt:
+		return fmt.Errorf("expected %q or %q, got %q", stateStoreWal, stateStoreBolt, kind)
+	}
+	return nil
+}
+
+// statePersister snapshots containers changed since the previous snapshot
+//to state store periodically
+type statePersister struct {
+	core  *core
+	store stateStore
+	// saved holds signatures of containers as of the last snapshot
+	saved map[string]string
+	// done is closed once periodic snapshots stop, on shutdown
+	done chan struct{}
+}
+
+// containerSignature changes whenever stats of container do
+func containerSignature(dockerMap map[string]interface{}) string {
+	statsList, _ := dockerMap["stats"].([]interface{})
+	if len(statsList) == 0 {
+		return "0"
+	}
+	lastStamp, _ := statsList[len(statsList)-1].(map[string]interface{})["timestamp"].(string)
+	return fmt.Sprintf("%d/%s", len(statsList), lastStamp)
+}
+
+// snapshot saves containers changed since the previous snapshot and
+//deletes the removed ones
+func (p *statePersister) snapshot() error {
+	changed := map[string][]byte{}
+	signatures := map[string]string{}
+	p.core.state.RLock()
+	for path, dockerObj := range p.core.state.DockerStorage {
+		dockerMap := dockerObj.(map[string]interface{})
+		signature := containerSignature(dockerMap)
+		signatures[path] = signature
+		if p.saved[path] == signature {
+			continue
+		}
+		encoded, err := json.Marshal(dockerMap)
+		if err != nil {
+			p.core.state.RUnlock()
+			return fmt.Errorf("couldn't encode container %s: %v", path, err)
+		}
+		changed[path] = encoded
+	}
+	p.core.state.RUnlock()
+	removed := []string{}
+	for path := range p.saved {
+		if _, exists := signatures[path]; !exists {
+			removed = append(removed, path)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	if err := p.store.save(changed, removed); err != nil {
+		return err
+	}
+	p.saved = signatures
+	return nil
+}
+
+// run snapshots the state every interval until the publisher is shut
+//down; the final snapshot is left to shutdown
+func (p *statePersister) run(interval time.Duration) {
+	defer close(p.done)
+	p.core.tick(interval, func(time.Time) {
+		if err := p.snapshot(); err != nil {
+			p.core.logger.Errorf("couldn't snapshot state: %s", err)
+			p.core.state.Events.Record(exchange.SeverityError, "state_store", err.Error())
+		}
+	})
+}
+
+// startStatePersistence restores containers kept in state directory by
+//given kind of store and starts persisting the state there
+func (f *core) startStatePersistence(dir, kind string, interval time.Duration) {
+	switch kind {
+	case stateStoreWal:
+		f.startWriteAheadLog(dir)
+	case stateStoreBolt:
+		f.startStateSnapshots(dir, interval)
+	default:
+		f.logger.Errorf("unknown state store: %s", kind)
+		f.state.Events.Record(exchange.SeverityError, "state_store", "unknown state store: "+kind)
+	}
+}
+
+// startStateSnapshots restores containers kept in BoltDB store and starts
+//snapshotting the state
+func (f *core) startStateSnapshots(dir string, interval time.Duration) {
+	if openStateStore == nil {
+		f.logger.Errorf("state persistence not compiled in (build with -tags bolt)")
+		f.state.Events.Record(exchange.SeverityError, "state_store", "state persistence not compiled in (build with -tags bolt)")
+		return
+	}
+	store, err := openStateStore(dir)
+	if err != nil {
+		f.logger.Errorf("couldn't open state store: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "state_store", err.Error())
+		return
+	}
+	f.persister = &statePersister{core: f, store: store, saved: map[string]string{}, done: make(chan struct{})}
+	stored, err := store.load()
+	if err != nil {
+		f.logger.Errorf("couldn't load state store: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "state_store", err.Error())
+	}
+	containers := map[string]map[string]interface{}{}
+	for path, encoded := range stored {
+		var dockerObj map[string]interface{}
+		if err := json.Unmarshal(encoded, &dockerObj); err != nil {
+			f.logger.WithField("container", path).WithError(err).Warn("Skipping stored container")
+			continue
+		}
+		containers[path] = dockerObj
+	}
+	f.restoreStoredState(containers)
+	go f.persister.run(interval)
+}
+
+// restoreStoredState puts containers loaded from state store into
+//publisher's state; unlike seed, containers which can't be restored are
+//skipped, as store may be left inconsistent by a crash
+func (f *core) restoreStoredState(containers map[string]map[string]interface{}) {
+	for path, dockerObj := range containers {
+		if err := restoreContainer(dockerObj); err != nil {
+			f.logger.WithField("container", path).WithError(err).Warn("Skipping stored container")
+			delete(containers, path)
+		}
+	}
+	if err := f.restoreState(containers, "state store"); err != nil {
+		f.state.Events.Record(exchange.SeverityError, "state_store", err.Error())
+	} else if len(containers) > 0 {
+		f.state.Events.Record(exchange.SeverityInfo, "state_store",
+			fmt.Sprintf("restored %d containers from state store", len(containers)))
+	}
+}
@@ -0,0 +1,102 @@
+// +build bolt
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	boltStateFile    = "state.db"
+	boltOpenTimeout  = 5 * time.Second
+	featureBoltStore = "bolt"
+)
+
+var boltContainersBucket = []byte("containers")
+
+func init() {
+	openStateStore = openBoltStateStore
+	util.RegisterFeature(featureBoltStore)
+}
+
+// boltStateStore keeps container objects in a BoltDB file, keyed by
+//container names
+type boltStateStore struct {
+	db *bolt.DB
+}
+
+func openBoltStateStore(dir string) (stateStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, boltStateFile), 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltContainersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStateStore{db: db}, nil
+}
+
+func (s *boltStateStore) load() (map[string][]byte, error) {
+	res := map[string][]byte{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltContainersBucket).ForEach(func(k, v []byte) error {
+			// values are valid only within transaction
+			res[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *boltStateStore) save(containers map[string][]byte, removed []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltContainersBucket)
+		for path, encoded := range containers {
+			if err := bucket.Put([]byte(path), encoded); err != nil {
+				return err
+			}
+		}
+		for _, path := range removed {
+			if err := bucket.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStateStore) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,268 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	// kubeletNamePrefix starts names given to containers by kubelet:
+	//k8s_CONTAINER_POD_NAMESPACE_UID_ATTEMPT
+	kubeletNamePrefix = "k8s_"
+	// sharedStatsGroup holds stats shared by all containers of a pod,
+	//aggregated with max instead of sum
+	sharedStatsGroup = "network"
+)
+
+// podIdentity tells which pod container belongs to
+type podIdentity struct {
+	name      string
+	namespace string
+	uid       string
+}
+
+// key identifies pod by its namespace and name, or by UID if name
+//isn't known (e.g. for pod-scoped containers)
+func (p podIdentity) key() string {
+	if p.name == "" {
+		return p.uid
+	}
+	return p.namespace + "/" + p.name
+}
+
+// notePodTags remembers pod-related tags of metric, for containers lacking
+//kubernetes labels
+func (f *processorContext) notePodTags(path string, metric *Metric) {
+	for _, tag := range []string{labelPodName, labelPodNamespace, labelPodUid} {
+		value, haveTag := metric.Tags[tag]
+		if !haveTag || value == "" {
+			continue
+		}
+		tags, haveTags := f.podTags[path]
+		if !haveTags {
+			tags = map[string]string{}
+			f.podTags[path] = tags
+		}
+		tags[tag] = value
+	}
+}
+
+// podOf tells which pod container belongs to, judging by its kubernetes
+//labels, snap tags of its metrics or names given by kubelet, in that order
+func (f *core) podOf(path string, dockerMap map[string]interface{}) (podIdentity, bool) {
+	labels, _ := dockerMap["labels"].(map[string]interface{})
+	pod := podIdentity{}
+	pod.name, _ = labels[labelPodName].(string)
+	pod.namespace, _ = labels[labelPodNamespace].(string)
+	pod.uid, _ = labels[labelPodUid].(string)
+	if pod.name != "" || pod.uid != "" {
+		return pod, true
+	}
+	if tags, haveTags := f.podTags[path]; haveTags && tags[labelPodName] != "" {
+		return podIdentity{name: tags[labelPodName], namespace: tags[labelPodNamespace], uid: tags[labelPodUid]}, true
+	}
+	names := []string{path}
+	aliases, _ := dockerMap["aliases"].([]interface{})
+	for _, alias := range aliases {
+		if aliasStr, isStr := alias.(string); isStr {
+			names = append(names, aliasStr)
+		}
+	}
+	for _, name := range names {
+		name = filepath.Base(name)
+		if !strings.HasPrefix(name, kubeletNamePrefix) {
+			continue
+		}
+		nameSplit := strings.Split(strings.TrimPrefix(name, kubeletNamePrefix), "_")
+		if len(nameSplit) < 4 {
+			continue
+		}
+		return podIdentity{name: nameSplit[1], namespace: nameSplit[2], uid: nameSplit[3]}, true
+	}
+	return pod, false
+}
+
+// aggregatePods groups containers by pods they belong to and appends
+//stats aggregated over live containers to pods having any container
+//updated in this batch; pods left without containers are dropped
+func (f *processorContext) aggregatePods() {
+	now := time.Now()
+	members := map[string][]string{}
+	pods := map[string]podIdentity{}
+	for path, dockerObj := range f.state.DockerStorage {
+		if pod, inPod := f.podOf(path, dockerObj.(map[string]interface{})); inPod {
+			members[pod.key()] = append(members[pod.key()], path)
+			pods[pod.key()] = pod
+		}
+	}
+	for podKey := range f.state.PodStorage {
+		if _, haveMembers := members[podKey]; !haveMembers {
+			delete(f.state.PodStorage, podKey)
+			delete(f.dirtyPods, podKey)
+		}
+	}
+	for podKey, paths := range members {
+		updated := false
+		for _, path := range paths {
+			updated = updated || f.dirty[path]
+		}
+		if !updated {
+			continue
+		}
+		live := make([]string, 0, len(paths))
+		for _, path := range paths {
+			if f.podMemberLive(path, now) {
+				live = append(live, path)
+			}
+		}
+		sort.Strings(live)
+		f.updatePod(pods[podKey], live)
+	}
+}
+
+// podMemberLive tells if container counts into stats of its pod, having
+//reported metrics within pod_member_timeout; containers which stopped
+//reporting (or were only restored from persisted state) are left out
+func (f *core) podMemberLive(path string, now time.Time) bool {
+	seen, haveSeen := f.lastSeen[path]
+	return haveSeen && (f.podMemberTimeout <= 0 || now.Sub(seen) <= f.podMemberTimeout)
+}
+
+// updatePod aggregates the most recent stats of pod's live containers
+//into pod's stats; stats of the same timestamp as the last one replace it,
+//so containers reported in several batches are all accounted for
+func (f *processorContext) updatePod(pod podIdentity, paths []string) {
+	podObj, havePod := f.state.PodStorage[pod.key()]
+	if !havePod {
+		podObj = map[string]interface{}{
+			"stats": []interface{}{},
+		}
+		f.state.PodStorage[pod.key()] = podObj
+	}
+	podMap := podObj.(map[string]interface{})
+	podMap["name"] = pod.name
+	podMap["namespace"] = pod.namespace
+	podMap["uid"] = pod.uid
+	containers := make([]interface{}, 0, len(paths))
+	for _, path := range paths {
+		containers = append(containers, path)
+	}
+	podMap["containers"] = containers
+	f.dirtyPods[pod.key()] = true
+
+	aggregated := map[string]interface{}{}
+	var stamp time.Time
+	for _, path := range paths {
+		statsList, _ := f.state.DockerStorage[path].(map[string]interface{})["stats"].([]interface{})
+		if len(statsList) == 0 {
+			continue
+		}
+		statsObj := statsList[len(statsList)-1].(map[string]interface{})
+		if statsStamp, err := util.ParseTime(statsObj["timestamp"].(string)); err == nil && statsStamp.After(stamp) {
+			stamp = statsStamp
+		}
+		aggregateStats(aggregated, statsObj, false)
+	}
+	if stamp.IsZero() {
+		return
+	}
+	aggregated["timestamp"] = stamp.Format(time.RFC3339)
+	statsList := podMap["stats"].([]interface{})
+	if len(statsList) > 0 {
+		lastStamp, _ := util.ParseTime(statsList[len(statsList)-1].(map[string]interface{})["timestamp"].(string))
+		if stamp.Before(lastStamp) {
+			return
+		}
+		if stamp.Equal(lastStamp) {
+			statsList[len(statsList)-1] = aggregated
+			return
+		}
+	}
+	f.makeRoomForStats(pod.key(), &statsList, aggregated)
+	podMap["stats"] = append(statsList, aggregated)
+}
+
+// aggregateStats adds numeric fields of container stats to pod stats;
+//lists (e.g. filesystems) and custom metrics are skipped, as they can't
+//be matched across containers
+func aggregateStats(dest, src map[string]interface{}, shared bool) {
+	for key, value := range src {
+		if key == "timestamp" || key == groupCustomMetrics {
+			continue
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			destMap, haveDest := dest[key].(map[string]interface{})
+			if !haveDest {
+				destMap = map[string]interface{}{}
+				dest[key] = destMap
+			}
+			aggregateStats(destMap, value, shared || key == sharedStatsGroup)
+		default:
+			if prev, havePrev := dest[key]; havePrev {
+				dest[key] = combineValues(prev, value, shared)
+			} else if _, isNumber := toFloat64(value); isNumber {
+				dest[key] = value
+			}
+		}
+	}
+}
+
+// combineValues sums two numeric values, or picks the larger one if they
+//are shared by containers; integers are kept as integers
+func combineValues(a, b interface{}, shared bool) interface{} {
+	aInt, aIsInt := toInt64(a)
+	bInt, bIsInt := toInt64(b)
+	if aIsInt && bIsInt && !isFloat(a) && !isFloat(b) {
+		if shared {
+			if aInt > bInt {
+				return aInt
+			}
+			return bInt
+		}
+		return aInt + bInt
+	}
+	aFloat, aIsNumber := toFloat64(a)
+	bFloat, bIsNumber := toFloat64(b)
+	if !aIsNumber || !bIsNumber {
+		return a
+	}
+	if shared {
+		if aFloat > bFloat {
+			return aFloat
+		}
+		return bFloat
+	}
+	return aFloat + bFloat
+}
+
+func isFloat(value interface{}) bool {
+	switch value.(type) {
+	case float32, float64:
+		return true
+	}
+	return false
+}
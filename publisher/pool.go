@@ -0,0 +1,102 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"sync"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// maxPooledEntries limits size of maps kept for reuse, so a single huge
+//batch doesn't pin its memory for good
+const maxPooledEntries = 1 << 14
+
+// processorContexts recycles bookkeeping of processed batches, so sustained
+//short publish intervals don't thrash the garbage collector; stats objects
+//aren't pooled, as they're kept in history of containers
+var processorContexts = sync.Pool{
+	New: func() interface{} {
+		return &processorContext{
+			temporaryStats:       map[string]map[string]interface{}{},
+			podContainerPaths:    map[string]string{},
+			writtenTargets:       map[string]map[string]int{},
+			stats_dockersPcsdMap: map[string]bool{},
+			stats_statsPcsdMap:   map[string]bool{},
+			sourceCounters:       map[string]exchange.SourceCounters{},
+		}
+	},
+}
+
+// acquireProcessorContext returns a context for processing batch of metrics
+//by given core, with all bookkeeping empty
+func acquireProcessorContext(f *core) *processorContext {
+	ctx := processorContexts.Get().(*processorContext)
+	ctx.core = f
+	return ctx
+}
+
+// releaseProcessorContext clears the context and returns it to the pool;
+//context must not be used afterwards
+func releaseProcessorContext(ctx *processorContext) {
+	if len(ctx.temporaryStats) > maxPooledEntries || len(ctx.writtenTargets) > maxPooledEntries {
+		return
+	}
+	for k := range ctx.temporaryStats {
+		delete(ctx.temporaryStats, k)
+	}
+	for k := range ctx.podContainerPaths {
+		delete(ctx.podContainerPaths, k)
+	}
+	for k, written := range ctx.writtenTargets {
+		if len(ctx.spareTargets) < maxPooledEntries && len(written) <= maxPooledEntries {
+			for target := range written {
+				delete(written, target)
+			}
+			ctx.spareTargets = append(ctx.spareTargets, written)
+		}
+		delete(ctx.writtenTargets, k)
+	}
+	for k := range ctx.stats_dockersPcsdMap {
+		delete(ctx.stats_dockersPcsdMap, k)
+	}
+	for k := range ctx.stats_statsPcsdMap {
+		delete(ctx.stats_statsPcsdMap, k)
+	}
+	for k := range ctx.sourceCounters {
+		delete(ctx.sourceCounters, k)
+	}
+	ctx.core = nil
+	ctx.samplesAdded, ctx.samplesMerged = 0, 0
+	ctx.regularStats, ctx.pendingLock = 0, nil
+	processorContexts.Put(ctx)
+}
+
+// newWrittenTargets returns an empty map for noting written targets of
+//an object, reusing one of the previous batches if possible
+func (f *processorContext) newWrittenTargets() map[string]int {
+	if spare := len(f.spareTargets); spare > 0 {
+		written := f.spareTargets[spare-1]
+		f.spareTargets = f.spareTargets[:spare-1]
+		return written
+	}
+	return map[string]int{}
+}
@@ -0,0 +1,154 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"path/filepath"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// statsSources holds priorities of sources which provided fields of the
+//most recent stats of a container, so stats of the same interval arriving
+//in a later batch don't overwrite values of more trusted sources
+type statsSources struct {
+	fields map[string]int
+	ifaces elementSources
+	fs     elementSources
+}
+
+// elementSources holds priorities of fields of list elements (interfaces,
+//filesystems) by element name, with names kept in order of the list
+type elementSources struct {
+	names  []string
+	fields map[string]map[string]int
+}
+
+// tracksSources tells if priorities of sources are kept across batches
+func (f *core) tracksSources() bool {
+	return len(f.sourcePriorities) > 0
+}
+
+// recordSources remembers priorities of fields written in this batch
+//as sources of the stats just appended for container
+func (f *processorContext) recordSources(path string, ifaceNames, fsNames []string) {
+	if !f.tracksSources() {
+		return
+	}
+	sources := &statsSources{
+		fields: copyPriorities(f.writtenTargets[path]),
+		ifaces: f.newElementSources(path, ifaceObjKey, ifaceNames),
+		fs:     f.newElementSources(path, fsObjKey, fsNames),
+	}
+	f.statsSources[path] = sources
+}
+
+func (f *processorContext) newElementSources(path string, objKey func(string, string) string, names []string) elementSources {
+	res := elementSources{names: append([]string{}, names...), fields: map[string]map[string]int{}}
+	for _, name := range names {
+		res.fields[name] = copyPriorities(f.writtenTargets[objKey(path, name)])
+	}
+	return res
+}
+
+// mergeBySource merges stats of the same interval into the most recent
+//stats of container field by field, keeping values which came from
+//sources of higher priority; interfaces and filesystems are matched by
+//name and custom metrics are appended
+func (f *processorContext) mergeBySource(path string, sources *statsSources, lastStats, statsObj map[string]interface{}, ifaceNames, fsNames []string) {
+	mergeFields(lastStats, statsObj, f.writtenTargets[path], sources.fields)
+	if networkMap, isMap := lastStats["network"].(map[string]interface{}); isMap {
+		ifaceList, _ := util.NewObjWalker(statsObj).Seek("/network/interfaces")
+		networkMap["interfaces"] = f.mergeElements(path, ifaceObjKey, &sources.ifaces, networkMap["interfaces"], ifaceList, ifaceNames)
+	}
+	if fsList, haveFs := lastStats["filesystem"]; haveFs {
+		lastStats["filesystem"] = f.mergeElements(path, fsObjKey, &sources.fs, fsList, statsObj["filesystem"], fsNames)
+	}
+	mergeCustomMetrics(lastStats, statsObj)
+}
+
+// mergeElements merges new list of interfaces or filesystems into the
+//stored one, element by element; lists which don't match their recorded
+//names are left as stored
+func (f *processorContext) mergeElements(path string, objKey func(string, string) string, sources *elementSources, storedRef, newRef interface{}, names []string) interface{} {
+	storedList, isList := storedRef.([]interface{})
+	newList, isNewList := newRef.([]interface{})
+	if !isList || !isNewList || len(newList) != len(names) || len(storedList) != len(sources.names) {
+		return storedRef
+	}
+	for i, name := range names {
+		written := f.writtenTargets[objKey(path, name)]
+		pos := indexOfName(sources.names, name)
+		if pos < 0 {
+			storedList = append(storedList, newList[i])
+			sources.names = append(sources.names, name)
+			sources.fields[name] = copyPriorities(written)
+			continue
+		}
+		storedObj, isMap := storedList[pos].(map[string]interface{})
+		newObj, isNewMap := newList[i].(map[string]interface{})
+		if !isMap || !isNewMap {
+			continue
+		}
+		if sources.fields[name] == nil {
+			sources.fields[name] = map[string]int{}
+		}
+		mergeFields(storedObj, newObj, written, sources.fields[name])
+	}
+	return storedList
+}
+
+// mergeFields copies to stored object fields written in this batch,
+//unless stored value came from a source of higher priority
+func mergeFields(storedObj, obj map[string]interface{}, written, priorities map[string]int) {
+	storedWalker, walker := util.NewObjWalker(storedObj), util.NewObjWalker(obj)
+	for target, priority := range written {
+		if prevPriority, wasStored := priorities[target]; wasStored && prevPriority > priority {
+			continue
+		}
+		value, err := walker.Seek(target)
+		if err != nil {
+			continue
+		}
+		if parent, err := storedWalker.Seek(filepath.Dir(target)); err == nil {
+			if parentMap, isMap := parent.(map[string]interface{}); isMap {
+				parentMap[filepath.Base(target)] = value
+				priorities[target] = priority
+			}
+		}
+	}
+}
+
+func copyPriorities(priorities map[string]int) map[string]int {
+	res := make(map[string]int, len(priorities))
+	for target, priority := range priorities {
+		res[target] = priority
+	}
+	return res
+}
+
+func indexOfName(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -20,67 +20,110 @@ limitations under the License.
 package publisher
 
 import (
-	"encoding/json"
+	"fmt"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
 	cadv "github.com/google/cadvisor/info/v1"
 	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
-	"github.com/intelsdi-x/snap/control/plugin"
-	score "github.com/intelsdi-x/snap/core"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 	"regexp"
+	"math"
+	"sort"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	podContainerPathPrefix = "/pod"
+	labelPodUid            = "io.kubernetes.pod.uid"
+	labelContainerName     = "io.kubernetes.container.name"
+	normInt64              = "int64"
+	normFloat64            = "float64"
+	normString             = "str"
+	normBool               = "bool"
 )
 
+// defaultNorms gives width numeric values are normalized to by types of
+//template value specs
+var defaultNorms = map[string]string{
+	"int":     normInt64,
+	"float64": normFloat64,
+	"str":     normString,
+	"bool":    normBool,
+}
+
 type processorContext struct {
 	*core
 	temporaryStats       map[string]map[string]interface{}
+	podContainerPaths    map[string]string
+	writtenTargets       map[string]map[string]int
 	stats_dockersPcsdMap map[string]bool
 	stats_statsPcsdMap   map[string]bool
+	samplesAdded         int
+	samplesMerged        int
+	sourceCounters       map[string]exchange.SourceCounters
+	// spareTargets holds cleared maps of written targets for reuse
+	spareTargets         []map[string]int
+	// regularStats counts metrics of containers, other than custom ones
+	regularStats         int
+	// pendingLock guards pending custom metrics shared by workers
+	pendingLock          *sync.Mutex
 }
 
-func (f *core) processMetrics(metrics []plugin.MetricType) {
-	ctx := &processorContext{
-		core:                 f,
-		temporaryStats:       map[string]map[string]interface{}{},
-		stats_dockersPcsdMap: map[string]bool{},
-		stats_statsPcsdMap:   map[string]bool{},
-	}
+func (f *core) processMetrics(metrics []Metric) {
+	ctx := acquireProcessorContext(f)
+	defer releaseProcessorContext(ctx)
 	ctx.processMetrics0(metrics)
+	f.state.Sources.Add(ctx.sourceCounters)
 }
 
-func (f *processorContext) processMetrics0(metrics []plugin.MetricType) {
+func (f *processorContext) processMetrics0(metrics []Metric) {
 	firstTimeDockers := map[string]bool{}
-	countRegularStats := 0
-	for _, mt := range metrics {
-		if id, path, isDockerMetric, isCustomMetric := f.extractDockerIdAndPath(&mt); isDockerMetric {
-			dockerObj, knownDocker := f.fetchObjectForDocker(id, path, &mt)
+	now := time.Now()
+	// containers and their objects are resolved first, in order of metrics;
+	//metrics are inserted into those objects afterwards
+	items := make([]batchItem, 0, len(metrics))
+	for i := range metrics {
+		mt := &metrics[i]
+		if id, path, metricIdx, isDockerMetric, isCustomMetric := f.extractDockerIdAndPath(mt); isDockerMetric {
+			f.lastSeen[path] = now
+			dockerObj, knownDocker := f.fetchObjectForDocker(id, path, mt)
 			if !knownDocker {
 				firstTimeDockers[path] = true
 			}
-			_, firstTimeDocker := firstTimeDockers[path]
-			statsObj, _ := f.fetchObjectForStats(id, path, &mt)
-			if f.insertIntoStats(path, statsObj, &mt) {
-				f.stats_statsPcsdMap[path] = true
-				goto finish
-			}
-			if f.insertIntoIface(path, statsObj, &mt) {
-				goto finish
+			if f.podAggregation {
+				f.notePodTags(path, mt)
 			}
-			if f.insertIntoFs(path, statsObj, &mt) {
-				goto finish
-			}
-			if knownDocker && f.insertIntoCustomMetrics(path, dockerObj, &mt) {
-				goto finish
-			}
-			if firstTimeDocker && f.insertIntoDocker(path, dockerObj, &mt) {
-				goto finish
-			}
-		finish:
-			if !isCustomMetric {
-				countRegularStats++
-			}
-
+			statsObj, _ := f.fetchObjectForStats(id, path, mt)
+			items = append(items, batchItem{
+				metric:         mt,
+				id:             id,
+				path:           path,
+				metricIdx:      metricIdx,
+				dockerObj:      dockerObj,
+				statsObj:       statsObj,
+				knownDocker:    knownDocker,
+				isCustomMetric: isCustomMetric,
+			})
+		} else {
+			f.countSourceMetric(mt, f.insertIntoMachine(mt))
+		}
+	}
+	f.redirectMergedItems(items)
+	f.insertContainerMetrics(items, firstTimeDockers)
+	countRegularStats := f.regularStats
+	for path := range f.stats_dockersPcsdMap {
+		if dockerObj, haveDocker := f.state.DockerStorage[path]; haveDocker {
+			deriveCpuMaxLimit(dockerObj.(map[string]interface{}))
+		}
+	}
+	if f.identityStitching {
+		for path := range firstTimeDockers {
+			f.stitchIdentity(path)
 		}
 	}
 	if countRegularStats > 0 {
@@ -88,6 +131,10 @@ func (f *processorContext) processMetrics0(metrics []plugin.MetricType) {
 			f.mergeStatsForDocker(id, path)
 		}
 	}
+	f.onNewContainers(firstTimeDockers)
+	if countRegularStats > 0 && f.podAggregation {
+		f.aggregatePods()
+	}
 
 	//-- DEBUG - update core stats for debugging - completely optional part
 	//FIXME:RMVIT\/
@@ -102,6 +149,7 @@ func (f *processorContext) processMetrics0(metrics []plugin.MetricType) {
 		}
 		pri("max no# pending stats: %v", maxPendingStats)
 	}
+	f.stats.batchesTotal++
 	f.stats.metricsRxRecently = len(metrics)
 	f.stats.metricsRxTotal += len(metrics)
 	if len(f.stats_dockersPcsdMap) > f.stats.containersRxMax {
@@ -115,91 +163,103 @@ func (f *processorContext) processMetrics0(metrics []plugin.MetricType) {
 	f.stats.statsRxRecently = stats_statsPcsdNum
 	f.stats.statsRxTotal += stats_statsPcsdNum
 
+	if f.batchSummary != nil {
+		f.writeBatchSummary(len(metrics), len(firstTimeDockers))
+	}
 	//f.logger.Infof("processing stats: %+v\n", f.stats)
 }
 
 
 //// stats EXTRACTION methods
 
-func (f *processorContext) validateMetricWithMap(dockerPath, ns string, mapping map[string]map[string]string) ([]string, bool) {
-	for sourcePath, _ := range mapping {
-		if strings.HasSuffix(ns, sourcePath) {
-			sourcePaths := []string {}
-			if aliases, haveAliases := mapping[sourcePath]["aliases"]; haveAliases {
-				sourcePaths = append(strings.Split(aliases, ":"), sourcePath)
-			} else {
-				sourcePaths = []string{sourcePath}
-			}
-			// validate source paths as they may have any pattern ("ptrn") filters
-			filtered := sourcePaths[:0]
-			for _, path := range sourcePaths {
-				if ptrn, havePtrn := mapping[path]["ptrn"]; havePtrn {
-					if matched, err := regexp.MatchString(ptrn, ns); !matched || err != nil {
-						continue
-					}
+// validateMetricWithMap returns source paths of value specs matching metric
+//namespace; of literal source paths the longest one namespace ends with
+//is taken, then wildcard sources are tried. Source paths are matched
+//against namespace elements, pattern filters against namespace joined
+//with `/`
+func (f *processorContext) validateMetricWithMap(metric *Metric, mapping map[string]map[string]string, index *sourceIndex) ([]string, bool) {
+	if sourcePath, matched := index.lookup(metric.Namespace); matched {
+		sourcePaths := []string {}
+		if aliases, haveAliases := mapping[sourcePath]["aliases"]; haveAliases {
+			sourcePaths = append(strings.Split(aliases, ":"), sourcePath)
+		} else {
+			sourcePaths = []string{sourcePath}
+		}
+		// validate source paths as they may have any pattern ("ptrn") filters
+		filtered := sourcePaths[:0]
+		for _, path := range sourcePaths {
+			if ptrn, havePtrn := mapping[path]["ptrn"]; havePtrn {
+				if matched, err := regexp.MatchString(ptrn, metric.NamespaceString()); !matched || err != nil {
+					continue
 				}
-				filtered = append(filtered, path)
-			}
-			sourcePaths = filtered
-			if len(sourcePaths) > 0 {
-				return sourcePaths, true
 			}
-			return nil, false
+			filtered = append(filtered, path)
 		}
+		sourcePaths = filtered
+		if len(sourcePaths) > 0 {
+			return sourcePaths, true
+		}
+		return nil, false
+	}
+	if sourcePaths := f.matchWildcards(metric, mapping, index); len(sourcePaths) > 0 {
+		return sourcePaths, true
 	}
-	customPath := ns[strings.LastIndex(ns, dockerPath)+len(dockerPath):]
-	return []string{customPath}, false
+	return nil, false
 
 }
-func (f *processorContext) validateStatsMetric(dockerPath, ns string) ([]string, bool) {
-	return f.validateMetricWithMap(dockerPath, ns, f.metricTemplate.mapToStats)
+func (f *processorContext) validateStatsMetric(metric *Metric) ([]string, bool) {
+	return f.validateMetricWithMap(metric, f.metricTemplate.mapToStats, f.metricTemplate.statsIndex)
 }
-func (f *processorContext) validateDockerMetric(dockerPath, ns string) ([]string, bool) {
-	return f.validateMetricWithMap(dockerPath, ns, f.metricTemplate.mapToDocker)
+func (f *processorContext) validateDockerMetric(metric *Metric) ([]string, bool) {
+	return f.validateMetricWithMap(metric, f.metricTemplate.mapToDocker, f.metricTemplate.dockerIndex)
 }
-func (f *processorContext) validateIfaceMetric(dockerPath, ns string) ([]string, bool) {
-	return f.validateMetricWithMap(dockerPath, ns, f.metricTemplate.mapToIface)
+func (f *processorContext) validateIfaceMetric(metric *Metric) ([]string, bool) {
+	return f.validateMetricWithMap(metric, f.metricTemplate.mapToIface, f.metricTemplate.ifaceIndex)
 }
-func (f *processorContext) validateFsMetric(dockerPath, ns string) ([]string, bool) {
-	return f.validateMetricWithMap(dockerPath, ns, f.metricTemplate.mapToFs)
+func (f *processorContext) validateFsMetric(metric *Metric) ([]string, bool) {
+	return f.validateMetricWithMap(metric, f.metricTemplate.mapToFs, f.metricTemplate.fsIndex)
 }
 
-func (f *processorContext) validateCustomMetric(metric *plugin.MetricType) (spec cadv.MetricSpec, validMetric bool) {
+func (f *processorContext) validateCustomMetric(metric *Metric) (spec cadv.MetricSpec, validMetric bool) {
 	if _, spec, validMetric = f.extractOneCustomMetric(metric); validMetric {
 		return spec, true
 	}
 	return spec, false
 }
 
-func (f *processorContext) extractIfaceMetric(metric *plugin.MetricType) (string, string) {
-	nsSplit := metric.Namespace().Strings()
+func (f *processorContext) extractIfaceMetric(metric *Metric) (string, string) {
+	nsSplit := metric.Namespace
 	// /intel/docker/DOCKER_ID/network/IFACE_ID/METRIC
 	lens := len(nsSplit)
 	return nsSplit[lens-2], nsSplit[lens-1]
 }
 
-func (f *processorContext) extractFsMetric(metric *plugin.MetricType) (string, string) {
-	nsSplit := metric.Namespace().Strings()
+func (f *processorContext) extractFsMetric(metric *Metric) (string, string) {
+	nsSplit := metric.Namespace
 	// /intel/docker/DOCKER_ID/filesystem/FS_ID/METRIC
 	lens := len(nsSplit)
 	return nsSplit[lens-2], nsSplit[lens-1]
 }
 
-func (f *processorContext) fetchObjectForDocker(id, path string, metric *plugin.MetricType) (obj map[string]interface{}, existedBefore bool) {
+func (f *processorContext) fetchObjectForDocker(id, path string, metric *Metric) (obj map[string]interface{}, existedBefore bool) {
 	f.stats_dockersPcsdMap[path] = true
+	f.markDirty(path)
 	if dockerObj, gotIt := f.state.DockerStorage[path]; gotIt {
 		dockerMap := dockerObj.(map[string]interface{})
 		return dockerMap, true
 	} else {
 		f.state.DockerPaths[path] = id
-		var dockerMap map[string]interface{}
-		json.Unmarshal([]byte(f.metricTemplate.source), &dockerMap)
+		delete(f.state.Tombstones, path)
+		dockerMap := newObject(f.metricTemplate.dockerObj)
 		dockerMap["id"] = id
 		dockerMap["name"] = path
 		if id == "root" {
 			dockerMap["id"] = "/"
 			dockerMap["name"] = "/"
 		}
+		if strings.HasPrefix(path, podContainerPathPrefix+"/") {
+			annotatePodContainer(dockerMap, path)
+		}
 
 		f.state.DockerStorage[path] = dockerMap
 		return dockerMap, false
@@ -207,14 +267,17 @@ func (f *processorContext) fetchObjectForDocker(id, path string, metric *plugin.
 }
 // fetchObjectForStats gets an allocated stats object for storing
 //metrics; no object will be allocated if metric argument is  nil
-func (f *processorContext) fetchObjectForStats(id, path string, metric *plugin.MetricType) (map[string]interface{}, bool) {
+func (f *processorContext) fetchObjectForStats(id, path string, metric *Metric) (map[string]interface{}, bool) {
 	var statsObj map[string]interface{}
 	var haveStats bool
 	if statsObj, haveStats = f.temporaryStats[path]; haveStats {
 		return statsObj, true
 	} else if metric != nil {
-		json.Unmarshal([]byte(f.metricTemplate.statsSource), &statsObj)
-		tstamp := metric.Timestamp().Add(f.tstampDelta)
+		statsObj = newObject(f.metricTemplate.statsObj)
+		tstamp := metric.Timestamp.Add(f.tstampDelta)
+		if f.statsBucket > 0 {
+			tstamp = tstamp.Truncate(f.statsBucket)
+		}
 		statsObj["timestamp"] = tstamp.Format("2006-01-02T15:04:05Z07:00")
 		f.temporaryStats[path] = statsObj
 		return statsObj, true
@@ -223,50 +286,36 @@ func (f *processorContext) fetchObjectForStats(id, path string, metric *plugin.M
 	}
 }
 
-func (f *processorContext) fetchObjectForIface(statsMap map[string]interface{}, metric *plugin.MetricType) (map[string]interface{}, bool) {
+func (f *processorContext) fetchObjectForIface(statsMap map[string]interface{}, metric *Metric) (map[string]interface{}, bool) {
 	ifacesMapRef, _ := util.NewObjWalker(statsMap).Seek("/network/interfaces")
 	ifacesMap := ifacesMapRef.(map[string]interface{})
 	ifaceName, _ := f.extractIfaceMetric(metric)
 	if iface, haveIface := ifacesMap[ifaceName]; haveIface {
 		return iface.(map[string]interface{}), true
 	} else {
-		var ifaceObj map[string]interface{}
-		json.Unmarshal([]byte(f.metricTemplate.ifaceSource), &ifaceObj)
+		ifaceObj := newObject(f.metricTemplate.ifaceObj)
 		ifacesMap[ifaceName] = ifaceObj
 		return ifaceObj, true
 	}
 
 }
 
-func (f *processorContext) fetchObjectForFs(statsMap map[string]interface{}, metric *plugin.MetricType) (map[string]interface{}, bool) {
+func (f *processorContext) fetchObjectForFs(statsMap map[string]interface{}, metric *Metric) (map[string]interface{}, bool) {
 	fsMapRef, _ := util.NewObjWalker(statsMap).Seek("/filesystem")
 	fsMap := fsMapRef.(map[string]interface{})
 	fsName, _ := f.extractFsMetric(metric)
 	if fs, haveFs := fsMap[fsName]; haveFs {
 		return fs.(map[string]interface{}), true
 	} else {
-		var fsObj map[string]interface{}
-		json.Unmarshal([]byte(f.metricTemplate.fsSource), &fsObj)
+		fsObj := newObject(f.metricTemplate.fsObj)
 		fsMap[fsName] = fsObj
 		return fsObj, true
 	}
 
 }
 
-func (f *processorContext) extractCustomMetrics(metric *plugin.MetricType) (dockerPath string, specs []cadv.MetricSpec, valid bool) {
-	copyMetric := func(metric plugin.MetricType, nsSuffix string) *plugin.MetricType {
-		res := metric
-		res.Tags_ = make(map[string]string, len(metric.Tags_))
-		for k, v := range metric.Tags_ {
-			res.Tags_[k] = v
-		}
-		res.Namespace_ = metric.Namespace_[:]
-		if nsSuffix != "" {
-			res.Namespace_ = score.Namespace(res.Namespace_).AddStaticElement(nsSuffix)
-		}
-		return &res
-	}
-	if valueMap, isMap := metric.Data().(map[string]float64); !isMap {
+func (f *processorContext) extractCustomMetrics(metric *Metric) (dockerPath string, specs []cadv.MetricSpec, valid bool) {
+	if valueMap, isMap := metric.Value.(map[string]float64); !isMap {
 		dockerPath1, spec1, valid1 := f.extractOneCustomMetric(metric)
 		if !valid1 {
 			return "", specs, false
@@ -278,8 +327,7 @@ func (f *processorContext) extractCustomMetrics(metric *plugin.MetricType) (dock
 		valid = false
 		dockerPath = ""
 		for k, v := range valueMap {
-			nuMetric := copyMetric(*metric, k)
-			nuMetric.Data_ = v
+			nuMetric := metric.withSuffix(k, v)
 			dockerPath1, spec1, valid1 := f.extractOneCustomMetric(nuMetric)
 			if dockerPath == "" {
 				dockerPath = dockerPath1
@@ -294,9 +342,8 @@ func (f *processorContext) extractCustomMetrics(metric *plugin.MetricType) (dock
 	}
 }
 
-func (f *processorContext) extractOneCustomMetric(metric *plugin.MetricType) (dockerPath string, spec cadv.MetricSpec, valid bool) {
-	tags := metric.Tags()
-	ns := metric.Namespace()
+func (f *processorContext) extractOneCustomMetric(metric *Metric) (dockerPath string, spec cadv.MetricSpec, valid bool) {
+	tags := metric.Tags
 	dockerPath = ""
 	spec = cadv.MetricSpec{
 		Type:   defCustomMetricType,
@@ -304,7 +351,7 @@ func (f *processorContext) extractOneCustomMetric(metric *plugin.MetricType) (do
 	}
 	var haveName, haveType, haveFormat, haveUnits, haveDockerPath bool
 	if spec.Name, haveName = tags[customMetricName]; !haveName {
-		spec.Name = strings.Join(ns.Strings(), "/")
+		spec.Name = strings.Join(metric.Namespace, "/")
 	}
 	tmpTag := ""
 	if tmpTag, haveType = tags[customMetricType]; haveType {
@@ -326,20 +373,20 @@ func (f *processorContext) extractOneCustomMetric(metric *plugin.MetricType) (do
 	}
 }
 
-func (f *processorContext) extractCustomValues(metric *plugin.MetricType, specs []cadv.MetricSpec) map[string]cadv.MetricVal {
+func (f *processorContext) extractCustomValues(metric *Metric, specs []cadv.MetricSpec) map[string]cadv.MetricVal {
 	res := make(map[string]cadv.MetricVal, len(specs))
-	if valueMap, isMap := metric.Data_.(map[string]float64); !isMap {
+	if valueMap, isMap := metric.Value.(map[string]float64); !isMap {
 		//FIXME:RMVIT\/
-		pri("custom_metrics: now probing value for %v, of %v; got specs: %+v \n", metric.Namespace().String(), reflect.TypeOf(metric.Data()), specs)
-		value, ok := f.extractOneCustomValue(&specs[0], metric.Timestamp_, metric.Data_)
+		pri("custom_metrics: now probing value for %v, of %v; got specs: %+v \n", metric.NamespaceString(), reflect.TypeOf(metric.Value), specs)
+		value, ok := f.extractOneCustomValue(&specs[0], metric.Timestamp, metric.Value)
 		if ok {
 			res[specs[0].Name] = value
 		}
 	} else {
 		for _, spec := range specs {
-			value, ok := f.extractOneCustomValue(&spec, metric.Timestamp_, valueMap[filepath.Base(spec.Name)])
+			value, ok := f.extractOneCustomValue(&spec, metric.Timestamp, valueMap[filepath.Base(spec.Name)])
 			//FIXME:RMVIT\/
-			pri("custom_metrics: probing one of values for %v, key: %v, value of: %v; got spec: %+v; is it ok: %v \n", metric.Namespace().String(), spec.Name, reflect.TypeOf(valueMap[spec.Name]), spec, ok)
+			pri("custom_metrics: probing one of values for %v, key: %v, value of: %v; got spec: %+v; is it ok: %v \n", metric.NamespaceString(), spec.Name, reflect.TypeOf(valueMap[spec.Name]), spec, ok)
 			if ok {
 				res[spec.Name] = value
 			}
@@ -411,7 +458,7 @@ func (f *processorContext) extractOneCustomValue(spec *cadv.MetricSpec, timeStam
 	return customVal, true
 }
 
-func (f *processorContext) extractDockerIdAndPathForCustomMetric(metric *plugin.MetricType) (string, string, bool) {
+func (f *processorContext) extractDockerIdAndPathForCustomMetric(metric *Metric) (string, string, bool) {
 	if dockerPath, _, valid := f.extractCustomMetrics(metric); !valid {
 		return "", "", false
 	} else {
@@ -421,99 +468,450 @@ func (f *processorContext) extractDockerIdAndPathForCustomMetric(metric *plugin.
 
 }
 
-func (f *processorContext) extractDockerIdAndPath(metric *plugin.MetricType) (id string, path string, anyMetric bool, customMetric bool) {
-	ns := metric.Namespace().String()
-	if strings.HasPrefix(ns, dockerMetricPrefix) {
-		tailSplit := strings.Split(strings.TrimLeft(strings.TrimPrefix(ns, dockerMetricPrefix), "/"), "/")
-		id := tailSplit[0]
-		path := "/" + id
-		if id == "root" {
-			id = "/"
-			path = "/"
+// extractDockerIdAndPath tells which container metric belongs to; metricIdx
+//is index of the first element of metric's namespace below the container
+func (f *processorContext) extractDockerIdAndPath(metric *Metric) (id string, path string, metricIdx int, anyMetric bool, customMetric bool) {
+	for _, resolver := range f.resolvers {
+		if id, path, metricIdx, resolved := resolveElements(resolver, metric); resolved {
+			if strings.HasPrefix(path, podContainerPathPrefix+"/") {
+				id, path = f.resolvePodContainer(id, path)
+			}
+			return id, path, metricIdx, true, false
+		}
+	}
+	if id, path, validCustomMetric := f.extractDockerIdAndPathForCustomMetric(metric); validCustomMetric {
+		return id, path, len(metric.Namespace), true, true
+	}
+	return "", "", 0, false, false
+}
+
+// resolvePodContainer routes metrics of pod-scoped container to the docker
+//container carrying matching kubernetes labels, if any is known
+func (f *processorContext) resolvePodContainer(id, podPath string) (string, string) {
+	if dockerPath, resolved := f.podContainerPaths[podPath]; resolved {
+		return f.state.DockerPaths[dockerPath], dockerPath
+	}
+	if dockerPath, found := f.findDockerForPodContainer(splitPodContainerPath(podPath)); found {
+		f.mergePodContainer(podPath, dockerPath)
+		f.podContainerPaths[podPath] = dockerPath
+		return f.state.DockerPaths[dockerPath], dockerPath
+	}
+	return id, podPath
+}
+
+func (f *processorContext) findDockerForPodContainer(podUid, containerName string) (string, bool) {
+	for path, dockerObj := range f.state.DockerStorage {
+		if strings.HasPrefix(path, podContainerPathPrefix+"/") {
+			continue
+		}
+		labels, _ := dockerObj.(map[string]interface{})["labels"].(map[string]interface{})
+		if labels[labelPodUid] == podUid && labels[labelContainerName] == containerName {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// mergePodContainer folds a pod-scoped container entry into docker container
+//entry which turned out to represent the same container; stats samples
+//with timestamps not yet known to docker entry are carried over
+func (f *processorContext) mergePodContainer(podPath, dockerPath string) {
+	f.mergeTemporaryStats(podPath, dockerPath)
+	podObj, havePod := f.state.DockerStorage[podPath]
+	if !havePod {
+		return
+	}
+	dockerObj := f.state.DockerStorage[dockerPath].(map[string]interface{})
+	dockerStats := dockerObj["stats"].([]interface{})
+	knownStamps := map[string]bool{}
+	for _, statsObj := range dockerStats {
+		knownStamps[statsObj.(map[string]interface{})["timestamp"].(string)] = true
+	}
+	for _, statsObj := range podObj.(map[string]interface{})["stats"].([]interface{}) {
+		if !knownStamps[statsObj.(map[string]interface{})["timestamp"].(string)] {
+			dockerStats = append(dockerStats, statsObj)
+		}
+	}
+	dockerObj["stats"] = dockerStats
+	f.reindexStats(dockerPath, dockerObj)
+	f.markDirty(dockerPath)
+	f.state.Events.Record(exchange.SeverityInfo, "pod_container_merge",
+		fmt.Sprintf("merged pod-scoped container %s into %s", podPath, dockerPath))
+	f.dropContainer(podPath)
+	if f.wal != nil {
+		f.wal.invalidate(dockerPath)
+	}
+}
+
+// mergeTemporaryStats carries stats of pod-scoped container gathered in
+//this batch over to docker container: taken as they are if docker container
+//got no stats yet, otherwise fields written for pod-scoped container are
+//copied unless docker container got them from a source of higher priority
+func (f *processorContext) mergeTemporaryStats(podPath, dockerPath string) {
+	podStats, havePodStats := f.temporaryStats[podPath]
+	if !havePodStats {
+		return
+	}
+	delete(f.temporaryStats, podPath)
+	dockerStats, haveDockerStats := f.temporaryStats[dockerPath]
+	if !haveDockerStats {
+		f.temporaryStats[dockerPath] = podStats
+		for objKey, written := range f.writtenTargets {
+			if objKey == podPath || strings.HasPrefix(objKey, podPath+"\x00") {
+				f.writtenTargets[dockerPath+strings.TrimPrefix(objKey, podPath)] = written
+				delete(f.writtenTargets, objKey)
+			}
+		}
+		return
+	}
+	f.mergeWrittenFields(podPath, dockerPath, podStats, dockerStats)
+	for _, group := range []struct {
+		location string
+		objKey   func(string, string) string
+	}{
+		{"/network/interfaces", ifaceObjKey},
+		{"/filesystem", fsObjKey},
+	} {
+		podObjsRef, _ := util.NewObjWalker(podStats).Seek(group.location)
+		dockerObjsRef, _ := util.NewObjWalker(dockerStats).Seek(group.location)
+		podObjs, _ := podObjsRef.(map[string]interface{})
+		dockerObjs, isMap := dockerObjsRef.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		for _, name := range sortedNames(podObjs) {
+			podKey, dockerKey := group.objKey(podPath, name), group.objKey(dockerPath, name)
+			dockerObj, haveObj := dockerObjs[name]
+			if !haveObj {
+				dockerObjs[name] = podObjs[name]
+				if written, haveWritten := f.writtenTargets[podKey]; haveWritten {
+					f.writtenTargets[dockerKey] = written
+					delete(f.writtenTargets, podKey)
+				}
+				continue
+			}
+			f.mergeWrittenFields(podKey, dockerKey, podObjs[name].(map[string]interface{}), dockerObj.(map[string]interface{}))
 		}
-		return id, path, true, false
-	} else if id, path, validCustomMetric := f.extractDockerIdAndPathForCustomMetric(metric); validCustomMetric {
-		return id, path, true, true
-	} else {
-		return "", "", false, false
 	}
 }
 
+// mergeWrittenFields copies fields written to source object in this batch
+//to destination object, along with their priorities
+func (f *processorContext) mergeWrittenFields(srcKey, destKey string, src, dest map[string]interface{}) {
+	srcWritten, haveWritten := f.writtenTargets[srcKey]
+	if !haveWritten {
+		return
+	}
+	delete(f.writtenTargets, srcKey)
+	destWritten, haveDestWritten := f.writtenTargets[destKey]
+	if !haveDestWritten {
+		destWritten = f.newWrittenTargets()
+		f.writtenTargets[destKey] = destWritten
+	}
+	srcWalker, destWalker := util.NewObjWalker(src), util.NewObjWalker(dest)
+	for target, priority := range srcWritten {
+		if destPriority, wasWritten := destWritten[target]; wasWritten && destPriority >= priority {
+			continue
+		}
+		if value, err := srcWalker.Seek(target); err == nil && destWalker.Set(target, value) == nil {
+			destWritten[target] = priority
+		}
+	}
+}
+
+// podContainerPath returns path of pod-scoped container entry
+func podContainerPath(podUid, containerName string) string {
+	return strings.Join([]string{podContainerPathPrefix, podUid, containerName}, "/")
+}
+
+// splitPodContainerPath returns pod UID and container name given path of
+//pod-scoped container entry; pod UID holds no separators, so anything
+//following it names the container
+func splitPodContainerPath(path string) (podUid, containerName string) {
+	pathSplit := strings.SplitN(strings.TrimPrefix(path, podContainerPathPrefix+"/"), "/", 2)
+	if len(pathSplit) < 2 {
+		return pathSplit[0], ""
+	}
+	return pathSplit[0], pathSplit[1]
+}
+
+func annotatePodContainer(dockerMap map[string]interface{}, path string) {
+	podUid, containerName := splitPodContainerPath(path)
+	labels, haveLabels := dockerMap["labels"].(map[string]interface{})
+	if !haveLabels {
+		labels = map[string]interface{}{}
+		dockerMap["labels"] = labels
+	}
+	labels[labelPodUid] = podUid
+	labels[labelContainerName] = containerName
+}
+
 
 //// INSERTING statistics into publisher's state
 
-func (f *processorContext) insertIntoStats(dockerPath string, statsObj map[string]interface{}, metric *plugin.MetricType) (didInsert bool) {
-	ns := metric.Namespace().String()
+func (f *processorContext) insertIntoStats(dockerPath string, statsObj map[string]interface{}, metric *Metric) (didInsert bool) {
+	ns := metric.NamespaceString()
 	didInsert = false
-	if sourcePaths, isStatsMetric := f.validateStatsMetric(dockerPath, ns); isStatsMetric {
+	if sourcePaths, isStatsMetric := f.validateStatsMetric(metric); isStatsMetric {
 		for _, sourcePath := range sourcePaths {
-			targetPath := f.metricTemplate.mapToStats[sourcePath]["target"]
-			metricParent, _ := util.NewObjWalker(statsObj).Seek(filepath.Dir(targetPath))
-			metricParentMap := metricParent.(map[string]interface{})
-			metricParentMap[filepath.Base(targetPath)] = metric.Data()
+			spec := lookupSpec(f.metricTemplate.mapToStats, sourcePath)
+			if value, haveValue := f.specValue(dockerPath, dockerPath, spec, metric); haveValue {
+				f.storeValue(dockerPath, statsObj, spec, value, ns)
+			}
 			didInsert = true
 		}
 	}
 	return
 }
-func (f *processorContext) insertIntoIface(dockerPath string, statsObj map[string]interface{}, metric *plugin.MetricType) (didInsert bool) {
-	ns := metric.Namespace().String()
-	if sourcePaths, isIfaceMetric := f.validateIfaceMetric(dockerPath, ns); !isIfaceMetric {
+func (f *processorContext) insertIntoIface(dockerPath string, statsObj map[string]interface{}, metric *Metric) (didInsert bool) {
+	ns := metric.NamespaceString()
+	if sourcePaths, isIfaceMetric := f.validateIfaceMetric(metric); !isIfaceMetric {
 		return false
 	} else {
 		ifaceObj, _ := f.fetchObjectForIface(statsObj, metric)
+		ifaceName, _ := f.extractIfaceMetric(metric)
+		objKey := ifaceObjKey(dockerPath, ifaceName)
 		for _, sourcePath := range sourcePaths {
-			targetPath := f.metricTemplate.mapToIface[sourcePath]["target"]
-			metricParent, _ := util.NewObjWalker(ifaceObj).Seek(filepath.Dir(targetPath))
-			metricParentMap := metricParent.(map[string]interface{})
-			metricParentMap[filepath.Base(targetPath)] = metric.Data()
+			spec := lookupSpec(f.metricTemplate.mapToIface, sourcePath)
+			if value, haveValue := f.specValue(dockerPath, objKey, spec, metric); haveValue {
+				f.storeValue(objKey, ifaceObj, spec, value, ns)
+			}
 			didInsert = true
 		}
 		return true
 	}
 }
 
-func (f *processorContext) insertIntoFs(dockerPath string, statsObj map[string]interface{}, metric *plugin.MetricType) (didInsert bool) {
-	ns := metric.Namespace().String()
-	if sourcePaths, isFsMetric := f.validateFsMetric(dockerPath, ns); !isFsMetric {
+func (f *processorContext) insertIntoFs(dockerPath string, statsObj map[string]interface{}, metric *Metric) (didInsert bool) {
+	ns := metric.NamespaceString()
+	if sourcePaths, isFsMetric := f.validateFsMetric(metric); !isFsMetric {
 		return false
 	} else {
 		fsObj, _ := f.fetchObjectForFs(statsObj, metric)
+		fsName, _ := f.extractFsMetric(metric)
+		objKey := fsObjKey(dockerPath, fsName)
 		for _, sourcePath := range sourcePaths {
-			targetPath := f.metricTemplate.mapToFs[sourcePath]["target"]
-			metricParent, _ := util.NewObjWalker(fsObj).Seek(filepath.Dir(targetPath))
-			metricParentMap := metricParent.(map[string]interface{})
-			metricParentMap[filepath.Base(targetPath)] = metric.Data()
+			spec := lookupSpec(f.metricTemplate.mapToFs, sourcePath)
+			if value, haveValue := f.specValue(dockerPath, objKey, spec, metric); haveValue {
+				f.storeValue(objKey, fsObj, spec, value, ns)
+			}
 			didInsert = true
 		}
 		return true
 	}
 }
 
-func (f *processorContext) insertIntoDocker(dockerPath string, dockerObj map[string]interface{}, metric *plugin.MetricType) (didInsert bool) {
-	ns := metric.Namespace().String()
+// insertIntoDocker stores container-level metric; once container is known
+//only fields flagged with `update` in the template are refreshed
+func (f *processorContext) insertIntoDocker(dockerPath string, dockerObj map[string]interface{}, metric *Metric, firstTimeDocker bool) (didInsert bool) {
+	ns := metric.NamespaceString()
 	didInsert = false
-	sourcePaths, isDockerMetric := f.validateDockerMetric(dockerPath, ns)
+	sourcePaths, isDockerMetric := f.validateDockerMetric(metric)
 	if !isDockerMetric {
 		return
 	}
 	for _, sourcePath := range sourcePaths {
-		targetPath := f.metricTemplate.mapToDocker[sourcePath]["target"]
-		metricParent, _ := util.NewObjWalker(dockerObj).Seek(filepath.Dir(targetPath))
-		metricParentMap := metricParent.(map[string]interface{})
-		metricParentMap[filepath.Base(targetPath)] = metric.Data()
+		spec := lookupSpec(f.metricTemplate.mapToDocker, sourcePath)
+		if !firstTimeDocker && !isUpdatable(spec) {
+			continue
+		}
+		f.storeValue(dockerPath+"\x00docker", dockerObj, spec, metric.Value, ns)
 		didInsert = true
 	}
 	return
 }
 
-func (f *processorContext) insertIntoCustomMetrics(dockerPath string, dockerObj map[string]interface{}, metric *plugin.MetricType) (didInsert bool) {
+// storeValue puts metric value, converted to the unit given by value spec,
+//at the target location given by the spec, noting that target of given
+//object got a real value; value already stored from a source of higher
+//priority is not overwritten
+func (f *processorContext) storeValue(objKey string, obj map[string]interface{}, spec map[string]string, value interface{}, source string) {
+	targetPath := spec["target"]
+	written, haveWritten := f.writtenTargets[objKey]
+	if !haveWritten {
+		written = f.newWrittenTargets()
+		f.writtenTargets[objKey] = written
+	}
+	priority := f.sourcePriority(source)
+	if prevPriority, wasWritten := written[targetPath]; wasWritten && prevPriority > priority {
+		return
+	}
+	normalized, coerced := normalizeValue(spec, f.metricTemplate.convertValue(spec, value))
+	if !coerced {
+		f.logger.WithFields(log.Fields{"target": targetPath, "source": source, "value": value}).Debug("Value doesn't fit type of its field, dropped")
+		return
+	}
+	walker := util.NewObjWalker(obj)
+	set := walker.Set
+	if static, dynamic := spec[specStaticTarget]; dynamic {
+		// elements resolved from metric namespace are created as needed,
+		//under the part of target found in the template
+		if _, err := walker.Seek(static); err == nil {
+			set = walker.SetCreating
+		}
+	}
+	if err := set(targetPath, normalized); err != nil {
+		f.logger.WithFields(log.Fields{"target": targetPath, "source": source}).Debug("Target of value spec not found, value dropped")
+		return
+	}
+	written[targetPath] = priority
+}
+
+// sourcePriority returns priority of the rule with longest prefix matching
+//metric namespace; sources not matching any rule get priority 0
+func (f *core) sourcePriority(source string) int {
+	priority, matchLen := 0, -1
+	for _, rule := range f.sourcePriorities {
+		if strings.HasPrefix(source, rule.prefix) && len(rule.prefix) > matchLen {
+			priority, matchLen = rule.priority, len(rule.prefix)
+		}
+	}
+	return priority
+}
+
+func ifaceObjKey(dockerPath, ifaceName string) string {
+	return dockerPath + "\x00network/" + ifaceName
+}
+
+func fsObjKey(dockerPath, fsName string) string {
+	return dockerPath + "\x00filesystem/" + fsName
+}
+
+// sortedNames returns keys of map of objects, in order
+func sortedNames(objs map[string]interface{}) []string {
+	names := make([]string, 0, len(objs))
+	for name := range objs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pruneDefaultFields removes from the object fields which still hold template
+//defaults, as no metric was received for them
+func (f *processorContext) pruneDefaultFields(objKey string, obj map[string]interface{}, mapping map[string]map[string]string) {
+	written := f.writtenTargets[objKey]
+	for _, spec := range mapping {
+		if _, wasWritten := written[spec["target"]]; wasWritten || !f.shouldPrune(spec) {
+			continue
+		}
+		if parent, err := util.NewObjWalker(obj).Seek(filepath.Dir(spec["target"])); err == nil {
+			if parentMap, isMap := parent.(map[string]interface{}); isMap {
+				delete(parentMap, filepath.Base(spec["target"]))
+			}
+		}
+	}
+}
+
+// shouldPrune tells if field described by value spec should be omitted
+//when holding default value; template flag 'prune' overrides global setting
+func (f *core) shouldPrune(spec map[string]string) bool {
+	if prune, haveFlag := spec["prune"]; haveFlag {
+		flag, _ := strconv.ParseBool(prune)
+		return flag
+	}
+	return f.pruneDefaults
+}
+
+// normalizeValue coerces value to the type given by `norm` template flag
+//(`int64`, `float64`, `str` or `bool`), by default derived from type of
+//the value spec, so the exported type doesn't depend on collector or
+//architecture; `norm=none` leaves values as they come. Returns false if
+//value can't be coerced safely
+func normalizeValue(spec map[string]string, value interface{}) (interface{}, bool) {
+	norm, haveNorm := spec["norm"]
+	if !haveNorm {
+		norm = defaultNorms[spec["type"]]
+	}
+	switch norm {
+	case normInt64:
+		return coerceInt64Value(value)
+	case normFloat64:
+		return coerceFloat64Value(value)
+	case normString:
+		return coerceStringValue(value)
+	case normBool:
+		return coerceBoolValue(value)
+	}
+	return value, true
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return clampToInt64(uint64(v)), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return clampToInt64(v), true
+	case float32:
+		return toInt64(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		if v >= math.MaxInt64 {
+			return math.MaxInt64, true
+		}
+		if v <= math.MinInt64 {
+			return math.MinInt64, true
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func clampToInt64(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	if intVal, isInt := toInt64(value); isInt {
+		return float64(intVal), true
+	}
+	return 0, false
+}
+
+func (f *processorContext) insertIntoCustomMetrics(dockerPath string, dockerObj map[string]interface{}, metric *Metric) (didInsert bool) {
 	didInsert = false
 	_, specs, valid := f.extractCustomMetrics(metric)
 	if !valid {
 		return
 	}
 	values := f.extractCustomValues(metric, specs)
+	return f.storeCustomMetrics(dockerPath, dockerObj, specs, values)
+}
+
+// storeCustomMetrics adds specs of custom metrics to container's spec and
+//queues their values for merging into stats
+func (f *processorContext) storeCustomMetrics(dockerPath string, dockerObj map[string]interface{}, specs []cadv.MetricSpec, values map[string]cadv.MetricVal) (didInsert bool) {
 	//-- insert spec
 	specMap := dockerObj["spec"].(map[string]interface{})
 	metricList := specMap["custom_metrics"].([]interface{})
@@ -542,11 +940,7 @@ func (f *processorContext) insertIntoCustomMetrics(dockerPath string, dockerObj
 		dbg_valuesIn = append(dbg_valuesIn, spec.Name)
 
 		// find room for custom metrics
-		dockerValuesMap, gotDockerValuesMap := f.state.PendingMetrics[dockerPath]
-		if !gotDockerValuesMap {
-			dockerValuesMap = map[string][]cadv.MetricVal{}
-			f.state.PendingMetrics[dockerPath] = dockerValuesMap
-		}
+		dockerValuesMap := f.pendingMetricsOf(dockerPath)
 		statsList, _ := dockerValuesMap[spec.Name]
 		statsList = append(statsList, customVal)
 		dockerValuesMap[spec.Name] = statsList
@@ -557,6 +951,36 @@ func (f *processorContext) insertIntoCustomMetrics(dockerPath string, dockerObj
 	return
 }
 
+// insertIntoUnmappedMetrics emits metric of container which doesn't map
+//to the template as custom metric, named after elements of metric's
+//namespace below the container, starting at metricIdx
+func (f *processorContext) insertIntoUnmappedMetrics(dockerPath string, dockerObj map[string]interface{}, metric *Metric, metricIdx int) (didInsert bool) {
+	if metricIdx >= len(metric.Namespace) {
+		return false
+	}
+	name := strings.Join(metric.Namespace[metricIdx:], "/")
+	if name == "" {
+		return false
+	}
+	spec := cadv.MetricSpec{
+		Name:  name,
+		Type:  defCustomMetricType,
+		Units: defCustomMetricUnits,
+	}
+	switch metric.Value.(type) {
+	case float32, float64:
+		spec.Format = cadv.FloatType
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		spec.Format = cadv.IntType
+	default:
+		return false
+	}
+	value, validValue := f.extractOneCustomValue(&spec, metric.Timestamp, metric.Value)
+	if !validValue {
+		return false
+	}
+	return f.storeCustomMetrics(dockerPath, dockerObj, []cadv.MetricSpec{spec}, map[string]cadv.MetricVal{spec.Name: value})
+}
 
 //// MERGING stats from temporary structures into  stats element for container
 
@@ -567,60 +991,190 @@ func (f *processorContext) mergeStatsForDocker(id, path string) {
 		// no stats for that docker were allocated in this round of processing
 		return
 	}
+	f.pruneDefaultFields(path, statsObj, f.metricTemplate.mapToStats)
 	// convert iface map to iface list, as expected by consumers of the REST API
-	networkRef, _ := util.NewObjWalker(statsObj).Seek("/network")
-	ifaceMapRef, _ := util.NewObjWalker(networkRef).Seek("/interfaces")
-	ifaceMap := ifaceMapRef.(map[string]interface{})
-	networkMap := networkRef.(map[string]interface{})
-	ifaceList := []interface{}{}
-	for _, ifaceObj := range ifaceMap {
-		ifaceList = append(ifaceList, ifaceObj)
+	statsWalker := util.NewObjWalker(statsObj)
+	var ifaceNames, fsNames []string
+	if !f.disabledGroups[groupNetwork] {
+		// names of interfaces may hold separators, so they're taken from
+		//matched keys rather than paths
+		ifaceObjs, _ := statsWalker.SeekAll("/network/interfaces/*")
+		ifaceList := []interface{}{}
+		for _, match := range ifaceObjs {
+			ifaceName := match.Keys[len(match.Keys)-1]
+			ifaceNames = append(ifaceNames, ifaceName)
+			f.pruneDefaultFields(ifaceObjKey(path, ifaceName), match.Value.(map[string]interface{}), f.metricTemplate.mapToIface)
+			ifaceList = append(ifaceList, match.Value)
+		}
+		statsWalker.Set("/network/interfaces", ifaceList)
 	}
-	networkMap["interfaces"] = ifaceList
 
 	// convert fs map to fs list, as expected by consumers
-	fsMapRef, _ := util.NewObjWalker(statsObj).Seek("/filesystem")
-	fsMap := fsMapRef.(map[string]interface{})
-	fsList := []interface{} {}
-	for _, fsObj := range fsMap {
-		fsList = append(fsList, fsObj)
+	if !f.disabledGroups[groupFilesystem] {
+		fsObjs, _ := statsWalker.SeekAll("/filesystem/*")
+		fsList := []interface{} {}
+		for _, match := range fsObjs {
+			fsName := match.Keys[len(match.Keys)-1]
+			fsNames = append(fsNames, fsName)
+			f.pruneDefaultFields(fsObjKey(path, fsName), match.Value.(map[string]interface{}), f.metricTemplate.mapToFs)
+			fsList = append(fsList, match.Value)
+		}
+		statsWalker.Set("/filesystem", fsList)
 	}
-	statsObj["filesystem"] = fsList
+
+	runStatsHooks(f.hooks.beforeMerge, path, dockerObj, statsObj)
 
 	// add in-progress stats element to statsList
 	statsList := dockerObj["stats"].([]interface{})
-	f.makeRoomForStats(&statsList, statsObj)
-	statsList = append(statsList, statsObj)
-	dockerObj["stats"] = statsList
+	merged := false
+	if (f.statsBucket > 0 || f.tracksSources()) && len(statsList) > 0 {
+		// stats of the same time bucket (or timestamp, if source
+		//priorities are given) are merged instead of appended
+		lastStats := statsList[len(statsList)-1].(map[string]interface{})
+		if lastStats["timestamp"] == statsObj["timestamp"] {
+			if sources, haveSources := f.statsSources[path]; haveSources {
+				f.mergeBySource(path, sources, lastStats, statsObj, ifaceNames, fsNames)
+			} else {
+				f.mergeIntoBucket(path, lastStats, statsObj)
+			}
+			statsObj, merged = lastStats, true
+			f.samplesMerged++
+		}
+	}
+	if !merged {
+		f.samplesAdded++
+		lenBefore := len(statsList)
+		f.makeRoomForStats(path, &statsList, statsObj)
+		statsList = append(statsList, statsObj)
+		dockerObj["stats"] = statsList
+		f.updateStatsIndex(path, dockerObj, lenBefore-(len(statsList)-1))
+		f.recordSources(path, ifaceNames, fsNames)
+	}
 
 	// merge custom metrics
 	f.mergePendingMetrics(path, statsList)
 	f.dropTooOldPendingMetrics(path, statsList)
+	deriveCreationTime(dockerObj, statsObj)
+	runStatsHooks(f.hooks.afterMerge, path, dockerObj, statsObj)
+	f.downsampleStats(path, statsObj)
+
+	if f.validateOutputs {
+		f.validateOutput(path, dockerObj)
+	}
+	if f.wal != nil {
+		if merged {
+			f.wal.invalidate(path)
+		}
+		f.wal.logStats(path, dockerObj, statsObj)
+	}
+	if f.state.Feed.HasSubscribers() {
+		f.state.Feed.Publish(exchange.StatsUpdate{
+			Container: path,
+			Id:        id,
+			Stats:     util.DeepCopy(statsObj).(map[string]interface{}),
+		})
+	}
 }
 
-// make sure we don't overflow  statsDepth nor  statsSpan when
-//new  statsObj is added
-func (f *processorContext) makeRoomForStats(destStatsList *[]interface{}, statsObj map[string]interface{}) {
-	validOfs := 0
-	statsList := *destStatsList
-	if f.statsDepth > 0 && len(statsList) == f.statsDepth {
-		validOfs++
+// mergeIntoBucket merges stats falling into the same time bucket as the
+//most recent stats of container into them: fields which got values in this
+//batch are overwritten, interfaces and filesystems are replaced if any
+//were reported and custom metrics are appended
+func (f *processorContext) mergeIntoBucket(path string, bucketStats, statsObj map[string]interface{}) {
+	bucketWalker, statsWalker := util.NewObjWalker(bucketStats), util.NewObjWalker(statsObj)
+	for target := range f.writtenTargets[path] {
+		value, err := statsWalker.Seek(target)
+		if err != nil {
+			continue
+		}
+		if parent, err := bucketWalker.Seek(filepath.Dir(target)); err == nil {
+			if parentMap, isMap := parent.(map[string]interface{}); isMap {
+				parentMap[filepath.Base(target)] = value
+			}
+		}
+	}
+	if ifaceList, _ := util.NewObjWalker(statsObj).Seek("/network/interfaces"); ifaceList != nil && len(ifaceList.([]interface{})) > 0 {
+		if networkMap, isMap := bucketStats["network"].(map[string]interface{}); isMap {
+			networkMap["interfaces"] = ifaceList
+		}
+	}
+	if fsList, isList := statsObj["filesystem"].([]interface{}); isList && len(fsList) > 0 {
+		bucketStats["filesystem"] = fsList
 	}
-	if f.statsSpan <= 0 {
-		statsList = statsList[:copy(statsList, statsList[validOfs:])]
+	mergeCustomMetrics(bucketStats, statsObj)
+}
+
+// mergeCustomMetrics appends custom metrics of stats to the ones of
+//stats they are merged into
+func mergeCustomMetrics(bucketStats, statsObj map[string]interface{}) {
+	customMap, _ := statsObj["custom_metrics"].(map[string]interface{})
+	bucketCustomMap, haveCustom := bucketStats["custom_metrics"].(map[string]interface{})
+	if !haveCustom {
 		return
 	}
-	nuStamp, _ := util.ParseTime(statsObj["timestamp"].(string))
-	for validOfs < len(statsList) {
-		ckStamp, _ := util.ParseTime(statsList[validOfs].(map[string]interface{})["timestamp"].(string))
-		span := nuStamp.Sub(ckStamp)
-		if span <= f.statsSpan {
-			break
-		}
-		validOfs++
+	for metricName, values := range customMap {
+		valueList, _ := values.([]interface{})
+		bucketValues, _ := bucketCustomMap[metricName].([]interface{})
+		bucketCustomMap[metricName] = append(bucketValues, valueList...)
 	}
+}
+
+// updateStatsIndex brings index of container's stats up to date after
+//dropping some of the oldest stats and appending the new one; index is
+//rebuilt from scratch if it went out of sync or stats came out of order
+func (f *processorContext) updateStatsIndex(path string, dockerObj map[string]interface{}, dropped int) {
+	statsList := dockerObj["stats"].([]interface{})
+	index, haveIndex := f.state.StatsIndex[path]
+	if !haveIndex || dropped < 0 || dropped > len(index) || len(index)-dropped != len(statsList)-1 {
+		f.reindexStats(path, dockerObj)
+		return
+	}
+	index = index[dropped:]
+	stamp, _ := util.ParseTime(statsList[len(statsList)-1].(map[string]interface{})["timestamp"].(string))
+	if len(index) > 0 && stamp.Before(index[len(index)-1]) {
+		f.reindexStats(path, dockerObj)
+		return
+	}
+	f.state.StatsIndex[path] = append(index, stamp)
+}
+
+// reindexStats sorts container's stats by timestamp and builds their index
+func (f *core) reindexStats(path string, dockerObj map[string]interface{}) {
+	statsList := dockerObj["stats"].([]interface{})
+	index := make(exchange.StatsIndex, len(statsList))
+	for i, statsObj := range statsList {
+		index[i], _ = util.ParseTime(statsObj.(map[string]interface{})["timestamp"].(string))
+	}
+	sort.Sort(statsByTime{statsList, index})
+	f.state.StatsIndex[path] = index
+}
+
+type statsByTime struct {
+	stats []interface{}
+	index exchange.StatsIndex
+}
+
+func (s statsByTime) Len() int {
+	return len(s.stats)
+}
+
+func (s statsByTime) Swap(i, j int) {
+	s.stats[i], s.stats[j] = s.stats[j], s.stats[i]
+	s.index[i], s.index[j] = s.index[j], s.index[i]
+}
+
+func (s statsByTime) Less(i, j int) bool {
+	return s.index[i].Before(s.index[j])
+}
+
+// make sure we don't overflow  statsDepth nor  statsSpan when
+//new  statsObj is added
+func (f *processorContext) makeRoomForStats(path string, destStatsList *[]interface{}, statsObj map[string]interface{}) {
+	statsList := *destStatsList
+	nuStamp, _ := util.ParseTime(statsObj["timestamp"].(string))
+	validOfs := f.retainedOffset(path, statsList, nuStamp, 1)
 	statsList = statsList[:copy(statsList, statsList[validOfs:])]
-	destStatsList = &statsList
+	*destStatsList = statsList
 }
 
 func (f *processorContext) mergePendingMetrics(path string, statsList []interface{}) {
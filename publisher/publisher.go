@@ -20,7 +20,6 @@ limitations under the License.
 package publisher
 
 import (
-	"bytes"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -29,14 +28,18 @@ import (
 
 	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
 	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/server"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
 	"github.com/intelsdi-x/snap/control/plugin"
 	"github.com/intelsdi-x/snap/control/plugin/cpolicy"
 	"github.com/intelsdi-x/snap/core/ctypes"
 	cadv "github.com/google/cadvisor/info/v1"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 	"runtime/debug"
+	"strconv"
 	"strings"
 )
 
@@ -64,6 +67,192 @@ const (
 	cfgTstampDelta     = "timestamp_delta"
 )
 
+const kubernetesMetricPrefix = "/intel/kubernetes"
+
+const (
+	templateRetryInitial = time.Second
+	templateRetryMax     = time.Minute
+	defEventLogSize      = 256
+	// core stats are sampled every minute over the last hour
+	statsHistoryInterval = time.Minute
+	statsHistorySize     = 60
+)
+
+const (
+	defProxyNodes       = ""
+	defProxyCacheTTLStr = "10s"
+	defProxyCacheTTL    = 10 * time.Second
+	cfgProxyNodes       = "proxy_nodes"
+	cfgProxyCacheTTL    = "proxy_cache_ttl"
+	defTmplAuthHeader   = ""
+	cfgTmplAuthHeader   = "export_tmpl_auth_header"
+	defAdminServerAddr  = "127.0.0.1"
+	defAdminServerPort  = 0
+	cfgAdminServerAddr  = "admin_server_addr"
+	cfgAdminServerPort  = "admin_server_port"
+	defWatchdogInterval = "0"
+	defWatchdogMissed   = 3
+	defWatchdogWebhook  = ""
+	cfgWatchdogInterval = "watchdog_interval"
+	cfgWatchdogMissed   = "watchdog_missed_intervals"
+	cfgWatchdogWebhook  = "watchdog_webhook"
+	defIdleTimeout      = "0"
+	defIdleStatsDepth   = 1
+	cfgIdleTimeout      = "idle_timeout"
+	cfgIdleStatsDepth   = "idle_stats_depth"
+	defIdentityStitch   = false
+	cfgIdentityStitch   = "identity_stitching"
+	cfgDisableGroups    = "disable_groups"
+	defDisableGroups    = ""
+	cfgPruneDefaults    = "prune_defaults"
+	defPruneDefaults    = false
+	cfgSourcePriorities = "source_priorities"
+	defSourcePriorities = ""
+	cfgValidateOutput   = "debug_validate_output"
+	defValidateOutput   = false
+	cfgStateSeedFile    = "state_seed_file"
+	defStateSeedFile    = ""
+	cfgGobTypes         = "gob_types"
+	defGobTypes         = ""
+	cfgStateStore       = "state_store"
+	defStateStore       = stateStoreWal
+	cfgRemovalExportDir = "removal_export_dir"
+	defRemovalExportDir = ""
+	cfgPushSinkUrl      = "push_sink_url"
+	defPushSinkUrl      = ""
+	cfgPushTimeout      = "push_timeout"
+	defPushTimeoutStr   = "10s"
+	defPushTimeout      = 10 * time.Second
+	cfgCaptureNew       = "capture_new_containers"
+	defCaptureNew       = false
+	cfgTmplReload       = "export_tmpl_reload_interval"
+	defTmplReload       = "0"
+	cfgAuthToken        = "auth_token"
+	defAuthToken        = ""
+	cfgAuthBasic        = "auth_basic"
+	defAuthBasic        = ""
+	cfgUnmappedCustom   = "unmapped_as_custom_metrics"
+	defUnmappedCustom   = false
+	cfgTombstoneTTL     = "tombstone_ttl"
+	defTombstoneTTLStr  = "1h"
+	defTombstoneTTL     = time.Hour
+	cfgPodAggregation   = "pod_aggregation"
+	defPodAggregation   = false
+	cfgKubeApi          = "kubernetes_api"
+	defKubeApi          = ""
+	cfgKubeNode         = "kubernetes_node"
+	defKubeNode         = ""
+	cfgKubeRefresh      = "kubernetes_refresh_interval"
+	defKubeRefreshStr   = "30s"
+	defKubeRefresh      = 30 * time.Second
+	cfgStatsBucket      = "stats_bucket"
+	defStatsBucket      = "0"
+	cfgBatchSummary     = "debug_batch_summary"
+	defBatchSummary     = ""
+	cfgPushInterval     = "push_interval"
+	defPushInterval     = "0"
+	cfgPushBatchSize    = "push_batch_size"
+	defPushBatchSize    = 0
+	cfgMemWatermark     = "memory_watermark_mb"
+	defMemWatermark     = 0
+	cfgMemCheckInterval = "memory_check_interval"
+	defMemCheckInterval = "10s"
+	cfgGrpcPort         = "grpc_port"
+	defGrpcPort         = 0
+	cfgStateDir         = "state_dir"
+	defStateDir         = ""
+	cfgStateSnapshot    = "state_snapshot_interval"
+	defStateSnapshotStr = "1m"
+	defStateSnapshot    = time.Minute
+	cfgMaxMemory        = "max_memory_mb"
+	defMaxMemory        = 0
+	cfgContainerTTL     = "container_ttl"
+	defContainerTTL     = "0"
+	cfgSourceTag        = "source_tag"
+	defSourceTag        = ""
+	cfgTstampSource     = "timestamp_source"
+	defTstampSource     = tstampSourceMetric
+	cfgDownsampleTiers  = "downsample_tiers"
+	defDownsampleTiers  = ""
+	cfgPortFallback     = "server_port_fallback"
+	defPortFallback     = 0
+	cfgCompression      = "server_compression"
+	defCompression      = true
+	cfgMaxResponse      = "server_max_response_kb"
+	defMaxResponse      = 0
+	cfgDebugPprof       = "debug_pprof"
+	defDebugPprof       = false
+	cfgRetention        = "retention"
+	defRetention        = retentionLimited
+	cfgNamespaceQuota   = "namespace_max_containers"
+	defNamespaceQuota   = 0
+	cfgPrefixQuota      = "prefix_max_containers"
+	defPrefixQuota      = 0
+	cfgLogLevel         = "log_level"
+	defLogLevel         = "info"
+	cfgLogFormat        = "log_format"
+	defLogFormat        = logFormatText
+	cfgTmplFallback     = "template_fallback"
+	defTmplFallback     = false
+	cfgLogFile          = "log_file"
+	defLogFile          = ""
+	cfgLogMaxSize       = "log_max_size"
+	defLogMaxSize       = 100
+	cfgLogMaxBackups    = "log_max_backups"
+	defLogMaxBackups    = 3
+	cfgShutdownTimeout  = "shutdown_timeout"
+	defShutdownTimeout  = "10s"
+	cfgPortFile         = "server_port_file"
+	defPortFile         = ""
+	cfgRegisterUrl      = "server_register_url"
+	defRegisterUrl      = ""
+	cfgProcWorkers      = "processing_workers"
+	defProcWorkers      = 1
+	cfgRetOverrides     = "retention_overrides"
+	defRetOverrides     = ""
+	cfgJanitorInterval  = "janitor_interval"
+	defJanitorInterval  = "0"
+	cfgStateDumpDir     = "state_dump_dir"
+	defStateDumpDir     = ""
+	cfgBootstrapFile    = "bootstrap_state_file"
+	defBootstrapFile    = ""
+	cfgInfluxUrl        = "influxdb_url"
+	defInfluxUrl        = ""
+	cfgInfluxDatabase   = "influxdb_database"
+	defInfluxDatabase   = "k8s"
+	cfgInfluxRetention  = "influxdb_retention_policy"
+	defInfluxRetention  = ""
+	cfgInfluxBatchSize  = "influxdb_batch_size"
+	defInfluxBatchSize  = 5000
+	cfgProxyDiscovery   = "proxy_discovery_selector"
+	defProxyDiscovery   = ""
+	cfgProxyDiscPort    = "proxy_discovery_port"
+	defProxyDiscPort    = 0
+	cfgDockerEndpoint   = "docker_endpoint"
+	defDockerEndpoint   = ""
+	cfgDockerRefresh    = "docker_refresh_interval"
+	defDockerRefreshStr = "30s"
+	defDockerRefresh    = 30 * time.Second
+	cfgPodMemberTimeout = "pod_member_timeout"
+	defPodMemberTimeout = "1m"
+	cfgMemReleaseOS     = "memory_release_os"
+	defMemReleaseOS     = false
+	cfgStreamOrigins    = "stream_origins"
+	defStreamOrigins    = ""
+	cfgInfluxUsername   = "influxdb_username"
+	defInfluxUsername   = ""
+	cfgInfluxPassword   = "influxdb_password"
+	defInfluxPassword   = ""
+	cfgTaskName         = "task_name"
+	defTaskName         = ""
+)
+
+const (
+	groupNetwork       = "network"
+	groupFilesystem    = "filesystem"
+	groupCustomMetrics = "custom_metrics"
+)
+
 const (
 	customMetricName = "custom_metric_name"
 	customMetricType = "custom_metric_type"
@@ -85,18 +274,89 @@ type coreStats struct {
 	statsRxRecently      int
 	statsRxMax           int
 	statsRxTotal         int
+	batchesTotal         int
 }
 
 type core struct {
-	logger         *log.Logger
-	state          *exchange.InnerState
-	once           sync.Once
-	statsDepth     int
-	statsSpan      time.Duration
-	exportTmplFile string
-	tstampDelta    time.Duration
-	metricTemplate MetricTemplate
-	stats          coreStats
+	logger               *log.Logger
+	logFile              *util.RotatingFile
+	state                *exchange.InnerState
+	once                 sync.Once
+	// startErr tells why the instance failed to start; it's returned by
+	//every publish then, instead of starting over
+	startErr             error
+	hooks                pipelineHooks
+	statsDepth           int
+	statsSpan            time.Duration
+	retentionOverrides   []retentionOverride
+	retention            string
+	exportTmplFile       string
+	// templateLocation is the configured location of the template, while
+	//exportTmplFile is the one of the template in use
+	templateLocation string
+	tstampDelta          time.Duration
+	tstampSource         string
+	metricTemplate       MetricTemplate
+	schema               map[string]interface{}
+	templateLoaded       bool
+	templateFallback     bool
+	templateFetcher      *templateFetcher
+	watchdog             *watchdog
+	idleTimeout          time.Duration
+	idleStatsDepth       int
+	processingWorkers    int
+	identityStitching    bool
+	identities           map[string]containerIdentity
+	resolvers            []Resolver
+	disabledGroups       map[string]bool
+	pruneDefaults        bool
+	sourcePriorities     []sourcePriority
+	validateOutputs      bool
+	stats                coreStats
+	dirty                map[string]bool
+	wal                  *writeAheadLog
+	removalExportDir     string
+	stateDumpDir         string
+	sinks                *sinkDispatcher
+	templateModTime      time.Time
+	unmappedAsCustom     bool
+	tombstoneTTL         time.Duration
+	dirtyPods            map[string]bool
+	podTags              map[string]map[string]string
+	podAggregation       bool
+	podMemberTimeout     time.Duration
+	newContainerHooks    []func(path string)
+	// discoverNodes finds publishers of other nodes for proxy mode, if
+	//discovery is enabled
+	discoverNodes func() (map[string]string, error)
+	statsBucket          time.Duration
+	batchSummary         io.Writer
+	watermark            *memoryWatermark
+	persister            *statePersister
+	memoryBudget         *memoryBudget
+	containerQuotas      []containerQuota
+	lastSeen             map[string]time.Time
+	containerTTL         time.Duration
+	rateSamples          map[string]map[string]rateSample
+	downsampleTiers      []downsampleTier
+	tierBuckets          map[string][]*tierBucket
+	statsSources         map[string]*statsSources
+	sourceTag            string
+	config               ConfigMap
+	// server serves the state, once the publisher is initialized
+	server *server.Instance
+	// stopped is closed on shutdown, ending background work
+	stopped         chan struct{}
+	stopOnce        sync.Once
+	shutdownTimeout time.Duration
+	// debugSnapshot holds statistics reported without taking the state
+	//lock
+	debugSnapshot atomic.Value
+}
+
+type sourcePriority struct {
+	prefix   string
+	priority int
 }
 
 type ConfigMap map[string]ctypes.ConfigValue
@@ -110,12 +370,22 @@ func NewInnerState() *exchange.InnerState {
 		DockerPaths:   map[string]string{},
 		DockerStorage: map[string]interface{}{},
 		PendingMetrics:map[string]map[string][]cadv.MetricVal {},
+		StatsIndex:    map[string]exchange.StatsIndex{},
+		Tombstones:    map[string]exchange.Tombstone{},
+		PodStorage:    map[string]interface{}{},
+		Downsampled:   map[string]map[string][]interface{}{},
+		Feed:          exchange.NewStatsFeed(),
+		Sources:       exchange.NewSourceStats(),
+		Readiness:     exchange.NewStatusBoard(),
+		Health:        exchange.NewStatusBoard(),
+		Activity:      exchange.NewConsumerActivity(),
+		Events:        exchange.NewEventLog(defEventLogSize),
+		StatsHistory:  exchange.NewStatsHistory(statsHistorySize),
 	}
 	return res
 }
 
 func NewCore() (*core, error) {
-	log.SetOutput(os.Stderr)
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Fprintf(os.Stderr, "Defeated by errors in Init: %s, %#v", r, r)
@@ -124,11 +394,22 @@ func NewCore() (*core, error) {
 	}()
 	logger := log.New()
 	core := core{
-		state:      NewInnerState(),
-		logger:     logger,
-		statsDepth: defStatsDepth,
-		statsSpan:  defStatsSpan,
-		stats:      coreStats{},
+		state:           NewInnerState(),
+		logger:          logger,
+		statsDepth:      defStatsDepth,
+		statsSpan:       defStatsSpan,
+		stats:           coreStats{},
+		identities:      map[string]containerIdentity{},
+		dirty:           map[string]bool{},
+		dirtyPods:       map[string]bool{},
+		podTags:         map[string]map[string]string{},
+		lastSeen:        map[string]time.Time{},
+		rateSamples:     map[string]map[string]rateSample{},
+		tierBuckets:     map[string][]*tierBucket{},
+		statsSources:    map[string]*statsSources{},
+		templateFetcher: newTemplateFetcher("", ""),
+		stopped:         make(chan struct{}),
+		hooks:           registeredHooks(),
 	}
 	return &core, nil
 }
@@ -143,36 +424,65 @@ func (f *core) Publish(contentType string, content []byte, config map[string]cty
 	}()
         initErr := f.ensureInitialized(config)
         if initErr != nil {
-             f.logger.Printf("Server not initialized, error=%v\n", initErr)
+             f.logger.WithError(initErr).Error("Server not initialized")
+             return initErr
         }
-	var metrics []plugin.MetricType
+	if f.watchdog != nil {
+		f.watchdog.notePublish()
+	}
+	var metrics []Metric
 
 	switch contentType {
 	case plugin.SnapGOBContentType:
-		dec := gob.NewDecoder(bytes.NewBuffer(content))
-		if err := dec.Decode(&metrics); err != nil {
-			f.logger.Printf("Error decoding: error=%v content=%v", err, content)
+		var err error
+		if metrics, err = f.decodeGobMetrics(content); err != nil {
+			f.logger.WithFields(log.Fields{"content_type": contentType, "size": len(content)}).WithError(err).Error("Couldn't decode metrics")
+			return err
+		}
+	case plugin.SnapJSONContentType:
+		var err error
+		if metrics, err = decodeJsonMetrics(content); err != nil {
+			f.logger.WithFields(log.Fields{"content_type": contentType, "size": len(content)}).WithError(err).Error("Couldn't decode metrics")
 			return err
 		}
 	default:
-		f.logger.Printf("Error unknown content type '%v'", contentType)
+		f.logger.WithField("content_type", contentType).Error("Unknown content type")
 		return errors.New(fmt.Sprintf("Unknown content type '%s'", contentType))
 	}
+	f.selectTimestamps(metrics, time.Now())
 	f.state.Lock()
 	defer f.state.Unlock()
+	if !f.templateLoaded {
+		f.logger.WithField("metrics", len(metrics)).Warn("Metric template not loaded yet, dropping metrics")
+		return nil
+	}
+	started := time.Now()
 	f.processMetrics(metrics)
+	f.publishReadModel()
+	f.logger.WithFields(log.Fields{
+		"metrics":    len(metrics),
+		"containers": f.stats.containersRxRecently,
+		"duration":   time.Since(started).String(),
+	}).Debug("Processed batch")
 	return nil
 }
 
 func Meta() *plugin.PluginMeta {
-	return plugin.NewPluginMeta(
+	meta := plugin.NewPluginMeta(
 		name, version, pluginType,
-		[]string{plugin.SnapGOBContentType},
-		[]string{plugin.SnapGOBContentType},
-                plugin.Exclusive(true))
+		[]string{plugin.SnapGOBContentType, plugin.SnapJSONContentType},
+		[]string{plugin.SnapGOBContentType})
+	applyMetaSettings(meta)
+	return meta
 }
 
 func (f *core) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
+	return configPolicy()
+}
+
+// configPolicy describes options of the publisher, shared by all its
+//instances
+func configPolicy() (*cpolicy.ConfigPolicy, error) {
 	cp := cpolicy.New()
 	p := cpolicy.NewPolicyNode()
 	rule1, _ := cpolicy.NewIntegerRule(cfgServerPort, false, defServerPort)
@@ -180,59 +490,466 @@ func (f *core) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
 	rule3, _ := cpolicy.NewStringRule(cfgStatsSpan, false, defStatsSpanStr)
 	rule4, _ := cpolicy.NewStringRule(cfgExportTmplFile, false, defExportTmplFile)
 	rule5, _ := cpolicy.NewStringRule(cfgTstampDelta, false, defTstampDeltaStr)
-	p.Add(rule1, rule2, rule3, rule4, rule5)
+	rule6, _ := cpolicy.NewStringRule(cfgProxyNodes, false, defProxyNodes)
+	rule7, _ := cpolicy.NewStringRule(cfgProxyCacheTTL, false, defProxyCacheTTLStr)
+	rule8, _ := cpolicy.NewStringRule(cfgTmplAuthHeader, false, defTmplAuthHeader)
+	rule9, _ := cpolicy.NewStringRule(cfgAdminServerAddr, false, defAdminServerAddr)
+	rule10, _ := cpolicy.NewIntegerRule(cfgAdminServerPort, false, defAdminServerPort)
+	rule11, _ := cpolicy.NewStringRule(cfgWatchdogInterval, false, defWatchdogInterval)
+	rule12, _ := cpolicy.NewIntegerRule(cfgWatchdogMissed, false, defWatchdogMissed)
+	rule12.SetMinimum(configMinimums[cfgWatchdogMissed])
+	rule13, _ := cpolicy.NewStringRule(cfgWatchdogWebhook, false, defWatchdogWebhook)
+	rule14, _ := cpolicy.NewStringRule(cfgIdleTimeout, false, defIdleTimeout)
+	rule15, _ := cpolicy.NewIntegerRule(cfgIdleStatsDepth, false, defIdleStatsDepth)
+	rule16, _ := cpolicy.NewBoolRule(cfgIdentityStitch, false, defIdentityStitch)
+	rule17, _ := cpolicy.NewStringRule(cfgResolvers, false, defResolvers)
+	rule18, _ := cpolicy.NewStringRule(cfgResolverRegex, false, defResolverRegex)
+	rule19, _ := cpolicy.NewStringRule(cfgDisableGroups, false, defDisableGroups)
+	rule20, _ := cpolicy.NewBoolRule(cfgPruneDefaults, false, defPruneDefaults)
+	rule21, _ := cpolicy.NewStringRule(cfgSourcePriorities, false, defSourcePriorities)
+	rule22, _ := cpolicy.NewBoolRule(cfgValidateOutput, false, defValidateOutput)
+	rule23, _ := cpolicy.NewStringRule(cfgStateSeedFile, false, defStateSeedFile)
+	rule24, _ := cpolicy.NewStringRule(cfgGobTypes, false, defGobTypes)
+	rule25, _ := cpolicy.NewStringRule(cfgStateStore, false, defStateStore)
+	rule26, _ := cpolicy.NewStringRule(cfgRemovalExportDir, false, defRemovalExportDir)
+	rule27, _ := cpolicy.NewStringRule(cfgPushSinkUrl, false, defPushSinkUrl)
+	rule28, _ := cpolicy.NewStringRule(cfgPushTimeout, false, defPushTimeoutStr)
+	rule29, _ := cpolicy.NewBoolRule(cfgCaptureNew, false, defCaptureNew)
+	rule30, _ := cpolicy.NewStringRule(cfgTmplReload, false, defTmplReload)
+	rule31, _ := cpolicy.NewStringRule(cfgAuthToken, false, defAuthToken)
+	rule32, _ := cpolicy.NewStringRule(cfgAuthBasic, false, defAuthBasic)
+	rule33, _ := cpolicy.NewBoolRule(cfgUnmappedCustom, false, defUnmappedCustom)
+	rule34, _ := cpolicy.NewStringRule(cfgTombstoneTTL, false, defTombstoneTTLStr)
+	rule35, _ := cpolicy.NewStringRule(cfgDockerPrefixes, false, defDockerPrefixes)
+	rule36, _ := cpolicy.NewBoolRule(cfgPodAggregation, false, defPodAggregation)
+	rule37, _ := cpolicy.NewStringRule(cfgKubeApi, false, defKubeApi)
+	rule38, _ := cpolicy.NewStringRule(cfgKubeNode, false, defKubeNode)
+	rule39, _ := cpolicy.NewStringRule(cfgKubeRefresh, false, defKubeRefreshStr)
+	rule40, _ := cpolicy.NewStringRule(cfgStatsBucket, false, defStatsBucket)
+	rule41, _ := cpolicy.NewStringRule(cfgBatchSummary, false, defBatchSummary)
+	rule42, _ := cpolicy.NewStringRule(cfgPushInterval, false, defPushInterval)
+	rule43, _ := cpolicy.NewIntegerRule(cfgPushBatchSize, false, defPushBatchSize)
+	rule44, _ := cpolicy.NewIntegerRule(cfgMemWatermark, false, defMemWatermark)
+	rule45, _ := cpolicy.NewStringRule(cfgMemCheckInterval, false, defMemCheckInterval)
+	rule46, _ := cpolicy.NewIntegerRule(cfgGrpcPort, false, defGrpcPort)
+	rule47, _ := cpolicy.NewStringRule(cfgStateDir, false, defStateDir)
+	rule48, _ := cpolicy.NewStringRule(cfgStateSnapshot, false, defStateSnapshotStr)
+	rule49, _ := cpolicy.NewIntegerRule(cfgMaxMemory, false, defMaxMemory)
+	rule50, _ := cpolicy.NewStringRule(cfgContainerTTL, false, defContainerTTL)
+	rule51, _ := cpolicy.NewStringRule(cfgSourceTag, false, defSourceTag)
+	rule52, _ := cpolicy.NewStringRule(cfgTstampSource, false, defTstampSource)
+	rule53, _ := cpolicy.NewStringRule(cfgDownsampleTiers, false, defDownsampleTiers)
+	rule54, _ := cpolicy.NewIntegerRule(cfgPortFallback, false, defPortFallback)
+	rule55, _ := cpolicy.NewBoolRule(cfgCompression, false, defCompression)
+	rule56, _ := cpolicy.NewIntegerRule(cfgMaxResponse, false, defMaxResponse)
+	rule57, _ := cpolicy.NewBoolRule(cfgDebugPprof, false, defDebugPprof)
+	rule58, _ := cpolicy.NewStringRule(cfgRetention, false, defRetention)
+	rule59, _ := cpolicy.NewIntegerRule(cfgNamespaceQuota, false, defNamespaceQuota)
+	rule60, _ := cpolicy.NewIntegerRule(cfgPrefixQuota, false, defPrefixQuota)
+	rule61, _ := cpolicy.NewStringRule(cfgLogLevel, false, defLogLevel)
+	rule62, _ := cpolicy.NewStringRule(cfgLogFormat, false, defLogFormat)
+	rule63, _ := cpolicy.NewBoolRule(cfgTmplFallback, false, defTmplFallback)
+	rule64, _ := cpolicy.NewStringRule(cfgLogFile, false, defLogFile)
+	rule65, _ := cpolicy.NewIntegerRule(cfgLogMaxSize, false, defLogMaxSize)
+	rule66, _ := cpolicy.NewIntegerRule(cfgLogMaxBackups, false, defLogMaxBackups)
+	rule67, _ := cpolicy.NewStringRule(cfgShutdownTimeout, false, defShutdownTimeout)
+	rule68, _ := cpolicy.NewStringRule(cfgPortFile, false, defPortFile)
+	rule69, _ := cpolicy.NewStringRule(cfgRegisterUrl, false, defRegisterUrl)
+	rule70, _ := cpolicy.NewIntegerRule(cfgProcWorkers, false, defProcWorkers)
+	rule71, _ := cpolicy.NewStringRule(cfgRetOverrides, false, defRetOverrides)
+	rule72, _ := cpolicy.NewStringRule(cfgJanitorInterval, false, defJanitorInterval)
+	rule73, _ := cpolicy.NewStringRule(cfgStateDumpDir, false, defStateDumpDir)
+	rule74, _ := cpolicy.NewStringRule(cfgBootstrapFile, false, defBootstrapFile)
+	rule75, _ := cpolicy.NewStringRule(cfgInfluxUrl, false, defInfluxUrl)
+	rule76, _ := cpolicy.NewStringRule(cfgInfluxDatabase, false, defInfluxDatabase)
+	rule77, _ := cpolicy.NewStringRule(cfgInfluxRetention, false, defInfluxRetention)
+	rule78, _ := cpolicy.NewIntegerRule(cfgInfluxBatchSize, false, defInfluxBatchSize)
+	rule79, _ := cpolicy.NewStringRule(cfgProxyDiscovery, false, defProxyDiscovery)
+	rule80, _ := cpolicy.NewIntegerRule(cfgProxyDiscPort, false, defProxyDiscPort)
+	rule81, _ := cpolicy.NewStringRule(cfgDockerEndpoint, false, defDockerEndpoint)
+	rule82, _ := cpolicy.NewStringRule(cfgDockerRefresh, false, defDockerRefreshStr)
+	rule83, _ := cpolicy.NewStringRule(cfgPodMemberTimeout, false, defPodMemberTimeout)
+	rule84, _ := cpolicy.NewBoolRule(cfgMemReleaseOS, false, defMemReleaseOS)
+	rule85, _ := cpolicy.NewStringRule(cfgStreamOrigins, false, defStreamOrigins)
+	rule86, _ := cpolicy.NewStringRule(cfgInfluxUsername, false, defInfluxUsername)
+	rule87, _ := cpolicy.NewStringRule(cfgInfluxPassword, false, defInfluxPassword)
+	rule88, _ := cpolicy.NewStringRule(cfgTaskName, false, defTaskName)
+	p.Add(rule1, rule2, rule3, rule4, rule5, rule6, rule7, rule8, rule9, rule10,
+		rule11, rule12, rule13, rule14, rule15, rule16, rule17, rule18, rule19, rule20,
+		rule21, rule22, rule23, rule24, rule25, rule26, rule27, rule28, rule29, rule30,
+		rule31, rule32, rule33, rule34, rule35, rule36, rule37, rule38, rule39, rule40,
+		rule41, rule42, rule43, rule44, rule45, rule46, rule47, rule48, rule49, rule50,
+		rule51, rule52, rule53, rule54, rule55, rule56, rule57, rule58, rule59, rule60,
+		rule61, rule62, rule63, rule64, rule65, rule66, rule67, rule68, rule69, rule70,
+		rule71, rule72, rule73, rule74, rule75, rule76, rule77, rule78, rule79, rule80,
+		rule81, rule82, rule83, rule84, rule85, rule86, rule87, rule88)
 	cp.Add([]string{}, p)
 	return cp, nil
 }
 
+// GetInt reads integer option, converting values of other types if
+//possible; defValue is returned for missing or invalid option (reported
+//by Validate)
 func (m ConfigMap) GetInt(key string, defValue int) int {
 	if value, gotIt := m[key]; gotIt {
-		return value.(ctypes.ConfigValueInt).Value
-	} else {
-		return defValue
+		if res, err := coerceInt(value); err == nil {
+			return res
+		}
 	}
+	return defValue
+}
+
+func (m ConfigMap) GetBool(key string, defValue bool) bool {
+	if value, gotIt := m[key]; gotIt {
+		if res, err := coerceBool(value); err == nil {
+			return res
+		}
+	}
+	return defValue
 }
 
 func (m ConfigMap) GetStr(key string, defValue string) string {
 	if value, gotIt := m[key]; gotIt {
-		return value.(ctypes.ConfigValueStr).Value
-	} else {
-		return defValue
+		if res, err := coerceStr(value); err == nil {
+			return res
+		}
 	}
+	return defValue
 }
 
 func (f *core) ensureInitialized(config map[string]ctypes.ConfigValue) error {
 	configMap := ConfigMap(config)
-        var serr error
+	if err := configMap.Validate(); err != nil {
+		return err
+	}
+	retention, err := parseRetention(configMap)
+	if err != nil {
+		return err
+	}
+	logSettings, err := parseLogSettings(configMap)
+	if err != nil {
+		return err
+	}
 	f.once.Do(func() {
 		defer func() {
 			if r := recover(); r != nil {
 				f.logger.Errorf("Caught an error: %s", r)
+				f.startErr = fmt.Errorf("publisher not started: %v", r)
 			}
 		}()
-		f.statsDepth = configMap.GetInt(cfgStatsDepth, defStatsDepth)
+		f.config = configMap
+		f.applyLogSettings(logSettings)
+		f.applyRetention(configMap, retention)
 		serverPort := configMap.GetInt(cfgServerPort, defServerPort)
 		serverAddr := configMap.GetStr(cfgServerAddr, defServerAddr)
-		statsSpanStr := configMap.GetStr(cfgStatsSpan, defStatsSpanStr)
-		if statsSpan, err := time.ParseDuration(statsSpanStr); err != nil {
-			f.statsSpan = defStatsSpan
+		if resolvers, err := buildResolvers(configMap); err != nil {
+			f.logger.Errorf("couldn't set up resolvers, falling back to defaults: %s", err)
+			f.state.Events.Record(exchange.SeverityError, "config", err.Error())
+			f.resolvers, _ = buildResolvers(ConfigMap{})
 		} else {
-			f.statsSpan = statsSpan
+			f.resolvers = resolvers
+		}
+		registerGobTypes(configMap.GetStr(cfgGobTypes, defGobTypes))
+		f.unmappedAsCustom = configMap.GetBool(cfgUnmappedCustom, defUnmappedCustom)
+		f.podAggregation = configMap.GetBool(cfgPodAggregation, defPodAggregation)
+		if podMemberTimeout, err := configMap.GetDuration(cfgPodMemberTimeout, defPodMemberTimeout); err == nil {
+			f.podMemberTimeout = podMemberTimeout
 		}
+		f.pruneDefaults = configMap.GetBool(cfgPruneDefaults, defPruneDefaults)
+		f.validateOutputs = configMap.GetBool(cfgValidateOutput, defValidateOutput)
+		f.batchSummary = batchSummaryOutput(configMap.GetStr(cfgBatchSummary, defBatchSummary))
+		f.sourcePriorities = parseSourcePriorities(configMap.GetStr(cfgSourcePriorities, defSourcePriorities))
+		f.disabledGroups = parseDisabledGroups(configMap.GetStr(cfgDisableGroups, defDisableGroups))
 		f.exportTmplFile = configMap.GetStr(cfgExportTmplFile, defExportTmplFile)
-		if err := f.loadMetricTemplate(); err != nil {
-			f.logger.Fatalf("couldn't load metric template: %s", err)
+		f.templateLocation = f.exportTmplFile
+		f.templateFallback = configMap.GetBool(cfgTmplFallback, defTmplFallback)
+		if shutdownTimeout, err := configMap.GetDuration(cfgShutdownTimeout, defShutdownTimeout); err == nil {
+			f.shutdownTimeout = shutdownTimeout
+		}
+		f.templateFetcher = newTemplateFetcher(configMap.GetStr(cfgTmplAuthHeader, defTmplAuthHeader), f.exportTmplFile)
+		f.ensureTemplateLoaded()
+		if reloadInterval, err := configMap.GetDuration(cfgTmplReload, defTmplReload); err == nil && reloadInterval > 0 && configMap.GetStr(cfgExportTmplFile, defExportTmplFile) != defExportTmplFile {
+			go f.watchTemplate(reloadInterval)
+		}
+		if maxMemoryMb := configMap.GetInt(cfgMaxMemory, defMaxMemory); maxMemoryMb > 0 {
+			f.memoryBudget = newMemoryBudget(maxMemoryMb)
+		}
+		if limit := configMap.GetInt(cfgNamespaceQuota, defNamespaceQuota); limit > 0 {
+			f.containerQuotas = append(f.containerQuotas, containerQuota{name: "namespace", limit: limit, group: namespaceGroup})
+		}
+		if limit := configMap.GetInt(cfgPrefixQuota, defPrefixQuota); limit > 0 {
+			f.containerQuotas = append(f.containerQuotas, containerQuota{name: "prefix", limit: limit, group: prefixGroup})
+		}
+		if seedPath := configMap.GetStr(cfgStateSeedFile, defStateSeedFile); seedPath != "" {
+			if seedFile, err := f.loadStateSeed(seedPath); err != nil {
+				f.logger.Errorf("couldn't load state seed: %s", err)
+				f.state.Events.Record(exchange.SeverityError, "state_seed", err.Error())
+			} else {
+				f.state.Events.Record(exchange.SeverityInfo, "state_seed", "loaded state seed from "+seedFile)
+			}
+		}
+		if bootstrapFile := configMap.GetStr(cfgBootstrapFile, defBootstrapFile); bootstrapFile != "" {
+			if dumpFile, err := f.loadStateSeed(bootstrapFile); err != nil {
+				f.logger.Errorf("couldn't bootstrap state: %s", err)
+				f.state.Events.Record(exchange.SeverityError, "state_bootstrap", err.Error())
+			} else {
+				f.state.Events.Record(exchange.SeverityInfo, "state_bootstrap", "loaded state dump "+dumpFile)
+			}
+		}
+		if stateDir := configMap.GetStr(cfgStateDir, defStateDir); stateDir != "" {
+			snapshotInterval, err := configMap.GetDuration(cfgStateSnapshot, defStateSnapshotStr)
+			if err != nil || snapshotInterval <= 0 {
+				snapshotInterval = defStateSnapshot
+			}
+			f.startStatePersistence(stateDir, configMap.GetStr(cfgStateStore, defStateStore), snapshotInterval)
+		}
+		f.setupSubsystems(configMap)
+		if tombstoneTTL, err := configMap.GetDuration(cfgTombstoneTTL, defTombstoneTTLStr); err == nil {
+			f.tombstoneTTL = tombstoneTTL
+		} else {
+			f.tombstoneTTL = defTombstoneTTL
+		}
+		f.removalExportDir = configMap.GetStr(cfgRemovalExportDir, defRemovalExportDir)
+		f.stateDumpDir = configMap.GetStr(cfgStateDumpDir, defStateDumpDir)
+		f.sourceTag = configMap.GetStr(cfgSourceTag, defSourceTag)
+		if containerTTL, _ := configMap.GetDuration(cfgContainerTTL, defContainerTTL); containerTTL > 0 {
+			f.containerTTL = containerTTL
+			go f.runContainerGc()
 		}
-		tstampDeltaStr := configMap.GetStr(cfgTstampDelta, defTstampDeltaStr)
-		tstampDelta, err := time.ParseDuration(tstampDeltaStr)
+		if janitorInterval, err := configMap.GetDuration(cfgJanitorInterval, defJanitorInterval); err == nil && janitorInterval > 0 {
+			go f.runJanitor(janitorInterval)
+		}
+		go f.sampleStatsHistory(statsHistoryInterval)
+		tstampDelta, err := configMap.GetDuration(cfgTstampDelta, defTstampDeltaStr)
 		if err != nil {
 			f.tstampDelta = defTstampDelta
 		} else {
 			f.tstampDelta = tstampDelta
 		}
-		serr = server.EnsureStarted(f.state, serverAddr, serverPort)
+		f.tstampSource = parseTstampSource(configMap.GetStr(cfgTstampSource, defTstampSource))
+		if f.retention != retentionLatestOnly {
+			f.downsampleTiers = parseDownsampleTiers(configMap.GetStr(cfgDownsampleTiers, defDownsampleTiers))
+			for _, tier := range f.downsampleTiers {
+				f.state.Resolutions = append(f.state.Resolutions, tier.resolution.String())
+			}
+		}
+		if statsBucket, err := configMap.GetDuration(cfgStatsBucket, defStatsBucket); err == nil {
+			f.statsBucket = statsBucket
+		}
+		if watchdogInterval, err := configMap.GetDuration(cfgWatchdogInterval, defWatchdogInterval); err == nil && watchdogInterval > 0 {
+			f.watchdog = newWatchdog(f, watchdogInterval,
+				configMap.GetInt(cfgWatchdogMissed, defWatchdogMissed),
+				configMap.GetStr(cfgWatchdogWebhook, defWatchdogWebhook))
+			go f.watchdog.run()
+		}
+		if idleTimeout, err := configMap.GetDuration(cfgIdleTimeout, defIdleTimeout); err == nil && idleTimeout > 0 {
+			f.idleTimeout = idleTimeout
+			f.state.Activity.OnWake(idleTimeout, f.wakeUp)
+		}
+		f.idleStatsDepth = configMap.GetInt(cfgIdleStatsDepth, defIdleStatsDepth)
+		f.processingWorkers = parseProcessingWorkers(configMap.GetInt(cfgProcWorkers, defProcWorkers))
+		if watermarkMb := configMap.GetInt(cfgMemWatermark, defMemWatermark); watermarkMb > 0 {
+			checkInterval, err := configMap.GetDuration(cfgMemCheckInterval, defMemCheckInterval)
+			if err != nil || checkInterval <= 0 {
+				checkInterval, _ = time.ParseDuration(defMemCheckInterval)
+			}
+			f.watermark = newMemoryWatermark(f, watermarkMb, checkInterval, configMap.GetBool(cfgMemReleaseOS, defMemReleaseOS))
+			go f.watermark.run()
+		}
+		f.identityStitching = configMap.GetBool(cfgIdentityStitch, defIdentityStitch)
+		serverConfig := server.Config{
+			Logger:          f.logger,
+			Addr:            serverAddr,
+			Port:            serverPort,
+			ProxyNodes:      parseProxyNodes(configMap.GetStr(cfgProxyNodes, defProxyNodes)),
+			ProxyCacheTTL:   defProxyCacheTTL,
+			AdminAddr:       configMap.GetStr(cfgAdminServerAddr, defAdminServerAddr),
+			AdminPort:       configMap.GetInt(cfgAdminServerPort, defAdminServerPort),
+			AuthToken:       configMap.GetStr(cfgAuthToken, defAuthToken),
+			GrpcPort:        configMap.GetInt(cfgGrpcPort, defGrpcPort),
+			LoadTemplate:    f.ReloadMetricTemplate,
+			PortFallback:    configMap.GetInt(cfgPortFallback, defPortFallback),
+			Compression:     configMap.GetBool(cfgCompression, defCompression),
+			MaxResponseSize: configMap.GetInt(cfgMaxResponse, defMaxResponse) * 1024,
+			DebugStats:      f.DebugStats,
+			Pprof:           configMap.GetBool(cfgDebugPprof, defDebugPprof),
+			PortFile:        configMap.GetStr(cfgPortFile, defPortFile),
+			RegisterUrl:     configMap.GetStr(cfgRegisterUrl, defRegisterUrl),
+			StreamOrigins:   parseStreamOrigins(configMap.GetStr(cfgStreamOrigins, defStreamOrigins)),
+		}
+		if f.stateDumpDir != "" {
+			serverConfig.DumpState = f.DumpState
+		}
+		if authBasic := configMap.GetStr(cfgAuthBasic, defAuthBasic); authBasic != "" {
+			if kv := strings.SplitN(authBasic, ":", 2); len(kv) == 2 {
+				serverConfig.AuthUser, serverConfig.AuthPassword = kv[0], kv[1]
+			} else {
+				f.logger.Errorf("Invalid basic-auth credentials, expected 'user:password'")
+			}
+		}
+		if proxyCacheTTL, err := configMap.GetDuration(cfgProxyCacheTTL, defProxyCacheTTLStr); err == nil {
+			serverConfig.ProxyCacheTTL = proxyCacheTTL
+		}
+		if f.discoverNodes != nil {
+			serverConfig.DiscoverNodes = f.discoverNodes
+			serverConfig.DiscoveryInterval = defKubeRefresh
+			if kubeRefresh, err := configMap.GetDuration(cfgKubeRefresh, defKubeRefreshStr); err == nil && kubeRefresh > 0 {
+				serverConfig.DiscoveryInterval = kubeRefresh
+			}
+		}
+		f.server, f.startErr = server.Start(f.state, serverConfig)
+	})
+	return f.startErr
+}
+
+// isIdle tells if no consumer requested data for longer than idle timeout;
+//publisher reduces its work while idle
+func (f *core) isIdle() bool {
+	return f.idleTimeout > 0 && f.state.Activity.IdleFor() > f.idleTimeout
+}
+
+// effectiveStatsDepth returns the limit for number of stats kept per
+//container, given its configured limit; it's shrunk while publisher is
+//idle and halved while heap is above the memory watermark
+func (f *core) effectiveStatsDepth(statsDepth int) int {
+	if f.isIdle() && f.idleStatsDepth > 0 && (statsDepth <= 0 || f.idleStatsDepth < statsDepth) {
+		statsDepth = f.idleStatsDepth
+	}
+	if f.watermark.underPressure() && statsDepth > 1 {
+		statsDepth /= 2
+	}
+	return statsDepth
+}
+
+// effectiveStatsSpan returns the time span of stats kept per container,
+//given its configured span, halved while heap is above the memory watermark
+func (f *core) effectiveStatsSpan(statsSpan time.Duration) time.Duration {
+	if f.watermark.underPressure() {
+		return statsSpan / 2
+	}
+	return statsSpan
+}
+
+// ensureTemplateLoaded loads the metric template, retrying in background
+//with exponential backoff if template source is not available yet;
+//meanwhile the builtin template serves core stats, if fallback is enabled.
+//Retrying stops as soon as the template gets loaded, also by reload
+func (f *core) ensureTemplateLoaded() {
+	const component = "template"
+	path := f.exportTmplFile
+	load := func() error {
+		if f.configuredTemplateLoaded() {
+			return nil
+		}
+		if err := f.reloadMetricTemplate(path); err != nil {
+			return err
+		}
+		f.state.Readiness.SetReady(component)
+		f.state.Events.Record(exchange.SeverityInfo, "template_load", "loaded metric template from "+path)
+		return nil
+	}
+	err := load()
+	if err == nil {
+		return
+	}
+	f.state.Events.Record(exchange.SeverityError, "template_load", err.Error())
+	fallenBack := f.templateFallback && path != defExportTmplFile && f.fallBackToBuiltinTemplate(err)
+	setStatus := func(err error) {
+		reason := err.Error()
+		if fallenBack {
+			reason = "using builtin template, " + path + " not loaded: " + reason
+		}
+		f.state.Readiness.SetDegraded(component, reason)
+	}
+	setStatus(err)
+	go util.RetryWithBackoff(templateRetryInitial, templateRetryMax, f.stopped, load, func(err error, delay time.Duration) {
+		setStatus(err)
+		f.logger.Warnf("couldn't load metric template, retrying in %v: %s", delay, err)
 	})
-        return serr
+}
+
+// configuredTemplateLoaded tells whether the template in use is the one
+//from the configured location, not the builtin one serving as fallback
+func (f *core) configuredTemplateLoaded() bool {
+	f.state.Lock()
+	defer f.state.Unlock()
+	return f.templateLoaded && f.exportTmplFile == f.templateLocation
+}
+
+// fallBackToBuiltinTemplate loads the builtin template in place of the one
+//which failed to load, so core cpu and memory stats are served meanwhile
+func (f *core) fallBackToBuiltinTemplate(cause error) bool {
+	f.state.Lock()
+	defer f.state.Unlock()
+	if err := f.swapMetricTemplate(defExportTmplFile); err != nil {
+		return false
+	}
+	f.publishReadModel()
+	f.logger.WithError(cause).Warn("Metric template not loaded, falling back to builtin template")
+	f.state.Events.Record(exchange.SeverityWarning, "template_load", "falling back to builtin template: "+cause.Error())
+	return true
+}
+
+// parseDisabledGroups parses comma-separated list of metric groups;
+//unknown groups are reported and ignored
+func parseDisabledGroups(groupsStr string) map[string]bool {
+	groups := map[string]bool{}
+	for _, group := range strings.Split(groupsStr, ",") {
+		group = strings.TrimSpace(group)
+		switch group {
+		case "":
+		case groupNetwork, groupFilesystem, groupCustomMetrics:
+			groups[group] = true
+		default:
+			log.Warnf("Unknown metric group '%s' ignored", group)
+		}
+	}
+	return groups
+}
+
+// parseSourcePriorities parses priority rules given in form of
+//"/intel/docker=10,/hyppo/docker=5"
+func parseSourcePriorities(rulesStr string) []sourcePriority {
+	rules := []sourcePriority{}
+	for _, item := range strings.Split(rulesStr, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		priority, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			log.Warnf("Invalid priority for source '%s' ignored: %v", kv[0], err)
+			continue
+		}
+		rules = append(rules, sourcePriority{prefix: strings.TrimSpace(kv[0]), priority: priority})
+	}
+	return rules
+}
+
+// parseStreamOrigins parses comma-separated list of origins allowed to
+//open stream connections
+func parseStreamOrigins(originsStr string) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(originsStr, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// parseProxyNodes parses list of nodes given in form of
+//"node1=http://host1:8777,node2=http://host2:8777"
+func parseProxyNodes(nodesStr string) map[string]string {
+	nodes := map[string]string{}
+	for _, item := range strings.Split(nodesStr, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		nodes[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return nodes
 }
 
 func init() {
@@ -0,0 +1,154 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// periodicPusher pushes stats gathered since the previous push to sinks
+//at fixed interval, for nodes consumers can't reach to pull the stats;
+//stats are taken for pushed once all sinks accepted them, so stats which
+//failed to be delivered are pushed again
+type periodicPusher struct {
+	core      *core
+	interval  time.Duration
+	batchSize int
+	lock      sync.Mutex
+	// lastPushed holds timestamp of the most recent stats delivered for
+	//each container
+	lastPushed map[string]time.Time
+	// pending holds timestamp of the most recent stats queued for delivery
+	//but not delivered yet, so they aren't queued again meanwhile
+	pending map[string]time.Time
+}
+
+func newPeriodicPusher(core *core, interval time.Duration, batchSize int) *periodicPusher {
+	return &periodicPusher{
+		core:       core,
+		interval:   interval,
+		batchSize:  batchSize,
+		lastPushed: map[string]time.Time{},
+		pending:    map[string]time.Time{},
+	}
+}
+
+func (p *periodicPusher) run() {
+	p.core.tick(p.interval, func(time.Time) {
+		p.pushNewStats()
+	})
+}
+
+// pushNewStats pushes containers having stats newer than the last pushed
+//ones, in batches of configured number of containers
+func (p *periodicPusher) pushNewStats() {
+	if p.core.isIdle() {
+		// paused while idle; stats retained meanwhile are pushed once
+		//publisher wakes up
+		return
+	}
+	model := p.core.state.ReadModel.Get()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	batch := map[string]interface{}{}
+	stamps := map[string]time.Time{}
+	for path, dockerObj := range model.DockerStorage {
+		dockerMap := dockerObj.(map[string]interface{})
+		since := p.lastPushed[path]
+		if pending, isPending := p.pending[path]; isPending && pending.After(since) {
+			since = pending
+		}
+		newStats := []interface{}{}
+		var newest time.Time
+		for _, statsObj := range dockerMap["stats"].([]interface{}) {
+			stamp, _ := util.ParseTime(statsObj.(map[string]interface{})["timestamp"].(string))
+			if !stamp.After(since) {
+				continue
+			}
+			newStats = append(newStats, statsObj)
+			if stamp.After(newest) {
+				newest = stamp
+			}
+		}
+		if len(newStats) == 0 {
+			continue
+		}
+		// read model is never modified, so the copy may share its objects
+		dockerCopy := make(map[string]interface{}, len(dockerMap))
+		for k, v := range dockerMap {
+			dockerCopy[k] = v
+		}
+		dockerCopy["stats"] = newStats
+		batch[path] = dockerCopy
+		stamps[path] = newest
+		if p.batchSize > 0 && len(batch) >= p.batchSize {
+			p.queueBatch(batch, stamps)
+			batch, stamps = map[string]interface{}{}, map[string]time.Time{}
+		}
+	}
+	if len(batch) > 0 {
+		p.queueBatch(batch, stamps)
+	}
+	for path := range p.lastPushed {
+		if _, known := model.DockerStorage[path]; !known {
+			delete(p.lastPushed, path)
+		}
+	}
+	for path := range p.pending {
+		if _, known := model.DockerStorage[path]; !known {
+			delete(p.pending, path)
+		}
+	}
+}
+
+// queueBatch hands batch over to sinks, noting its stats as pending until
+//sinks report the outcome; batch dropped by full queue is pushed again
+//next time. Must be called with the pusher locked
+func (p *periodicPusher) queueBatch(batch map[string]interface{}, stamps map[string]time.Time) {
+	queued := p.core.sinks.push(batch, func(delivered bool) {
+		p.settleBatch(stamps, delivered)
+	})
+	if !queued {
+		return
+	}
+	for path, stamp := range stamps {
+		p.pending[path] = stamp
+	}
+}
+
+// settleBatch advances containers of delivered batch past its stats; stats
+//of batch which failed are pushed again
+func (p *periodicPusher) settleBatch(stamps map[string]time.Time, delivered bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for path, stamp := range stamps {
+		if delivered && stamp.After(p.lastPushed[path]) {
+			p.lastPushed[path] = stamp
+		}
+		if pending, isPending := p.pending[path]; isPending && (!delivered || !pending.After(stamp)) {
+			delete(p.pending, path)
+		}
+	}
+}
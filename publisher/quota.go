@@ -0,0 +1,131 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// containerQuota limits number of containers tracked per group; groups
+//over limit lose their oldest containers first
+type containerQuota struct {
+	name  string
+	limit int
+	group func(name string, dockerMap map[string]interface{}) string
+}
+
+// namespaceGroup groups containers by kubernetes namespace, taken from
+//labels set by kubelet or filled in by enrichment; containers outside
+//of kubernetes aren't limited
+func namespaceGroup(name string, dockerMap map[string]interface{}) string {
+	labels, _ := dockerMap["labels"].(map[string]interface{})
+	namespace, _ := labels[labelPodNamespace].(string)
+	return namespace
+}
+
+// prefixGroup groups containers by their parent in cgroup hierarchy (e.g.
+//all containers of a pod); root container and its direct children
+//aren't limited
+func prefixGroup(name string, dockerMap map[string]interface{}) string {
+	if parent := path.Dir(name); parent != "/" {
+		return parent
+	}
+	return ""
+}
+
+// containerAge tells when container was created, falling back to its
+//oldest stats
+func containerAge(dockerMap map[string]interface{}) time.Time {
+	specMap, _ := dockerMap["spec"].(map[string]interface{})
+	if createdStr, _ := specMap[specCreationTime].(string); createdStr != "" {
+		if created, err := util.ParseTime(createdStr); err == nil {
+			return created
+		}
+	}
+	statsList, _ := dockerMap["stats"].([]interface{})
+	if len(statsList) == 0 {
+		return time.Time{}
+	}
+	stamp, _ := util.ParseTime(statsList[0].(map[string]interface{})["timestamp"].(string))
+	return stamp
+}
+
+type quotaCandidate struct {
+	path    string
+	seen    time.Time
+	created time.Time
+}
+
+// quotaCandidates order containers for eviction: those seen least recently
+//go first; of containers seen at the same time (i.e. in the same batch),
+//the newest go first, so a group full of reporting containers refuses
+//newcomers rather than evicting the containers it already tracks
+type quotaCandidates []quotaCandidate
+
+func (c quotaCandidates) Len() int {
+	return len(c)
+}
+
+func (c quotaCandidates) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c quotaCandidates) Less(i, j int) bool {
+	if !c[i].seen.Equal(c[j].seen) {
+		return c[i].seen.Before(c[j].seen)
+	}
+	return c[i].created.After(c[j].created)
+}
+
+// enforceContainerQuotas removes containers of groups tracking more
+//containers than their quota allows, the least recently seen first;
+//must be called with the state locked
+func (f *core) enforceContainerQuotas() {
+	for _, quota := range f.containerQuotas {
+		groups := map[string]quotaCandidates{}
+		for path, dockerObj := range f.state.DockerStorage {
+			dockerMap := dockerObj.(map[string]interface{})
+			if group := quota.group(path, dockerMap); group != "" {
+				groups[group] = append(groups[group], quotaCandidate{path: path, seen: f.lastSeenStamp(path, dockerMap), created: containerAge(dockerMap)})
+			}
+		}
+		for group, candidates := range groups {
+			if len(candidates) <= quota.limit {
+				continue
+			}
+			sort.Stable(candidates)
+			evicted := candidates[:len(candidates)-quota.limit]
+			for _, candidate := range evicted {
+				f.removeContainer(candidate.path, fmt.Sprintf("%s %s over quota of %d containers", quota.name, group, quota.limit))
+			}
+			f.logger.WithFields(log.Fields{quota.name: group, "quota": quota.limit, "evicted_containers": len(evicted)}).Warn("Container quota exceeded")
+			f.state.Events.Record(exchange.SeverityWarning, "container_quota",
+				fmt.Sprintf("%s %s over quota of %d containers, evicted %d least recently seen", quota.name, group, quota.limit, len(evicted)))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"testing"
+	"time"
+)
+
+func newQuotaTestCore(t *testing.T) *core {
+	f := newTestCore(t, map[string]map[string]interface{}{
+		"/p/a": testContainer("a", 1),
+		"/p/b": testContainer("b", 1),
+		"/p/c": testContainer("c", 1),
+	})
+	f.containerQuotas = []containerQuota{{name: "prefix", limit: 2, group: prefixGroup}}
+	for idx, path := range []string{"/p/a", "/p/b", "/p/c"} {
+		dockerMap := f.state.DockerStorage[path].(map[string]interface{})
+		created := testStart.Add(time.Duration(idx) * time.Hour)
+		dockerMap["spec"].(map[string]interface{})[specCreationTime] = created.Format(time.RFC3339)
+	}
+	return f
+}
+
+func TestQuotaRefusesNewcomerOfReportingGroup(t *testing.T) {
+	f := newQuotaTestCore(t)
+	now := time.Now()
+	for _, path := range []string{"/p/a", "/p/b", "/p/c"} {
+		f.lastSeen[path] = now
+	}
+	f.state.Lock()
+	f.enforceContainerQuotas()
+	f.state.Unlock()
+	if _, kept := f.state.DockerStorage["/p/c"]; kept {
+		t.Errorf("newest container kept over quota")
+	}
+	for _, path := range []string{"/p/a", "/p/b"} {
+		if _, kept := f.state.DockerStorage[path]; !kept {
+			t.Errorf("container %s already tracked was evicted", path)
+		}
+	}
+}
+
+func TestQuotaEvictsLeastRecentlySeen(t *testing.T) {
+	f := newQuotaTestCore(t)
+	now := time.Now()
+	f.lastSeen["/p/a"] = now
+	f.lastSeen["/p/b"] = now.Add(-time.Minute)
+	f.lastSeen["/p/c"] = now
+	f.state.Lock()
+	f.enforceContainerQuotas()
+	f.state.Unlock()
+	if _, kept := f.state.DockerStorage["/p/b"]; kept {
+		t.Errorf("container not seen recently kept over quota")
+	}
+	for _, path := range []string{"/p/a", "/p/c"} {
+		if _, kept := f.state.DockerStorage[path]; !kept {
+			t.Errorf("reporting container %s was evicted", path)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"strconv"
+	"time"
+)
+
+// rateSample is the previous sample of a cumulative metric a rate
+//is derived from
+type rateSample struct {
+	value     float64
+	timestamp time.Time
+}
+
+// specValue gives value to store for value spec: metric value itself or,
+//for specs flagged with `rate`, the rate per second of a cumulative metric
+//multiplied by the flag's value (e.g. `rate=1e-7` turns nanoseconds of cpu
+//time into percent of a core); rate is not available until a previous
+//sample of the metric is known
+func (f *processorContext) specValue(dockerPath, objKey string, spec map[string]string, metric *Metric) (interface{}, bool) {
+	rateStr, isRate := spec["rate"]
+	if !isRate {
+		return metric.Value, true
+	}
+	scale, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil {
+		scale = 1
+	}
+	value, isNumber := toFloat64(metric.Value)
+	if !isNumber {
+		return nil, false
+	}
+	samples, haveSamples := f.rateSamples[dockerPath]
+	if !haveSamples {
+		samples = map[string]rateSample{}
+		f.rateSamples[dockerPath] = samples
+	}
+	sampleKey := objKey + "\x00" + spec["target"]
+	prev, havePrev := samples[sampleKey]
+	if havePrev && !metric.Timestamp.After(prev.timestamp) {
+		// sample already seen or out of order
+		return nil, false
+	}
+	samples[sampleKey] = rateSample{value: value, timestamp: metric.Timestamp}
+	if !havePrev || value < prev.value {
+		// no previous sample or counter was reset
+		return nil, false
+	}
+	elapsed := metric.Timestamp.Sub(prev.timestamp).Seconds()
+	return (value - prev.value) / elapsed * scale, true
+}
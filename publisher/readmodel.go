@@ -0,0 +1,107 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// markDirty records that container object was modified and needs to be
+//copied into the next read model
+func (f *core) markDirty(path string) {
+	f.dirty[path] = true
+}
+
+// publishReadModel replaces the read model served to consumers with
+//a snapshot of current state; only containers modified since the last
+//snapshot are copied, the rest is shared with the previous read model.
+//Must be called with the state locked.
+func (f *core) publishReadModel() {
+	prev := f.state.ReadModel.Get()
+	f.enforceContainerQuotas()
+	f.enforceMemoryBudget()
+	f.dropExpiredTombstones()
+	if f.isIdle() && prev.Version > 0 {
+		// nobody reads the model while idle; containers stay marked dirty
+		//until the next request wakes publisher up
+		f.publishDebugSnapshot()
+		return
+	}
+	model := &exchange.ReadModel{
+		Version:       prev.Version + 1,
+		DockerStorage: make(map[string]interface{}, len(f.state.DockerStorage)),
+		StatsIndex:    make(map[string]exchange.StatsIndex, len(f.state.StatsIndex)),
+		Schema:        f.state.Schema,
+		Tombstones:    make(map[string]exchange.Tombstone, len(f.state.Tombstones)),
+		PodStorage:    make(map[string]interface{}, len(f.state.PodStorage)),
+		Downsampled:   make(map[string]map[string][]interface{}, len(f.state.Downsampled)),
+	}
+	if f.state.Machine != nil {
+		model.Machine = util.DeepCopy(f.state.Machine).(map[string]interface{})
+	}
+	for path, tombstone := range f.state.Tombstones {
+		model.Tombstones[path] = tombstone
+	}
+	for path, dockerObj := range f.state.DockerStorage {
+		if prevObj, havePrev := prev.DockerStorage[path]; havePrev && !f.dirty[path] {
+			model.DockerStorage[path] = prevObj
+			if index, haveIndex := prev.StatsIndex[path]; haveIndex {
+				model.StatsIndex[path] = index
+			}
+			continue
+		}
+		model.DockerStorage[path] = util.DeepCopy(dockerObj)
+		if index, haveIndex := f.state.StatsIndex[path]; haveIndex {
+			model.StatsIndex[path] = append(exchange.StatsIndex(nil), index...)
+		}
+	}
+	for path, tiers := range f.state.Downsampled {
+		if prevTiers, havePrev := prev.Downsampled[path]; havePrev && !f.dirty[path] {
+			model.Downsampled[path] = prevTiers
+			continue
+		}
+		// downsampled stats are never modified once appended
+		tiersCopy := make(map[string][]interface{}, len(tiers))
+		for resolution, statsList := range tiers {
+			tiersCopy[resolution] = append([]interface{}(nil), statsList...)
+		}
+		model.Downsampled[path] = tiersCopy
+	}
+	for podKey, podObj := range f.state.PodStorage {
+		if prevObj, havePrev := prev.PodStorage[podKey]; havePrev && !f.dirtyPods[podKey] {
+			model.PodStorage[podKey] = prevObj
+			continue
+		}
+		model.PodStorage[podKey] = util.DeepCopy(podObj)
+	}
+	f.dirty = map[string]bool{}
+	f.dirtyPods = map[string]bool{}
+	f.state.ReadModel.Publish(model)
+	f.publishDebugSnapshot()
+}
+
+// wakeUp publishes read model skipped while publisher was idle, so the
+//request waking it up is served current stats
+func (f *core) wakeUp() {
+	f.state.Lock()
+	defer f.state.Unlock()
+	f.publishReadModel()
+}
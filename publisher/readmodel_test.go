@@ -0,0 +1,184 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2016, 10, 16, 10, 0, 0, 0, time.UTC)
+
+func testStats(seq int) map[string]interface{} {
+	return map[string]interface{}{
+		"timestamp":      testStart.Add(time.Duration(seq) * time.Second).Format(time.RFC3339),
+		"memory":         map[string]interface{}{"usage": int64(seq)},
+		"custom_metrics": map[string]interface{}{},
+	}
+}
+
+func testContainer(id string, statsCount int) map[string]interface{} {
+	statsList := []interface{}{}
+	for seq := 0; seq < statsCount; seq++ {
+		statsList = append(statsList, testStats(seq))
+	}
+	return map[string]interface{}{
+		"id":    id,
+		"name":  "/" + id,
+		"spec":  map[string]interface{}{"custom_metrics": []interface{}{}},
+		"stats": statsList,
+	}
+}
+
+func newTestCore(t *testing.T, containers map[string]map[string]interface{}) *core {
+	f, err := NewCore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.restoreState(containers, "test"); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// appendTestStats merges next stats sample into container the way
+//processing does, publishing the read model afterwards
+func appendTestStats(f *core, path string) {
+	f.state.Lock()
+	defer f.state.Unlock()
+	dockerMap := f.state.DockerStorage[path].(map[string]interface{})
+	statsList := dockerMap["stats"].([]interface{})
+	dockerMap["stats"] = append(statsList, testStats(len(statsList)))
+	f.reindexStats(path, dockerMap)
+	f.markDirty(path)
+	f.publishReadModel()
+}
+
+func statsCount(dockerObj interface{}) int {
+	return len(dockerObj.(map[string]interface{})["stats"].([]interface{}))
+}
+
+func TestReadModelKeepsSnapshotAfterPublish(t *testing.T) {
+	f := newTestCore(t, map[string]map[string]interface{}{"/a": testContainer("a", 2)})
+	before := f.state.ReadModel.Get()
+	appendTestStats(f, "/a")
+	after := f.state.ReadModel.Get()
+	if after.Version <= before.Version {
+		t.Fatalf("version not advanced: %d -> %d", before.Version, after.Version)
+	}
+	if got := statsCount(before.DockerStorage["/a"]); got != 2 {
+		t.Errorf("earlier snapshot has %d stats, want 2", got)
+	}
+	if got := len(before.StatsIndex["/a"]); got != 2 {
+		t.Errorf("earlier snapshot has index of %d stats, want 2", got)
+	}
+	if got := statsCount(after.DockerStorage["/a"]); got != 3 {
+		t.Errorf("later snapshot has %d stats, want 3", got)
+	}
+}
+
+func TestReadModelIgnoresUnpublishedChanges(t *testing.T) {
+	f := newTestCore(t, map[string]map[string]interface{}{"/a": testContainer("a", 1)})
+	f.state.Lock()
+	dockerMap := f.state.DockerStorage["/a"].(map[string]interface{})
+	statsMap := dockerMap["stats"].([]interface{})[0].(map[string]interface{})
+	statsMap["memory"].(map[string]interface{})["usage"] = int64(100)
+	dockerMap["stats"] = append(dockerMap["stats"].([]interface{}), testStats(1))
+	f.state.Unlock()
+
+	model := f.state.ReadModel.Get()
+	if got := statsCount(model.DockerStorage["/a"]); got != 1 {
+		t.Errorf("snapshot has %d stats, want 1", got)
+	}
+	served := model.DockerStorage["/a"].(map[string]interface{})["stats"].([]interface{})[0].(map[string]interface{})
+	if usage := served["memory"].(map[string]interface{})["usage"]; usage != int64(0) {
+		t.Errorf("snapshot sees in-place change of stats: usage %v", usage)
+	}
+}
+
+func TestReadModelSharesCleanContainers(t *testing.T) {
+	f := newTestCore(t, map[string]map[string]interface{}{
+		"/a": testContainer("a", 1),
+		"/b": testContainer("b", 1),
+	})
+	before := f.state.ReadModel.Get()
+	appendTestStats(f, "/a")
+	after := f.state.ReadModel.Get()
+	if reflect.ValueOf(after.DockerStorage["/b"]).Pointer() != reflect.ValueOf(before.DockerStorage["/b"]).Pointer() {
+		t.Errorf("unchanged container copied into the next snapshot")
+	}
+	if reflect.ValueOf(after.DockerStorage["/a"]).Pointer() == reflect.ValueOf(before.DockerStorage["/a"]).Pointer() {
+		t.Errorf("changed container shared with the previous snapshot")
+	}
+}
+
+// TestReadModelConsistentUnderWrites checks that each snapshot taken while
+//stats keep arriving is internally consistent: every container holds
+//the number of stats published along with the snapshot's version
+func TestReadModelConsistentUnderWrites(t *testing.T) {
+	const rounds = 200
+	f := newTestCore(t, map[string]map[string]interface{}{
+		"/a": testContainer("a", 0),
+		"/b": testContainer("b", 0),
+	})
+	base := f.state.ReadModel.Get().Version
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for round := 0; round < rounds; round++ {
+			f.state.Lock()
+			for _, path := range []string{"/a", "/b"} {
+				dockerMap := f.state.DockerStorage[path].(map[string]interface{})
+				statsList := dockerMap["stats"].([]interface{})
+				dockerMap["stats"] = append(statsList, testStats(len(statsList)))
+				f.reindexStats(path, dockerMap)
+				f.markDirty(path)
+			}
+			f.publishReadModel()
+			f.state.Unlock()
+		}
+	}()
+	check := func() error {
+		model := f.state.ReadModel.Get()
+		want := int(model.Version - base)
+		for _, path := range []string{"/a", "/b"} {
+			if got := statsCount(model.DockerStorage[path]); got != want {
+				return fmt.Errorf("snapshot %d has %d stats of %s, want %d", model.Version, got, path, want)
+			}
+			if got := len(model.StatsIndex[path]); got != want {
+				return fmt.Errorf("snapshot %d has index of %d stats of %s, want %d", model.Version, got, path, want)
+			}
+		}
+		return nil
+	}
+	for round := 0; round < rounds; round++ {
+		if err := check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if err := check(); err != nil {
+		t.Fatal(err)
+	}
+}
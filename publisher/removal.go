@@ -0,0 +1,162 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// dropContainer removes container from publisher's state; must be called
+//with the state locked
+func (f *core) dropContainer(path string) {
+	if dockerObj, haveDocker := f.state.DockerStorage[path]; haveDocker {
+		f.retireIdentity(dockerObj.(map[string]interface{}))
+	}
+	delete(f.state.DockerStorage, path)
+	delete(f.state.DockerPaths, path)
+	delete(f.state.StatsIndex, path)
+	delete(f.state.PendingMetrics, path)
+	delete(f.dirty, path)
+	delete(f.podTags, path)
+	delete(f.lastSeen, path)
+	delete(f.rateSamples, path)
+	delete(f.tierBuckets, path)
+	delete(f.statsSources, path)
+	delete(f.state.Downsampled, path)
+	if f.wal != nil {
+		f.wal.forget(path)
+	}
+	if f.memoryBudget != nil {
+		f.memoryBudget.forget(path)
+	}
+}
+
+// removeContainer drops container which disappeared from the node,
+//exporting its retained history first if export is configured;
+//must be called with the state locked
+func (f *core) removeContainer(path, reason string) {
+	dockerObj, haveDocker := f.state.DockerStorage[path]
+	if !haveDocker {
+		return
+	}
+	f.dropContainer(path)
+	f.buryContainer(path, dockerObj.(map[string]interface{}), reason)
+	f.state.Events.Record(exchange.SeverityInfo, "container_removal",
+		fmt.Sprintf("removed container %s: %s", path, reason))
+	if f.removalExportDir != "" {
+		// container object is no longer reachable from the state, so it
+		//can be exported without holding the lock
+		go f.exportHistory(path, dockerObj.(map[string]interface{}))
+	}
+}
+
+// buryContainer leaves tombstone of removed container
+func (f *core) buryContainer(path string, dockerObj map[string]interface{}, reason string) {
+	if f.tombstoneTTL <= 0 {
+		return
+	}
+	tombstone := exchange.Tombstone{Name: path, RemovedAt: time.Now(), Reason: reason}
+	tombstone.Id, _ = dockerObj["id"].(string)
+	if statsList, _ := dockerObj["stats"].([]interface{}); len(statsList) > 0 {
+		lastStats := statsList[len(statsList)-1].(map[string]interface{})
+		tombstone.LastSeen, _ = util.ParseTime(lastStats["timestamp"].(string))
+	}
+	f.state.Tombstones[path] = tombstone
+}
+
+// dropExpiredTombstones removes tombstones older than configured period;
+//must be called with the state locked
+func (f *core) dropExpiredTombstones() {
+	for path, tombstone := range f.state.Tombstones {
+		if time.Since(tombstone.RemovedAt) > f.tombstoneTTL {
+			delete(f.state.Tombstones, path)
+		}
+	}
+	f.dropExpiredIdentities()
+}
+
+// containerGcInterval tells how often containers are checked for
+//staleness, given container TTL
+func containerGcInterval(ttl time.Duration) time.Duration {
+	interval := ttl / 4
+	if interval < time.Second {
+		return time.Second
+	}
+	if interval > time.Minute {
+		return time.Minute
+	}
+	return interval
+}
+
+func (f *core) runContainerGc() {
+	f.tick(containerGcInterval(f.containerTTL), func(now time.Time) {
+		f.state.Lock()
+		if f.collectStaleContainers(now) > 0 {
+			f.publishReadModel()
+		}
+		f.state.Unlock()
+	})
+}
+
+// collectStaleContainers removes containers which haven't reported any
+//metrics for longer than container TTL; containers not seen since the
+//publisher started (e.g. restored from seed) are timed from now. Must be
+//called with the state locked.
+func (f *core) collectStaleContainers(now time.Time) int {
+	removed := 0
+	for path := range f.state.DockerStorage {
+		seen, haveSeen := f.lastSeen[path]
+		if !haveSeen {
+			f.lastSeen[path] = now
+			continue
+		}
+		if now.Sub(seen) > f.containerTTL {
+			f.removeContainer(path, fmt.Sprintf("no metrics for %v", f.containerTTL))
+			removed++
+		}
+	}
+	return removed
+}
+
+// exportHistory writes container object with all retained stats to
+//a file in the export directory; the file has the format of state seed
+func (f *core) exportHistory(path string, dockerObj map[string]interface{}) {
+	fileName := filepath.Join(f.removalExportDir,
+		fmt.Sprintf("%s-%d.json", url.QueryEscape(path), time.Now().Unix()))
+	content, err := json.Marshal(map[string]interface{}{path: dockerObj})
+	if err == nil {
+		err = os.MkdirAll(f.removalExportDir, 0755)
+	}
+	if err == nil {
+		err = writeFileAtomically(fileName, content)
+	}
+	if err != nil {
+		f.logger.WithField("container", path).WithError(err).Error("Couldn't export history of removed container")
+		f.state.Events.Record(exchange.SeverityError, "container_removal", err.Error())
+	}
+}
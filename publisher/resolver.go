@@ -0,0 +1,307 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+)
+
+const (
+	defResolvers      = "docker,kubernetes"
+	defResolverRegex  = ""
+	defDockerPrefixes = dockerMetricPrefix
+	cfgResolvers      = "resolvers"
+	cfgResolverRegex  = "resolver_regex"
+	cfgDockerPrefixes = "docker_prefixes"
+
+	criMetricPrefix     = "/intel/cri/container"
+	cgroupPathTag       = "cgroup_path"
+	regexResolverIdName = "id"
+	prefixIdElement     = "{id}"
+	prefixAnyElement    = "*"
+)
+
+// Resolver tells which container given metric belongs to, returning
+// container ID and path used as the key in publisher's state.
+type Resolver interface {
+	Resolve(metric *Metric) (id string, path string, ok bool)
+}
+
+// elementResolver is implemented by resolvers which also tell where
+//container's part of metric namespace ends, as index of the first element
+//naming the metric within container
+type elementResolver interface {
+	resolveElements(metric *Metric) (id string, path string, metricIdx int, ok bool)
+}
+
+// resolveElements resolves metric with given resolver; for resolvers
+//not telling namespace position the metric is taken to follow the element
+//holding container ID, if any
+func resolveElements(resolver Resolver, metric *Metric) (string, string, int, bool) {
+	if positional, isPositional := resolver.(elementResolver); isPositional {
+		return positional.resolveElements(metric)
+	}
+	id, path, ok := resolver.Resolve(metric)
+	if !ok {
+		return "", "", 0, false
+	}
+	metricIdx := 0
+	for i := len(metric.Namespace) - 1; i >= 0; i-- {
+		if metric.Namespace[i] == id {
+			metricIdx = i + 1
+			break
+		}
+	}
+	return id, path, metricIdx, true
+}
+
+// ResolverFactory builds resolver using plugin's configuration.
+type ResolverFactory func(config ConfigMap) (Resolver, error)
+
+var resolverFactories = map[string]ResolverFactory{}
+
+// RegisterResolver makes resolver available under given name, to be
+// enabled by listing that name in `resolvers` config option.
+func RegisterResolver(name string, factory ResolverFactory) {
+	resolverFactories[name] = factory
+}
+
+func init() {
+	RegisterResolver("docker", newDockerResolver)
+	RegisterResolver("cri", func(_ ConfigMap) (Resolver, error) {
+		return newPrefixResolver(criMetricPrefix)
+	})
+	RegisterResolver("kubernetes", func(_ ConfigMap) (Resolver, error) {
+		return &podResolver{prefix: splitNamespace(kubernetesMetricPrefix)}, nil
+	})
+	RegisterResolver("cgroups", func(_ ConfigMap) (Resolver, error) {
+		return &cgroupResolver{}, nil
+	})
+	RegisterResolver("regex", newRegexResolver)
+}
+
+// buildResolvers instantiates resolvers listed in config, in given order
+func buildResolvers(config ConfigMap) ([]Resolver, error) {
+	resolvers := []Resolver{}
+	for _, name := range strings.Split(config.GetStr(cfgResolvers, defResolvers), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		factory, known := resolverFactories[name]
+		if !known {
+			known := []string{}
+			for k := range resolverFactories {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("Unknown resolver '%s', expected one of: %s", name, strings.Join(known, ", "))
+		}
+		resolver, err := factory(config)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, resolver)
+	}
+	return resolvers, nil
+}
+
+// prefixResolver handles metrics keyed by container ID found at fixed
+//position below the prefix, e.g. /intel/docker/DOCKER_ID/METRIC; prefix
+//may mark element holding the ID with '{id}' and match any element with '*',
+//otherwise ID is the element directly following the prefix
+type prefixResolver struct {
+	pattern []string
+	idIdx   int
+}
+
+func newPrefixResolver(prefix string) (*prefixResolver, error) {
+	pattern := splitNamespace(prefix)
+	if len(pattern) == 1 && pattern[0] == "" {
+		return nil, fmt.Errorf("Empty metric prefix")
+	}
+	idIdx := -1
+	for i, elem := range pattern {
+		if elem == prefixIdElement {
+			if idIdx >= 0 {
+				return nil, fmt.Errorf("Metric prefix '%s' marks container ID more than once", prefix)
+			}
+			idIdx = i
+		}
+	}
+	if idIdx < 0 {
+		pattern = append(pattern, prefixIdElement)
+		idIdx = len(pattern) - 1
+	}
+	return &prefixResolver{pattern: pattern, idIdx: idIdx}, nil
+}
+
+func (r *prefixResolver) Resolve(metric *Metric) (string, string, bool) {
+	id, path, _, ok := r.resolveElements(metric)
+	return id, path, ok
+}
+
+func (r *prefixResolver) resolveElements(metric *Metric) (string, string, int, bool) {
+	nsSplit := metric.Namespace
+	// at least one element of metric name must follow the prefix
+	if len(nsSplit) <= len(r.pattern) {
+		return "", "", 0, false
+	}
+	for i, elem := range r.pattern {
+		if elem != nsSplit[i] && elem != prefixAnyElement && i != r.idIdx {
+			return "", "", 0, false
+		}
+	}
+	id := nsSplit[r.idIdx]
+	if id == "" {
+		return "", "", 0, false
+	}
+	path := "/" + id
+	if id == "root" {
+		id = "/"
+		path = "/"
+	}
+	return id, path, len(r.pattern), true
+}
+
+// prefixResolvers tries each of resolvers for docker-like collectors,
+//in configured order
+type prefixResolvers []*prefixResolver
+
+// newDockerResolver builds resolvers for prefixes listed in
+//`docker_prefixes` option
+func newDockerResolver(config ConfigMap) (Resolver, error) {
+	resolvers := prefixResolvers{}
+	for _, prefix := range strings.Split(config.GetStr(cfgDockerPrefixes, defDockerPrefixes), ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		resolver, err := newPrefixResolver(prefix)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, resolver)
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("No docker metric prefixes given")
+	}
+	return resolvers, nil
+}
+
+func (r prefixResolvers) Resolve(metric *Metric) (string, string, bool) {
+	id, path, _, ok := r.resolveElements(metric)
+	return id, path, ok
+}
+
+func (r prefixResolvers) resolveElements(metric *Metric) (string, string, int, bool) {
+	for _, resolver := range r {
+		if id, path, metricIdx, ok := resolver.resolveElements(metric); ok {
+			return id, path, metricIdx, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// podResolver handles metrics keyed by pod UID and container name
+//(/intel/kubernetes/pod/POD_UID/container/NAME/METRIC), resolving them
+//to pod-scoped container entries
+type podResolver struct {
+	prefix []string
+}
+
+func (r *podResolver) Resolve(metric *Metric) (string, string, bool) {
+	id, path, _, ok := r.resolveElements(metric)
+	return id, path, ok
+}
+
+func (r *podResolver) resolveElements(metric *Metric) (string, string, int, bool) {
+	nsSplit := metric.Namespace
+	pfxLen := len(r.prefix)
+	if len(nsSplit) < pfxLen+4 || !metric.hasPrefix(r.prefix) || nsSplit[pfxLen] != "pod" || nsSplit[pfxLen+2] != "container" {
+		return "", "", 0, false
+	}
+	podUid, containerName := nsSplit[pfxLen+1], nsSplit[pfxLen+3]
+	return podUid + "/" + containerName, podContainerPath(podUid, containerName), pfxLen + 4, true
+}
+
+// cgroupResolver handles metrics tagged with raw cgroup path of container
+type cgroupResolver struct{}
+
+func (r *cgroupResolver) Resolve(metric *Metric) (string, string, bool) {
+	id, path, _, ok := r.resolveElements(metric)
+	return id, path, ok
+}
+
+// resolveElements takes the whole namespace as metric name, as container
+//isn't part of it
+func (r *cgroupResolver) resolveElements(metric *Metric) (string, string, int, bool) {
+	cgroupPath, haveTag := metric.Tags[cgroupPathTag]
+	if !haveTag || cgroupPath == "" {
+		return "", "", 0, false
+	}
+	path := "/" + strings.Trim(cgroupPath, "/")
+	if path == "/" {
+		return "/", "/", 0, true
+	}
+	return filepath.Base(path), path, 0, true
+}
+
+// regexResolver extracts container ID from namespace with configured
+//regular expression, taken from its group named 'id'
+type regexResolver struct {
+	regex *regexp.Regexp
+	idIdx int
+}
+
+func newRegexResolver(config ConfigMap) (Resolver, error) {
+	regex, err := regexp.Compile(config.GetStr(cfgResolverRegex, defResolverRegex))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid resolver regex: %v", err)
+	}
+	for i, name := range regex.SubexpNames() {
+		if name == regexResolverIdName {
+			return &regexResolver{regex: regex, idIdx: i}, nil
+		}
+	}
+	return nil, fmt.Errorf("Resolver regex '%s' lacks group named '%s'", regex, regexResolverIdName)
+}
+
+func (r *regexResolver) Resolve(metric *Metric) (string, string, bool) {
+	id, path, _, ok := r.resolveElements(metric)
+	return id, path, ok
+}
+
+// resolveElements takes the metric to follow the element where matched ID
+//ends; expression is matched against namespace joined with `/`
+func (r *regexResolver) resolveElements(metric *Metric) (string, string, int, bool) {
+	ns := metric.NamespaceString()
+	match := r.regex.FindStringSubmatchIndex(ns)
+	if match == nil || match[2*r.idIdx] < 0 || match[2*r.idIdx] == match[2*r.idIdx+1] {
+		return "", "", 0, false
+	}
+	id := ns[match[2*r.idIdx]:match[2*r.idIdx+1]]
+	return id, "/" + id, metric.elementAt(match[2*r.idIdx+1]-1) + 1, true
+}
@@ -0,0 +1,216 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	// retentionLimited keeps stats within stats_depth and stats_span,
+	//either of which is lifted when set to 0
+	retentionLimited = "limited"
+	// retentionLatestOnly keeps exactly one, the most recent, stats per
+	//container, for deployments which need minimal memory
+	retentionLatestOnly = "latest_only"
+)
+
+// retention holds limits of stats kept per container; depth of 0 means
+//no limit on number of stats, span of 0 - no limit on their age
+type retention struct {
+	mode      string
+	depth     int
+	span      time.Duration
+	overrides []retentionOverride
+}
+
+// retentionOverride sets retention limits of containers matching pattern;
+//negative limit means the one of stats_depth or stats_span applies
+type retentionOverride struct {
+	pattern string
+	depth   int
+	span    time.Duration
+}
+
+// parseRetentionOverrides parses overrides given in form of
+//"kube-system=1h,/kubepods/besteffort=5:1m" (pattern=limit[:limit]), where
+//integer limit is depth and duration is span
+func parseRetentionOverrides(overridesStr string) ([]retentionOverride, error) {
+	overrides := []retentionOverride{}
+	for _, item := range strings.Split(overridesStr, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid config: %s: expected pattern=limit[:limit], got %q", cfgRetOverrides, item)
+		}
+		override := retentionOverride{pattern: strings.TrimSpace(kv[0]), depth: -1, span: -1}
+		if _, err := pathpkg.Match(override.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid config: %s: bad pattern %q: %v", cfgRetOverrides, override.pattern, err)
+		}
+		for _, limit := range strings.Split(kv[1], ":") {
+			limit = strings.TrimSpace(limit)
+			if depth, err := strconv.Atoi(limit); err == nil && depth >= 0 && override.depth < 0 {
+				override.depth = depth
+			} else if span, err := time.ParseDuration(limit); err == nil && span >= 0 && override.span < 0 {
+				override.span = span
+			} else {
+				return nil, fmt.Errorf("invalid config: %s: bad limit %q for %q, expected depth (0 or more) and/or span", cfgRetOverrides, limit, override.pattern)
+			}
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// parseRetention reads retention settings of the task, rejecting
+//negative limits and unknown modes
+func parseRetention(config ConfigMap) (retention, error) {
+	res := retention{mode: config.GetStr(cfgRetention, defRetention)}
+	switch res.mode {
+	case retentionLatestOnly:
+		res.depth = 1
+		return res, nil
+	case retentionLimited:
+	default:
+		return res, fmt.Errorf("invalid config: %s: expected %q or %q, got %q", cfgRetention, retentionLimited, retentionLatestOnly, res.mode)
+	}
+	res.depth = config.GetInt(cfgStatsDepth, defStatsDepth)
+	if res.depth < 0 {
+		return res, fmt.Errorf("invalid config: %s: expected 0 (no limit) or more, got %d", cfgStatsDepth, res.depth)
+	}
+	span, err := config.GetDuration(cfgStatsSpan, defStatsSpanStr)
+	if err != nil {
+		return res, err
+	}
+	if span < 0 {
+		return res, fmt.Errorf("invalid config: %s: expected 0 (no limit) or more, got %s", cfgStatsSpan, span)
+	}
+	res.span = span
+	if res.overrides, err = parseRetentionOverrides(config.GetStr(cfgRetOverrides, defRetOverrides)); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// applyRetention sets up retention of stats, warning if nothing but memory
+//limits bounds it
+func (f *core) applyRetention(config ConfigMap, ret retention) {
+	f.retention = ret.mode
+	f.statsDepth = ret.depth
+	f.statsSpan = ret.span
+	f.retentionOverrides = ret.overrides
+	if ret.mode == retentionLatestOnly {
+		for _, option := range []string{cfgStatsDepth, cfgStatsSpan, cfgDownsampleTiers, cfgRetOverrides} {
+			if _, configured := config[option]; configured {
+				f.logger.Warnf("option %s ignored, retention is %s", option, retentionLatestOnly)
+				f.state.Events.Record(exchange.SeverityWarning, "config", "option "+option+" ignored, retention is "+retentionLatestOnly)
+			}
+		}
+		return
+	}
+	if ret.depth == 0 && ret.span == 0 {
+		msg := "stats retention is unlimited (stats_depth and stats_span are 0), stats grow with every batch unless max_memory_mb bounds them"
+		f.logger.Warnf(msg)
+		f.state.Events.Record(exchange.SeverityWarning, "config", msg)
+	}
+}
+
+// retentionLimits returns retention limits of container or pod entry under
+//given path: those of the first override matching its path or kubernetes
+//identity (namespace/pod/container), or any leading part of them
+func (f *core) retentionLimits(path string) (int, time.Duration) {
+	depth, span := f.statsDepth, f.statsSpan
+	if len(f.retentionOverrides) == 0 {
+		return depth, span
+	}
+	names := leadingParts(path)
+	if dockerObj, haveDocker := f.state.DockerStorage[path]; haveDocker {
+		labels, _ := dockerObj.(map[string]interface{})["labels"].(map[string]interface{})
+		podNamespace, _ := labels[labelPodNamespace].(string)
+		podName, _ := labels[labelPodName].(string)
+		containerName, _ := labels[labelContainerName].(string)
+		if podNamespace != "" && podName != "" && containerName != "" {
+			names = append(names, leadingParts(podNamespace+"/"+podName+"/"+containerName)...)
+		}
+	}
+	for _, override := range f.retentionOverrides {
+		for _, name := range names {
+			if matched, _ := pathpkg.Match(override.pattern, name); !matched {
+				continue
+			}
+			if override.depth >= 0 {
+				depth = override.depth
+			}
+			if override.span >= 0 {
+				span = override.span
+			}
+			return depth, span
+		}
+	}
+	return depth, span
+}
+
+// leadingParts returns name along with its parts up to each separator,
+//e.g. "a/b", "a" for "a/b"; a leading separator is kept
+func leadingParts(name string) []string {
+	parts := []string{name}
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] == '/' {
+			parts = append(parts, name[:i])
+		}
+	}
+	return parts
+}
+
+// retainedOffset tells how many of the oldest stats in statsList of entry
+//under given path fall out of retention limits, given the newest stats
+//are stamped newest and reserve more stats are about to be added; depth
+//and span limits apply independently, so stats are kept only while within
+//both
+func (f *core) retainedOffset(path string, statsList []interface{}, newest time.Time, reserve int) int {
+	validOfs := 0
+	depth, span := f.retentionLimits(path)
+	if statsDepth := f.effectiveStatsDepth(depth); statsDepth > 0 && len(statsList)+reserve > statsDepth {
+		validOfs = len(statsList) + reserve - statsDepth
+	}
+	if statsSpan := f.effectiveStatsSpan(span); statsSpan > 0 {
+		for validOfs < len(statsList) {
+			ckStamp, _ := util.ParseTime(statsList[validOfs].(map[string]interface{})["timestamp"].(string))
+			if newest.Sub(ckStamp) <= statsSpan {
+				break
+			}
+			validOfs++
+		}
+	}
+	if validOfs > len(statsList) {
+		validOfs = len(statsList)
+	}
+	return validOfs
+}
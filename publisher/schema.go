@@ -0,0 +1,197 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const jsonSchemaVersion = "http://json-schema.org/draft-04/schema#"
+
+// valueSpecTypes maps types of template value specs to JSON Schema types
+var valueSpecTypes = map[string]string{
+	"int":     "integer",
+	"int64":   "integer",
+	"float64": "number",
+	"bool":    "boolean",
+	"str":     "string",
+	"ktime":   "string",
+	"time":    "string",
+}
+
+// buildSchema derives JSON Schema of container objects produced with
+//the template; types of mapped fields are taken from their value specs
+func (t *MetricTemplate) buildSchema() (map[string]interface{}, error) {
+	var dockerObj, statsObj, ifaceObj, fsObj map[string]interface{}
+	sources := []string{t.source, t.statsSource, t.ifaceSource, t.fsSource}
+	for i, dest := range []*map[string]interface{}{&dockerObj, &statsObj, &ifaceObj, &fsObj} {
+		if err := json.Unmarshal([]byte(sources[i]), dest); err != nil {
+			return nil, err
+		}
+	}
+	ifaceSchema := schemaOf(ifaceObj, "/", mappedTypes(t.mapToIface))
+	fsSchema := schemaOf(fsObj, "/", mappedTypes(t.mapToFs))
+	statsSchema := schemaOf(statsObj, "/", mappedTypes(t.mapToStats))
+	statsProps := statsSchema["properties"].(map[string]interface{})
+	if networkSchema, haveNetwork := statsProps["network"].(map[string]interface{}); haveNetwork {
+		networkSchema["properties"].(map[string]interface{})["interfaces"] = arraySchema(ifaceSchema)
+	}
+	if _, haveFs := statsProps["filesystem"]; haveFs {
+		statsProps["filesystem"] = arraySchema(fsSchema)
+	}
+	if _, haveCustom := statsProps["custom_metrics"]; haveCustom {
+		statsProps["custom_metrics"] = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": arraySchema(metricValSchema()),
+		}
+	}
+	statsProps["timestamp"] = map[string]interface{}{"type": "string", "format": "date-time"}
+	dockerSchema := schemaOf(dockerObj, "/", mappedTypes(t.mapToDocker))
+	dockerSchema["properties"].(map[string]interface{})["stats"] = arraySchema(statsSchema)
+	dockerSchema["$schema"] = jsonSchemaVersion
+	dockerSchema["title"] = "container"
+	return dockerSchema, nil
+}
+
+func mappedTypes(mapping map[string]map[string]string) map[string]string {
+	res := map[string]string{}
+	for _, spec := range mapping {
+		specType := spec["type"]
+		if norm, haveNorm := spec["norm"]; haveNorm && norm != "none" {
+			specType = norm
+		}
+		if schemaType, known := valueSpecTypes[specType]; known {
+			res[spec["target"]] = schemaType
+		}
+	}
+	return res
+}
+
+func schemaOf(obj interface{}, path string, types map[string]string) map[string]interface{} {
+	if schemaType, mapped := types[path]; mapped {
+		return map[string]interface{}{"type": schemaType}
+	}
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		props := map[string]interface{}{}
+		keys := []string{}
+		var dynamicSchema interface{}
+		for k, sub := range v {
+			subPath := filepath.Join(path, k)
+			// fields named after metric namespace are only known when
+			//metrics arrive
+			if isDynamicElement(k) {
+				dynamicSchema = schemaOf(sub, subPath, types)
+				continue
+			}
+			props[k] = schemaOf(sub, subPath, types)
+			// mapped fields may be pruned from output, so they're optional
+			if _, mapped := types[subPath]; !mapped {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		res := map[string]interface{}{"type": "object", "properties": props}
+		if dynamicSchema != nil {
+			res["additionalProperties"] = dynamicSchema
+		}
+		if len(keys) > 0 {
+			res["required"] = keys
+		}
+		return res
+	case []interface{}:
+		if len(v) > 0 {
+			return arraySchema(schemaOf(v[0], filepath.Join(path, "0"), types))
+		}
+		return arraySchema(map[string]interface{}{})
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case float64:
+		if v == float64(int64(v)) {
+			return map[string]interface{}{"type": "integer"}
+		}
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func arraySchema(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func metricValSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"label":       map[string]interface{}{"type": "string"},
+			"timestamp":   map[string]interface{}{"type": "string", "format": "date-time"},
+			"int_value":   map[string]interface{}{"type": "integer"},
+			"float_value": map[string]interface{}{"type": "number"},
+		},
+		"required": []string{"timestamp"},
+	}
+}
+
+// ExportSchema returns JSON Schema of container objects produced with
+// the template found at given location ("builtin" for builtin template).
+func ExportSchema(templateFile string) ([]byte, error) {
+	core, _ := NewCore()
+	core.exportTmplFile = templateFile
+	if err := core.loadMetricTemplate(); err != nil {
+		return nil, err
+	}
+	return core.state.Schema, nil
+}
+
+// validateOutput checks container object against the schema derived from
+//the template, logging any violations
+func (f *core) validateOutput(path string, dockerObj map[string]interface{}) {
+	if f.schema == nil {
+		return
+	}
+	encoded, err := json.Marshal(dockerObj)
+	if err != nil {
+		f.logger.WithField("container", path).WithError(err).Error("Container can't be encoded")
+		return
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		f.logger.WithField("container", path).WithError(err).Error("Container can't be decoded")
+		return
+	}
+	if violations := util.ValidateSchema(f.schema, generic); len(violations) > 0 {
+		f.logger.WithField("container", path).Warnf("Output violates schema: %s", strings.Join(violations, "; "))
+		f.state.Events.Record(exchange.SeverityWarning, "schema_violation",
+			fmt.Sprintf("container %s: %d violations, first: %s", path, len(violations), violations[0]))
+	}
+}
@@ -0,0 +1,129 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	cadv "github.com/google/cadvisor/info/v1"
+)
+
+// loadStateSeed fills publisher's state with container objects found in
+//the seed; seed is either a file holding container objects keyed by their
+//names, i.e. in the format of response of stats endpoint, or a state dump.
+//Given a directory, the latest state dump found in it is loaded. Returns
+//name of the file loaded
+func (f *core) loadStateSeed(seedPath string) (string, error) {
+	seedFile := seedPath
+	if info, err := os.Stat(seedPath); err != nil {
+		return "", err
+	} else if info.IsDir() {
+		// names of dumps sort in order they were taken
+		fileNames, _ := filepath.Glob(filepath.Join(seedPath, "state-*.json"))
+		if len(fileNames) == 0 {
+			return "", fmt.Errorf("no state dumps found in %s", seedPath)
+		}
+		sort.Strings(fileNames)
+		seedFile = fileNames[len(fileNames)-1]
+	}
+	content, err := ioutil.ReadFile(seedFile)
+	if err != nil {
+		return "", err
+	}
+	var seed map[string]json.RawMessage
+	if err := json.Unmarshal(content, &seed); err != nil {
+		return "", fmt.Errorf("Invalid state seed %s: %v", seedFile, err)
+	}
+	containers := map[string]map[string]interface{}{}
+	if dumped, isDump := seed["docker_storage"]; isDump {
+		// names of containers start with a slash, so a dump can't be
+		//mistaken for containers
+		err = json.Unmarshal(dumped, &containers)
+	} else {
+		err = json.Unmarshal(content, &containers)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Invalid state seed %s: %v", seedFile, err)
+	}
+	return seedFile, f.restoreState(containers, "state seed")
+}
+
+// restoreState validates container objects, e.g. loaded from seed file,
+//and puts them into publisher's state; state is left intact if any
+//of the objects is invalid
+func (f *core) restoreState(containers map[string]map[string]interface{}, origin string) error {
+	for path, dockerObj := range containers {
+		if err := restoreContainer(dockerObj); err != nil {
+			return fmt.Errorf("Invalid container %s in %s: %v", path, origin, err)
+		}
+	}
+	f.state.Lock()
+	defer f.state.Unlock()
+	for path, dockerObj := range containers {
+		id, _ := dockerObj["id"].(string)
+		f.state.DockerPaths[path] = id
+		f.state.DockerStorage[path] = dockerObj
+		f.reindexStats(path, dockerObj)
+		f.markDirty(path)
+	}
+	f.publishReadModel()
+	return nil
+}
+
+// restoreContainer brings decoded container object to the form used for
+//containers built by the publisher
+func restoreContainer(dockerObj map[string]interface{}) error {
+	if _, haveStats := dockerObj["stats"].([]interface{}); !haveStats {
+		dockerObj["stats"] = []interface{}{}
+	}
+	for _, statsObj := range dockerObj["stats"].([]interface{}) {
+		statsMap, isMap := statsObj.(map[string]interface{})
+		if !isMap {
+			return fmt.Errorf("stats element is not an object")
+		}
+		if _, haveStamp := statsMap["timestamp"].(string); !haveStamp {
+			return fmt.Errorf("stats element lacks timestamp")
+		}
+		if _, haveCustom := statsMap["custom_metrics"].(map[string]interface{}); !haveCustom {
+			statsMap["custom_metrics"] = map[string]interface{}{}
+		}
+	}
+	specMap, haveSpec := dockerObj["spec"].(map[string]interface{})
+	if !haveSpec {
+		return fmt.Errorf("spec is missing")
+	}
+	metricList, _ := specMap["custom_metrics"].([]interface{})
+	specList := make([]interface{}, 0, len(metricList))
+	for _, metricObj := range metricList {
+		var spec cadv.MetricSpec
+		encoded, _ := json.Marshal(metricObj)
+		if err := json.Unmarshal(encoded, &spec); err != nil {
+			return err
+		}
+		specList = append(specList, spec)
+	}
+	specMap["custom_metrics"] = specList
+	return nil
+}
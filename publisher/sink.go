@@ -0,0 +1,160 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const sinkQueueSize = 256
+
+// Sink receives container objects pushed by the publisher; containers
+// are keyed by their names, like in response of stats endpoint.
+type Sink interface {
+	Name() string
+	Push(containers map[string]interface{}) error
+}
+
+// sinkDispatcher delivers pushed containers to all sinks in background,
+//so pushing never blocks processing of metrics
+type sinkDispatcher struct {
+	core  *core
+	sinks []Sink
+	queue chan sinkBatch
+}
+
+// sinkBatch is a set of containers queued for delivery; done, if given,
+//is told whether all sinks accepted them
+type sinkBatch struct {
+	containers map[string]interface{}
+	done       func(delivered bool)
+}
+
+func newSinkDispatcher(core *core, sinks []Sink) *sinkDispatcher {
+	return &sinkDispatcher{
+		core:  core,
+		sinks: sinks,
+		queue: make(chan sinkBatch, sinkQueueSize),
+	}
+}
+
+// push queues containers for delivery, reporting the outcome to done
+//once they're pushed to sinks; containers are dropped if the queue is
+//full, i.e. sinks can't keep up, or the publisher is shut down, which
+//is told by the result (done isn't called then)
+func (d *sinkDispatcher) push(containers map[string]interface{}, done func(delivered bool)) bool {
+	select {
+	case <-d.core.stopped:
+		return false
+	default:
+	}
+	select {
+	case d.queue <- sinkBatch{containers: containers, done: done}:
+		return true
+	default:
+		d.core.state.Events.Record(exchange.SeverityWarning, "sink",
+			fmt.Sprintf("sink queue full, dropped %d containers", len(containers)))
+		return false
+	}
+}
+
+// sinkFeature names the sink as a feature reported by readiness
+func sinkFeature(sink Sink) string {
+	return featureSinks + "/" + sink.Name()
+}
+
+// run delivers queued batches until the publisher is shut down; batches
+//still queued then are dropped as undelivered
+func (d *sinkDispatcher) run() {
+	for {
+		select {
+		case <-d.core.stopped:
+			d.drain()
+			return
+		case batch := <-d.queue:
+			d.deliver(batch)
+		}
+	}
+}
+
+func (d *sinkDispatcher) deliver(batch sinkBatch) {
+	delivered := true
+	for _, sink := range d.sinks {
+		if err := sink.Push(batch.containers); err != nil {
+			d.core.logger.WithFields(log.Fields{"sink": sink.Name(), "containers": len(batch.containers)}).WithError(err).Warn("Failed to push to sink")
+			d.core.state.Events.Record(exchange.SeverityError, "sink",
+				fmt.Sprintf("failed to push to %s: %v", sink.Name(), err))
+			d.core.state.Readiness.SetImpaired(sinkFeature(sink), err.Error())
+			delivered = false
+			continue
+		}
+		d.core.state.Readiness.SetReady(sinkFeature(sink))
+	}
+	if batch.done != nil {
+		batch.done(delivered)
+	}
+}
+
+// drain empties the queue on shutdown, telling owners of batches they
+//weren't delivered
+func (d *sinkDispatcher) drain() {
+	dropped := 0
+	for {
+		select {
+		case batch := <-d.queue:
+			dropped += len(batch.containers)
+			if batch.done != nil {
+				batch.done(false)
+			}
+		default:
+			if dropped > 0 {
+				d.core.logger.Warnf("Dropped %d containers queued for sinks on shutdown", dropped)
+			}
+			return
+		}
+	}
+}
+
+// captureContainer pushes the first stats sample of newly discovered
+//container to sinks right away, so short-lived containers aren't missed
+//between scrapes, unless publisher is idle; must be called with the state
+//locked
+func (f *core) captureContainer(path string) {
+	dockerObj, haveDocker := f.state.DockerStorage[path]
+	if !haveDocker || f.isIdle() {
+		return
+	}
+	statsList := dockerObj.(map[string]interface{})["stats"].([]interface{})
+	if len(statsList) == 0 {
+		return
+	}
+	dockerCopy := map[string]interface{}{}
+	for k, v := range dockerObj.(map[string]interface{}) {
+		if k != "stats" {
+			dockerCopy[k] = util.DeepCopy(v)
+		}
+	}
+	dockerCopy["stats"] = []interface{}{util.DeepCopy(statsList[len(statsList)-1])}
+	f.sinks.push(map[string]interface{}{path: dockerCopy}, nil)
+}
@@ -0,0 +1,119 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+func init() {
+	registerSubsystem(featureSinks, setupSinks)
+}
+
+// setupSinks starts delivery to sinks enabled in configuration, along
+//with push mode and capturing of new containers
+func setupSinks(f *core, config ConfigMap) {
+	if sinks := f.buildSinks(config); len(sinks) > 0 {
+		f.sinks = newSinkDispatcher(f, sinks)
+		go f.sinks.run()
+	}
+	if pushInterval, err := config.GetDuration(cfgPushInterval, defPushInterval); err == nil && pushInterval > 0 {
+		if f.sinks == nil {
+			f.logger.Errorf("push mode enabled, but no sink is configured")
+			f.state.Events.Record(exchange.SeverityError, "config", "push mode enabled, but no sink is configured")
+		} else {
+			go newPeriodicPusher(f, pushInterval, config.GetInt(cfgPushBatchSize, defPushBatchSize)).run()
+		}
+	}
+	if config.GetBool(cfgCaptureNew, defCaptureNew) && f.sinks != nil {
+		f.newContainerHooks = append(f.newContainerHooks, f.captureContainer)
+	}
+}
+
+// httpSink POSTs containers as JSON document to configured URL
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHttpSink(url string, timeout time.Duration) *httpSink {
+	return &httpSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Name tells location of the sink, with credentials embedded in URL masked
+func (s *httpSink) Name() string {
+	return util.RedactUrls(s.url, maskedValue)
+}
+
+func (s *httpSink) Push(containers map[string]interface{}) error {
+	payload, err := json.Marshal(containers)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sink responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// buildSinks sets up push sinks enabled in configuration
+func (f *core) buildSinks(config ConfigMap) []Sink {
+	sinks := []Sink{}
+	if sinkUrl := config.GetStr(cfgPushSinkUrl, defPushSinkUrl); sinkUrl != "" {
+		timeout, err := config.GetDuration(cfgPushTimeout, defPushTimeoutStr)
+		if err != nil {
+			timeout = defPushTimeout
+		}
+		sinks = append(sinks, newHttpSink(sinkUrl, timeout))
+	}
+	if influxUrl := config.GetStr(cfgInfluxUrl, defInfluxUrl); influxUrl != "" {
+		timeout, err := config.GetDuration(cfgPushTimeout, defPushTimeoutStr)
+		if err != nil {
+			timeout = defPushTimeout
+		}
+		sink, err := newInfluxSink(influxUrl,
+			config.GetStr(cfgInfluxDatabase, defInfluxDatabase),
+			config.GetStr(cfgInfluxRetention, defInfluxRetention),
+			config.GetStr(cfgInfluxUsername, defInfluxUsername),
+			config.GetStr(cfgInfluxPassword, defInfluxPassword),
+			config.GetInt(cfgInfluxBatchSize, defInfluxBatchSize), timeout)
+		if err != nil {
+			f.logger.WithError(err).Error("InfluxDB sink disabled")
+			f.state.Events.Record(exchange.SeverityError, "sink", "InfluxDB sink disabled: "+err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
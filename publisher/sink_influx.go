@@ -0,0 +1,307 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	// influxStatsMeasurement holds fields of stats of containers; lists
+	//of objects found in stats (e.g. interfaces) go to measurements named
+	//after their location, e.g. container_network_interfaces
+	influxStatsMeasurement  = "container_stats"
+	influxMeasurementPrefix = "container_"
+)
+
+// influxEscaper escapes measurement names, tag keys and values and field
+//keys of the line protocol
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxSink writes stats of containers to InfluxDB using line protocol,
+//a point per stats sample, in batches of configured number of points
+type influxSink struct {
+	writeUrl  string
+	name      string
+	username  string
+	password  string
+	batchSize int
+	client    *http.Client
+}
+
+// newInfluxSink sets up sink writing to InfluxDB at baseUrl; query of
+//baseUrl is kept, credentials are sent with basic auth if username is given
+func newInfluxSink(baseUrl, database, retentionPolicy, username, password string, batchSize int, timeout time.Duration) (*influxSink, error) {
+	writeUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	if writeUrl.Scheme == "" || writeUrl.Host == "" {
+		return nil, fmt.Errorf("invalid InfluxDB URL: %s", util.RedactUrls(baseUrl, maskedValue))
+	}
+	writeUrl.Path = strings.TrimSuffix(writeUrl.Path, "/") + "/write"
+	query := writeUrl.Query()
+	query.Set("db", database)
+	query.Set("precision", "ns")
+	if retentionPolicy != "" {
+		query.Set("rp", retentionPolicy)
+	}
+	writeUrl.RawQuery = query.Encode()
+	return &influxSink{
+		writeUrl:  writeUrl.String(),
+		name:      util.RedactUrls(writeUrl.String(), maskedValue),
+		username:  username,
+		password:  password,
+		batchSize: batchSize,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Name tells location of the sink, with credentials embedded in URL masked
+func (s *influxSink) Name() string {
+	return s.name
+}
+
+func (s *influxSink) Push(containers map[string]interface{}) error {
+	paths := make([]string, 0, len(containers))
+	for path := range containers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var batch bytes.Buffer
+	points := 0
+	for _, path := range paths {
+		dockerMap, isMap := containers[path].(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		tags := influxTags(path, dockerMap)
+		statsList, _ := dockerMap["stats"].([]interface{})
+		for _, statsObj := range statsList {
+			statsMap, isMap := statsObj.(map[string]interface{})
+			if !isMap {
+				continue
+			}
+			stamp, err := util.ParseTime(fmt.Sprint(statsMap["timestamp"]))
+			if err != nil {
+				continue
+			}
+			points += writeInfluxPoints(&batch, tags, statsMap, stamp)
+			if s.batchSize > 0 && points >= s.batchSize {
+				if err := s.write(&batch); err != nil {
+					return err
+				}
+				points = 0
+			}
+		}
+	}
+	if batch.Len() > 0 {
+		return s.write(&batch)
+	}
+	return nil
+}
+
+// write sends points gathered in batch, emptying it
+func (s *influxSink) write(batch *bytes.Buffer) error {
+	defer batch.Reset()
+	req, err := http.NewRequest("POST", s.writeUrl, bytes.NewReader(batch.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// errors of client quote the URL
+		return fmt.Errorf("%s", util.RedactUrls(err.Error(), maskedValue))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influxdb responded with %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// influxTags returns tags of points of container, escaped and joined as
+//they precede fields: container name and id, along with pod namespace,
+//pod name and container name if kubernetes labels are known
+func influxTags(path string, dockerMap map[string]interface{}) string {
+	tags := map[string]string{"container": path}
+	if id, _ := dockerMap["id"].(string); id != "" {
+		tags["id"] = id
+	}
+	labels, _ := dockerMap["labels"].(map[string]interface{})
+	for tag, label := range map[string]string{
+		"pod_namespace":  labelPodNamespace,
+		"pod_name":       labelPodName,
+		"container_name": labelContainerName,
+	} {
+		if value, _ := labels[label].(string); value != "" {
+			tags[tag] = value
+		}
+	}
+	return joinInfluxTags(tags)
+}
+
+func joinInfluxTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	// line protocol performs best with tags sorted by key
+	sort.Strings(keys)
+	var res bytes.Buffer
+	for _, key := range keys {
+		res.WriteString("," + influxEscaper.Replace(key) + "=" + influxEscaper.Replace(tags[key]))
+	}
+	return res.String()
+}
+
+// writeInfluxPoints writes points of stats sample: one of the stats
+//measurement and one per element of lists of objects identified by name
+//or device; returns number of points written
+func writeInfluxPoints(w *bytes.Buffer, tags string, statsMap map[string]interface{}, stamp time.Time) int {
+	fields := map[string]string{}
+	lists := map[string][]interface{}{}
+	flattenInfluxFields("", statsMap, fields, lists)
+	points := writeInfluxPoint(w, influxStatsMeasurement, tags, fields, stamp)
+	for location, list := range lists {
+		measurement := influxMeasurementPrefix + strings.Replace(location, ".", "_", -1)
+		for _, element := range list {
+			elementMap := element.(map[string]interface{})
+			elementTags := tags
+			for _, key := range listElementKeys {
+				if name, _ := elementMap[key].(string); name != "" {
+					elementTags += joinInfluxTags(map[string]string{key: name})
+					break
+				}
+			}
+			elementFields := map[string]string{}
+			flattenInfluxFields("", elementMap, elementFields, map[string][]interface{}{})
+			points += writeInfluxPoint(w, measurement, elementTags, elementFields, stamp)
+		}
+	}
+	return points
+}
+
+// writeInfluxPoint writes a line of point with fields sorted by key;
+//point without fields isn't written
+func writeInfluxPoint(w *bytes.Buffer, measurement, tags string, fields map[string]string, stamp time.Time) int {
+	if len(fields) == 0 {
+		return 0
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.WriteString(influxEscaper.Replace(measurement) + tags + " ")
+	for i, key := range keys {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString(influxEscaper.Replace(key) + "=" + fields[key])
+	}
+	w.WriteString(" " + strconv.FormatInt(stamp.UnixNano(), 10) + "\n")
+	return 1
+}
+
+// flattenInfluxFields collects numeric and boolean values of stats as
+//fields named after their location (e.g. cpu.usage.total), formatted for
+//line protocol; lists of objects identified by name or device are collected
+//separately, other lists are flattened with indices. Custom metrics are
+//left out, as they aren't mapped by the template
+func flattenInfluxFields(prefix string, node interface{}, fields map[string]string, lists map[string][]interface{}) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if prefix == "" && (key == "timestamp" || key == "custom_metrics") {
+				continue
+			}
+			flattenInfluxFields(joinFieldName(prefix, key), child, fields, lists)
+		}
+	case []interface{}:
+		if isInfluxObjectList(v) {
+			lists[prefix] = v
+			return
+		}
+		for i, child := range v {
+			flattenInfluxFields(joinFieldName(prefix, strconv.Itoa(i)), child, fields, lists)
+		}
+	case bool:
+		fields[prefix] = strconv.FormatBool(v)
+	default:
+		// numbers are always written as floats, as stats left at template
+		//defaults and reported ones differ in type, which would conflict
+		//with field types already known to InfluxDB
+		if value, isNumber := toFloat64(v); isNumber && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			fields[prefix] = strconv.FormatFloat(value, 'g', -1, 64)
+		}
+	}
+}
+
+func joinFieldName(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// isInfluxObjectList tells if list holds objects identified by one of
+//listElementKeys, e.g. interfaces or filesystems
+func isInfluxObjectList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, element := range list {
+		elementMap, isMap := element.(map[string]interface{})
+		if !isMap {
+			return false
+		}
+		identified := false
+		for _, key := range listElementKeys {
+			if _, haveKey := elementMap[key]; haveKey {
+				identified = true
+				break
+			}
+		}
+		if !identified {
+			return false
+		}
+	}
+	return true
+}
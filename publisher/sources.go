@@ -0,0 +1,56 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"strings"
+)
+
+// sourcePrefixLen is number of namespace elements identifying source
+//of metrics, e.g. /intel/docker
+const sourcePrefixLen = 2
+
+// metricSource tells which source metric comes from: the value of
+//configured source tag, if metric carries it, or its namespace prefix
+func (f *core) metricSource(metric *Metric) string {
+	if f.sourceTag != "" {
+		if source, haveTag := metric.Tags[f.sourceTag]; haveTag && source != "" {
+			return source
+		}
+	}
+	prefixLen := sourcePrefixLen
+	if len(metric.Namespace) < prefixLen {
+		prefixLen = len(metric.Namespace)
+	}
+	return "/" + strings.Join(metric.Namespace[:prefixLen], "/")
+}
+
+// countSourceMetric counts metric received in the batch by its source
+func (f *processorContext) countSourceMetric(metric *Metric, mapped bool) {
+	source := f.metricSource(metric)
+	counters := f.sourceCounters[source]
+	counters.Received++
+	if mapped {
+		counters.Mapped++
+	} else {
+		counters.Dropped++
+	}
+	f.sourceCounters[source] = counters
+}
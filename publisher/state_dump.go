@@ -0,0 +1,100 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// stateDumpTimeFormat stamps names of state dump files
+const stateDumpTimeFormat = "20060102T150405.000000000Z"
+
+// DumpState writes the entire state of the publisher, as of the latest
+//read model, to a timestamped JSON file in the state dump directory,
+//returning name of the file; state lock is not taken, so dumping doesn't
+//hold up processing
+func (f *core) DumpState() (string, error) {
+	if f.stateDumpDir == "" {
+		return "", fmt.Errorf("state dump directory not configured (%s)", cfgStateDumpDir)
+	}
+	now := time.Now().UTC()
+	model := f.state.ReadModel.Get()
+	content, err := json.Marshal(map[string]interface{}{
+		"dumped_at":      now,
+		"version":        model.Version,
+		"docker_storage": model.DockerStorage,
+		"stats_index":    model.StatsIndex,
+		"tombstones":     model.Tombstones,
+		"pod_storage":    model.PodStorage,
+		"downsampled":    model.Downsampled,
+		"machine":        model.Machine,
+		"sources":        f.state.Sources.Counters(),
+		"events":         f.state.Events.Events(),
+		"stats_history":  f.state.StatsHistory.Samples(),
+	})
+	if err != nil {
+		return "", err
+	}
+	fileName := filepath.Join(f.stateDumpDir, "state-"+now.Format(stateDumpTimeFormat)+".json")
+	if err = os.MkdirAll(f.stateDumpDir, 0700); err == nil {
+		err = writeFileAtomically(fileName, content)
+	}
+	if err != nil {
+		return "", err
+	}
+	f.state.Events.Record(exchange.SeverityInfo, "state_dump", "state dumped to "+fileName)
+	return fileName, nil
+}
+
+// DumpState writes state of every publisher instance to a file, returning
+//names of files written; instances without dump directory are skipped
+func (p *Publisher) DumpState() ([]string, error) {
+	p.Lock()
+	instances := make([]*core, 0, len(p.instances))
+	for _, entry := range p.instances {
+		if entry.failedAt.IsZero() {
+			instances = append(instances, entry.core)
+		}
+	}
+	p.Unlock()
+	fileNames := []string{}
+	var firstErr error
+	for _, instance := range instances {
+		if instance.stateDumpDir == "" {
+			continue
+		}
+		fileName, err := instance.DumpState()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	return fileNames, firstErr
+}
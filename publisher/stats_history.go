@@ -0,0 +1,63 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// sampleStatsHistory records publisher's statistics over every interval
+//into the history served at /debug/stats/history
+func (f *core) sampleStatsHistory(interval time.Duration) {
+	prevStats, prevDropped := f.sampleCoreStats()
+	prevTime := time.Now()
+	f.tick(interval, func(now time.Time) {
+		stats, dropped := f.sampleCoreStats()
+		containers := f.lastDebugSnapshot().containers
+		elapsed := now.Sub(prevTime).Seconds()
+		batches := stats.batchesTotal - prevStats.batchesTotal
+		metrics := stats.metricsRxTotal - prevStats.metricsRxTotal
+		f.state.StatsHistory.Record(exchange.CoreStatsSample{
+			Timestamp:      now,
+			Interval:       elapsed,
+			Batches:        batches,
+			BatchesPerSec:  float64(batches) / elapsed,
+			Metrics:        metrics,
+			MetricsPerSec:  float64(metrics) / elapsed,
+			DroppedMetrics: dropped - prevDropped,
+			Stats:          stats.statsRxTotal - prevStats.statsRxTotal,
+			Containers:     containers,
+		})
+		prevStats, prevDropped, prevTime = stats, dropped, now
+	})
+}
+
+// sampleCoreStats takes a copy of core statistics along with total number
+//of dropped metrics
+func (f *core) sampleCoreStats() (coreStats, int64) {
+	stats := f.lastDebugSnapshot().stats
+	dropped := int64(0)
+	for _, counters := range f.state.Sources.Counters() {
+		dropped += counters.Dropped
+	}
+	return stats, dropped
+}
@@ -0,0 +1,90 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	featureSinks      = "sinks"
+	featureKubernetes = "kubernetes"
+	featureDocker     = "docker"
+	featurePprof      = "pprof"
+)
+
+// subsystem is an optional part of publisher, set up out of configuration
+//at initialization; subsystems register themselves from files excluded by
+//build profiles, so they're left out of lean builds
+type subsystem struct {
+	name  string
+	setup func(f *core, config ConfigMap)
+}
+
+var subsystems []subsystem
+
+// featureOptions tells which feature given option needs, so options
+//configured for features not compiled in are reported
+var featureOptions = map[string]string{
+	cfgPushSinkUrl:    featureSinks,
+	cfgPushInterval:   featureSinks,
+	cfgCaptureNew:     featureSinks,
+	cfgKubeApi:        featureKubernetes,
+	cfgProxyDiscovery: featureKubernetes,
+	cfgDockerEndpoint: featureDocker,
+	cfgDebugPprof:     featurePprof,
+}
+
+func registerSubsystem(name string, setup func(f *core, config ConfigMap)) {
+	subsystems = append(subsystems, subsystem{name: name, setup: setup})
+	util.RegisterFeature(name)
+}
+
+// setupSubsystems sets up subsystems compiled in, reporting options of
+//those left out
+func (f *core) setupSubsystems(config ConfigMap) {
+	for _, subsystem := range subsystems {
+		subsystem.setup(f, config)
+	}
+	for option, feature := range featureOptions {
+		if _, configured := config[option]; configured && !util.HasFeature(feature) {
+			f.logger.Warnf("option %s ignored, %s support not compiled in", option, feature)
+			f.state.Events.Record(exchange.SeverityWarning, "config", "option "+option+" ignored, "+feature+" support not compiled in")
+		}
+	}
+}
+
+// onNewContainers runs hooks registered by subsystems and extensions for
+//containers discovered in the batch; must be called with the state locked
+func (f *core) onNewContainers(paths map[string]bool) {
+	for _, hook := range f.newContainerHooks {
+		for path := range paths {
+			hook(path)
+		}
+	}
+	for _, hook := range f.hooks.onNewContainer {
+		for path := range paths {
+			if dockerObj, haveDocker := f.state.DockerStorage[path]; haveDocker {
+				hook(path, dockerObj.(map[string]interface{}))
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// batchSummary is one-line record of a processed batch of metrics, written
+//out so snap's log collection can audit publisher's activity
+type batchSummary struct {
+	Timestamp         time.Time `json:"ts"`
+	Metrics           int       `json:"metrics"`
+	ContainersTouched int       `json:"containers_touched"`
+	ContainersNew     int       `json:"containers_new"`
+	ContainersTotal   int       `json:"containers_total"`
+	SamplesAdded      int       `json:"samples_added"`
+	SamplesMerged     int       `json:"samples_merged"`
+}
+
+// batchSummaryOutput gives stream batch summaries are written to,
+//`stdout` or `stderr`; summaries are not written for other values
+func batchSummaryOutput(dest string) io.Writer {
+	switch dest {
+	case "stdout":
+		return os.Stdout
+	case "stderr":
+		return os.Stderr
+	}
+	return nil
+}
+
+func (f *processorContext) writeBatchSummary(metrics, newContainers int) {
+	summary := batchSummary{
+		Timestamp:         time.Now(),
+		Metrics:           metrics,
+		ContainersTouched: len(f.stats_dockersPcsdMap),
+		ContainersNew:     newContainers,
+		ContainersTotal:   len(f.state.DockerStorage),
+		SamplesAdded:      f.samplesAdded,
+		SamplesMerged:     f.samplesMerged,
+	}
+	line, _ := json.Marshal(summary)
+	f.batchSummary.Write(append(line, '\n'))
+}
@@ -21,31 +21,148 @@ package publisher
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
 	"os"
 	"github.com/satori/go.uuid"
 	"path/filepath"
 	"io/ioutil"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+const (
+	tmplMarker      = "__tmpl"
+	staticConstType = "const"
+	staticEnvType   = "env"
 )
 
 type MetricTemplate struct {
+	// rawSource holds template as it was loaded
+	rawSource   string
 	source      string
 	statsSource string
 	ifaceSource string
 	fsSource string
+	machineSource string
 	mapToStats  map[string]map[string]string
 	mapToDocker map[string]map[string]string
 	mapToIface  map[string]map[string]string
 	mapToFs map[string]map[string]string
+	mapToMachine map[string]map[string]string
+	// wildcards match namespaces against wildcard sources, by source
+	wildcards map[string]*sourcePattern
+	// conversions of values parsed from value spec flags, by specConversion
+	conversions map[string]valueConversion
+	// indexes of source paths of the mappings
+	statsIndex   *sourceIndex
+	dockerIndex  *sourceIndex
+	ifaceIndex   *sourceIndex
+	fsIndex      *sourceIndex
+	machineIndex *sourceIndex
+	// objects parsed from the sources once; new objects are deep copies
+	//of them
+	dockerObj  map[string]interface{}
+	statsObj   map[string]interface{}
+	ifaceObj   map[string]interface{}
+	fsObj      map[string]interface{}
+	machineObj map[string]interface{}
+}
+
+// parseSource parses template source into object new objects are
+//copied from
+func parseSource(source []byte) map[string]interface{} {
+	var obj map[string]interface{}
+	json.Unmarshal(source, &obj)
+	return obj
 }
 
+// newObject returns a fresh copy of object parsed from template source,
+//cheaper than parsing the source again
+func newObject(parsed map[string]interface{}) map[string]interface{} {
+	return util.DeepCopy(parsed).(map[string]interface{})
+}
+
+// loadMetricTemplate loads template from the configured location; caller
+//must hold the state lock
 func (f *core) loadMetricTemplate() error {
-	var err error
-	var source string
-	if source, err = f.loadTemplateSource(); err != nil {
+	return f.swapMetricTemplate(f.exportTmplFile)
+}
+
+// swapMetricTemplate loads and validates template found at given location
+//and only then replaces the template in use, along with the location;
+//on error the previous template stays intact. Caller must hold the state
+//lock
+func (f *core) swapMetricTemplate(path string) error {
+	source, modTime, err := f.loadTemplateSource(path)
+	if err != nil {
 		return err
 	}
+	prepared, err := f.prepareMetricTemplate(path, source, modTime)
+	if err != nil {
+		return err
+	}
+	f.installMetricTemplate(prepared)
+	return nil
+}
+
+// preparedTemplate is a metric template parsed and validated, ready to
+//replace the template in use
+type preparedTemplate struct {
+	path           string
+	modTime        time.Time
+	metricTemplate MetricTemplate
+	schema         map[string]interface{}
+}
+
+// prepareMetricTemplate parses and validates template source; it doesn't
+//touch the template in use, so the state lock isn't needed
+func (f *core) prepareMetricTemplate(path, source string, modTime time.Time) (*preparedTemplate, error) {
+	metricTemplate, err := f.parseMetricTemplate(source)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := metricTemplate.buildSchema()
+	if err != nil {
+		return nil, err
+	}
+	return &preparedTemplate{path: path, modTime: modTime, metricTemplate: metricTemplate, schema: schema}, nil
+}
+
+// installMetricTemplate replaces the template in use with prepared one;
+//caller must hold the state lock
+func (f *core) installMetricTemplate(prepared *preparedTemplate) {
+	f.exportTmplFile = prepared.path
+	f.templateModTime = prepared.modTime
+	f.metricTemplate = prepared.metricTemplate
+	f.schema = prepared.schema
+	f.state.Schema, _ = json.MarshalIndent(prepared.schema, "", "  ")
+	f.resetMachineInfo()
+	f.templateLoaded = true
+}
+
+// specFlagString reads flag of value spec given in object form, where
+//numbers (decoded as json.Number) and booleans are accepted along with
+//strings, e.g. "scale": 0.001
+func specFlagString(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("flag %s: expected a string, number or boolean, got %T", key, value)
+}
+
+// parseMetricTemplate builds metric template from its source, without
+//touching the template in use
+func (f *core) parseMetricTemplate(source string) (MetricTemplate, error) {
+	var err error
 	var templateRef interface{}
 	// parse template once for test
 	decoder := json.NewDecoder(strings.NewReader(source))
@@ -53,11 +170,21 @@ func (f *core) loadMetricTemplate() error {
 
 	//if err = json.Unmarshal([]byte(source), &templateRef); err != nil {
 	if err = decoder.Decode(&templateRef); err != nil {
-		return err
+		return MetricTemplate{}, err
+	}
+	if err = checkTemplateStructure(templateRef); err != nil {
+		return MetricTemplate{}, err
 	}
 	templateObj := templateRef.(map[string]interface{})
+	applyStaticFields(templateObj)
+	// machine section describes the node, not containers
+	machineObj, _ := templateObj[machineSection].(map[string]interface{})
+	if machineObj == nil {
+		machineObj = map[string]interface{}{}
+	}
+	delete(templateObj, machineSection)
+	var mappingErr error
 	extractMapping := func(obj interface{}) map[string]map[string]string {
-		const tmplMarker = "__tmpl"
 		mapping := map[string]map[string]string{}
 		tmplWalker := util.NewObjWalker(obj)
 		tmplWalker.Walk("/", func(target string, info os.FileInfo, _ error) error {
@@ -75,10 +202,27 @@ func (f *core) loadMetricTemplate() error {
 				spec["target"] = target
 				valueSpec := map[string]string{}
 				for k, v := range spec {
-					valueSpec[k] = v.(string)
+					flag, err := specFlagString(k, v)
+					if err != nil {
+						if mappingErr == nil {
+							mappingErr = fmt.Errorf("value spec of %s: %v", target, err)
+						}
+						return nil
+					}
+					valueSpec[k] = flag
 				}
-				src := valueSpec["src"]
-				if ellIdx := strings.LastIndex(src, "..."); ellIdx >= 0 {
+				src, err := parseSourceExpr(valueSpec["src"])
+				if err != nil {
+					if mappingErr == nil {
+						mappingErr = err
+					}
+					return nil
+				}
+				valueSpec["src"] = src
+				if specType, haveType := valueSpec["type"]; haveType {
+					valueSpec["type"] = canonicalType(specType)
+				}
+				if ellIdx := strings.LastIndex(src, "..."); ellIdx >= 0 && !isRegexSource(src) {
 					ptrn := ""
 					ptrn, src = src[:ellIdx], src[ellIdx + 3:]
 					ptrn = strings.Replace(ptrn, "...", ".*", -1)
@@ -114,13 +258,18 @@ func (f *core) loadMetricTemplate() error {
 		vp := util.NewValueProvider()
 		for _, spec := range mapping {
 			node, _ := w.Seek(filepath.Dir(spec["target"]))
-			nodeAsMap := node.(map[string]interface{})
-			leafName := filepath.Base(spec["target"])
+			_, inMap := node.(map[string]interface{})
+			// dynamic elements are only known when metrics arrive
+			if root, dynamic := dynamicRoot(spec["target"]); dynamic {
+				w.Delete(root)
+				continue
+			}
 			defVal, gotDefault := vp.GetDefaultOr(spec)
-			if gotDefault {
-				nodeAsMap[leafName] = defVal
+			// list elements keep their positions, holding zero value
+			if gotDefault || !inMap {
+				w.Set(spec["target"], defVal)
 			} else {
-				delete(nodeAsMap, leafName)
+				w.Delete(spec["target"])
 			}
 		}
 	}
@@ -128,27 +277,27 @@ func (f *core) loadMetricTemplate() error {
 	//	//valb, _ := json.MarshalIndent(val, "", "  ")
 	//	//fmt.Printf("%s) %#s\n", pfx, valb)
 	//}
-	statsListRef, _ := util.NewObjWalker(templateObj).Seek("/stats")
-	statsList := statsListRef.([]interface{})
-	var statsObj interface{}
-	statsObj, statsList = statsList[0], statsList[1:]
-	map[string]interface{}(templateObj)["stats"] = statsList
-
-	ifaceListRef, _ := util.NewObjWalker(statsObj).Seek("/network/interfaces")
-	ifaceList := ifaceListRef.([]interface{})
-	var ifaceObj interface{}
-	ifaceObj, ifaceList = ifaceList[0], ifaceList[1:]
-	networkRef, _ := util.NewObjWalker(statsObj).Seek("/network")
-	network := networkRef.(map[string]interface{})
-	network["interfaces"] = map[string]interface{}{}
+	// pop templates of stats, interfaces and filesystems from their lists
+	templateWalker := util.NewObjWalker(templateObj)
+	statsObj, _ := templateWalker.Seek("/stats/0")
+	templateWalker.Delete("/stats/0")
+
+	statsWalker := util.NewObjWalker(statsObj)
+	ifaceObj, _ := statsWalker.Seek("/network/interfaces/0")
+	statsWalker.Set("/network/interfaces", map[string]interface{}{})
 
 	// convert filesystem list to a map
-	fsListRef, _ := util.NewObjWalker(statsObj).Seek("/filesystem")
-	fsList := fsListRef.([]interface{})
-	var fsObj interface{}
-	fsObj, fsList = fsList[0], fsList[1:]
+	fsObj, _ := statsWalker.Seek("/filesystem/0")
+	statsWalker.Set("/filesystem", map[string]interface{}{})
 	statsMap := statsObj.(map[string]interface{})
-	statsMap["filesystem"] = map[string]interface{} {}
+
+	f.pruneDisabledGroups(templateObj, statsMap)
+	if f.disabledGroups[groupNetwork] {
+		ifaceObj = map[string]interface{}{}
+	}
+	if f.disabledGroups[groupFilesystem] {
+		fsObj = map[string]interface{}{}
+	}
 
 	// extract template mappings
 	////FIXME:REMOVEIT
@@ -159,6 +308,18 @@ func (f *core) loadMetricTemplate() error {
 	mapToDocker := extractMapping(templateObj)
 	mapToIface := extractMapping(ifaceObj)
 	mapToFs := extractMapping(fsObj)
+	mapToMachine := extractMapping(machineObj)
+	if mappingErr != nil {
+		return MetricTemplate{}, mappingErr
+	}
+	wildcards, err := compileWildcards(mapToStats, mapToDocker, mapToIface, mapToFs, mapToMachine)
+	if err != nil {
+		return MetricTemplate{}, err
+	}
+	conversions, err := parseConversions(mapToStats, mapToDocker, mapToIface, mapToFs, mapToMachine)
+	if err != nil {
+		return MetricTemplate{}, err
+	}
 	////FIXME:REMOVEIT
 	//pri("\n\n\nthe mapToStats", mapToStats)
 	//pri("\nthe mapToDocker", mapToDocker)
@@ -169,6 +330,7 @@ func (f *core) loadMetricTemplate() error {
 	applyDefaults(templateObj, mapToDocker)
 	applyDefaults(ifaceObj, mapToIface)
 	applyDefaults(fsObj, mapToFs)
+	applyDefaults(machineObj, mapToMachine)
 	////FIXME:REMOVEIT
 	//pri("\n\n\nthe statsObj-1", statsObj)
 	//pri("\nthe templateObj-1", templateObj)
@@ -178,33 +340,161 @@ func (f *core) loadMetricTemplate() error {
 	dockerTemplate, _ := json.Marshal(templateObj)
 	ifaceTemplate, _ := json.Marshal(ifaceObj)
 	fsTemplate, _ := json.Marshal(fsObj)
-	f.metricTemplate = MetricTemplate{
+	machineTemplate, _ := json.Marshal(machineObj)
+	metricTemplate := MetricTemplate{
+		rawSource:   source,
 		source:      string(dockerTemplate),
 		statsSource: string(statsTemplate),
 		ifaceSource: string(ifaceTemplate),
 		fsSource: string(fsTemplate),
+		machineSource: string(machineTemplate),
 		mapToStats:  mapToStats,
 		mapToDocker: mapToDocker,
 		mapToIface:  mapToIface,
 		mapToFs: mapToFs,
+		mapToMachine: mapToMachine,
+		wildcards: wildcards,
+		conversions: conversions,
+		statsIndex:   newSourceIndex(mapToStats, wildcards),
+		dockerIndex:  newSourceIndex(mapToDocker, wildcards),
+		ifaceIndex:   newSourceIndex(mapToIface, wildcards),
+		fsIndex:      newSourceIndex(mapToFs, wildcards),
+		machineIndex: newSourceIndex(mapToMachine, wildcards),
+		dockerObj:  parseSource(dockerTemplate),
+		statsObj:   parseSource(statsTemplate),
+		ifaceObj:   parseSource(ifaceTemplate),
+		fsObj:      parseSource(fsTemplate),
+		machineObj: parseSource(machineTemplate),
 	}
+	return metricTemplate, nil
+}
+
+// applyStaticFields replaces value specs of `const` and `env` types with
+//values evaluated once, at template load: `const` field takes the default
+//given by its spec, `env` field the value of environment variable named
+//by spec's source, falling back to the default
+func applyStaticFields(templateObj interface{}) {
+	type staticField struct {
+		target string
+		value  string
+		omit   bool
+	}
+	fields := []staticField{}
+	util.NewObjWalker(templateObj).Walk("/", func(target string, info os.FileInfo, _ error) error {
+		spec, isMap := info.Sys().(map[string]interface{})
+		pureMap := isMap
+		if !isMap {
+			spec, isMap = util.ExtractCompactValueSpec(info.Sys())
+		}
+		if !isMap {
+			return nil
+		}
+		if _, isSpec := spec[tmplMarker]; !isSpec {
+			return nil
+		}
+		specType, _ := spec["type"].(string)
+		if specType != staticConstType && specType != staticEnvType {
+			if pureMap {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		field := staticField{target: target}
+		defValue, haveDefault := spec["default"].(string)
+		_, noDefault := spec["no_default"]
+		field.value, field.omit = defValue, !haveDefault || noDefault
+		if specType == staticEnvType {
+			envName, _ := spec["src"].(string)
+			if envValue, haveEnv := os.LookupEnv(strings.TrimPrefix(envName, "/")); haveEnv {
+				field.value, field.omit = envValue, false
+			}
+		}
+		fields = append(fields, field)
+		if pureMap {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	w := util.NewObjWalker(templateObj)
+	for _, field := range fields {
+		node, _ := w.Seek(filepath.Dir(field.target))
+		nodeAsMap, isMap := node.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		leafName := filepath.Base(field.target)
+		if field.omit {
+			delete(nodeAsMap, leafName)
+		} else {
+			nodeAsMap[leafName] = field.value
+		}
+	}
+}
+
+// pruneDisabledGroups removes disabled metric groups from the template,
+//so they are neither processed nor served
+func (f *core) pruneDisabledGroups(templateObj, statsMap map[string]interface{}) {
+	specMap, _ := templateObj["spec"].(map[string]interface{})
+	for group, disabled := range f.disabledGroups {
+		if !disabled {
+			continue
+		}
+		delete(statsMap, group)
+		if specMap != nil {
+			specMap["has_"+group] = false
+		}
+	}
+}
+
+// ReloadMetricTemplate loads the metric template again from its configured
+//location at runtime; template is validated first and swapped only if
+//it's valid, otherwise error is returned and the previous template is kept
+func (f *core) ReloadMetricTemplate() error {
+	path := f.templateLocation
+	if err := f.reloadMetricTemplate(path); err != nil {
+		f.state.Events.Record(exchange.SeverityError, "template_load", err.Error())
+		return err
+	}
+	f.state.Readiness.SetReady("template")
+	f.state.Events.Record(exchange.SeverityInfo, "template_load", "loaded metric template from "+path)
 	return nil
 }
 
-func (f *core) LoadMetricTemplate(path string) {
-	f.exportTmplFile = path
-	if err := f.loadMetricTemplate(); err != nil {
-		panic(err)
+// reloadMetricTemplate fetches (or reads) and validates template found at
+//given location without holding the state lock, which is taken only to
+//install the template
+func (f *core) reloadMetricTemplate(path string) error {
+	source, modTime, err := f.loadTemplateSource(path)
+	if err != nil {
+		return err
 	}
+	prepared, err := f.prepareMetricTemplate(path, source, modTime)
+	if err != nil {
+		return err
+	}
+	f.state.Lock()
+	defer f.state.Unlock()
+	f.installMetricTemplate(prepared)
+	f.publishReadModel()
+	return nil
 }
 
-func (f *core) loadTemplateSource() (string, error) {
-	if f.exportTmplFile == defExportTmplFile {
+// loadTemplateSource reads template source from given location, along
+//with modification time of template file
+func (f *core) loadTemplateSource(path string) (string, time.Time, error) {
+	if path == defExportTmplFile {
 		templateSrc := builtinMetricTemplate
-		return templateSrc, nil
-	} else if templateSrc, err := ioutil.ReadFile(f.exportTmplFile); err != nil {
-		return "", err
+		return templateSrc, time.Time{}, nil
+	} else if isTemplateUrl(path) {
+		templateSrc, err := f.templateFetcher.fetch(path)
+		return templateSrc, time.Time{}, err
+	} else if templateSrc, err := ioutil.ReadFile(path); err != nil {
+		return "", time.Time{}, err
 	} else {
-		return string(templateSrc), nil
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		return string(templateSrc), modTime, nil
 	}
 }
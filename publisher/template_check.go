@@ -0,0 +1,142 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// templateNodeKind tells what kind of node the code expects at a path
+//of the metric template
+type templateNodeKind int
+
+const (
+	templateAnyNode templateNodeKind = iota
+	templateObjectNode
+	templateListNode
+	// templateElementsNode is a list holding template of its elements as
+	//the first element
+	templateElementsNode
+)
+
+// templateExpectation is a structural path of the metric template the
+//code relies on; list elements are addressed by index 0
+type templateExpectation struct {
+	path []string
+	kind templateNodeKind
+}
+
+var templateExpectations = []templateExpectation{
+	{[]string{"id"}, templateAnyNode},
+	{[]string{"name"}, templateAnyNode},
+	{[]string{"spec"}, templateObjectNode},
+	{[]string{"spec", "custom_metrics"}, templateListNode},
+	{[]string{"stats"}, templateElementsNode},
+	{[]string{"stats", "0"}, templateObjectNode},
+	{[]string{"stats", "0", "timestamp"}, templateAnyNode},
+	{[]string{"stats", "0", "network"}, templateObjectNode},
+	{[]string{"stats", "0", "network", "interfaces"}, templateElementsNode},
+	{[]string{"stats", "0", "network", "interfaces", "0"}, templateObjectNode},
+	{[]string{"stats", "0", "filesystem"}, templateElementsNode},
+	{[]string{"stats", "0", "filesystem", "0"}, templateObjectNode},
+	{[]string{"stats", "0", groupCustomMetrics}, templateObjectNode},
+}
+
+func init() {
+	if err := checkBuiltinTemplate(); err != nil {
+		panic(err)
+	}
+}
+
+// checkBuiltinTemplate verifies the builtin template at startup, so its
+//refactors can't break processing of metrics later
+func checkBuiltinTemplate() error {
+	var templateObj interface{}
+	decoder := json.NewDecoder(strings.NewReader(builtinMetricTemplate))
+	decoder.UseNumber()
+	if err := decoder.Decode(&templateObj); err != nil {
+		return fmt.Errorf("builtin metric template is not valid JSON: %v", err)
+	}
+	if err := checkTemplateStructure(templateObj); err != nil {
+		return fmt.Errorf("builtin metric template: %v", err)
+	}
+	return nil
+}
+
+// checkTemplateStructure verifies that metric template holds all nodes
+//the code expects, reporting every missing or mistyped one
+func checkTemplateStructure(templateObj interface{}) error {
+	problems := []string{}
+	for _, expectation := range templateExpectations {
+		if problem := expectation.check(templateObj); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid template structure: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// check returns description of violated expectation, or empty string;
+//violations of parent paths are reported by their own expectations
+func (e templateExpectation) check(templateObj interface{}) string {
+	node := templateObj
+	for idx, elem := range e.path {
+		switch parent := node.(type) {
+		case map[string]interface{}:
+			if elem == "0" {
+				// expected list is reported by its own expectation
+				return ""
+			}
+			node = parent[elem]
+		case []interface{}:
+			if elem != "0" || len(parent) == 0 {
+				return ""
+			}
+			node = parent[0]
+		default:
+			return ""
+		}
+		if node == nil {
+			if idx == len(e.path)-1 {
+				return fmt.Sprintf("/%s is missing", strings.Join(e.path, "/"))
+			}
+			return ""
+		}
+	}
+	switch e.kind {
+	case templateObjectNode:
+		if _, isMap := node.(map[string]interface{}); !isMap {
+			return fmt.Sprintf("/%s must be an object", strings.Join(e.path, "/"))
+		}
+	case templateListNode:
+		if _, isList := node.([]interface{}); !isList {
+			return fmt.Sprintf("/%s must be a list", strings.Join(e.path, "/"))
+		}
+	case templateElementsNode:
+		if list, isList := node.([]interface{}); !isList || len(list) == 0 {
+			return fmt.Sprintf("/%s must be a list holding template of its elements", strings.Join(e.path, "/"))
+		}
+	}
+	return ""
+}
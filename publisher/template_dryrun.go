@@ -0,0 +1,95 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CheckTemplate loads the template found at given location ("builtin" for
+//builtin template) the way publisher does, without starting it; returns
+//resolved source->target mappings, one per line, and a list of problems
+//found. Error is returned only if the template could not be loaded at all
+func CheckTemplate(templateFile string) (mappings []string, problems []string, err error) {
+	core, _ := NewCore()
+	source, _, err := core.loadTemplateSource(templateFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	metricTemplate, err := core.parseTemplateSafely(source)
+	if err != nil {
+		return nil, []string{err.Error()}, nil
+	}
+	sections := []struct {
+		name    string
+		mapping map[string]map[string]string
+	}{
+		{"container", metricTemplate.mapToDocker},
+		{"stats", metricTemplate.mapToStats},
+		{"interface", metricTemplate.mapToIface},
+		{"filesystem", metricTemplate.mapToFs},
+		{"machine", metricTemplate.mapToMachine},
+	}
+	for _, section := range sections {
+		lines := []string{}
+		for _, spec := range section.mapping {
+			if spec["src"] == "" {
+				problems = append(problems, fmt.Sprintf("%s: no source given for %s", section.name, spec["target"]))
+			}
+			lines = append(lines, describeMapping(section.name, spec))
+		}
+		sort.Strings(lines)
+		mappings = append(mappings, lines...)
+	}
+	if _, schemaErr := metricTemplate.buildSchema(); schemaErr != nil {
+		problems = append(problems, fmt.Sprintf("schema: %v", schemaErr))
+	}
+	return mappings, problems, nil
+}
+
+// parseTemplateSafely parses template source, reporting a panic raised
+//by malformed template as an error
+func (f *core) parseTemplateSafely(source string) (metricTemplate MetricTemplate, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed template: %v", r)
+		}
+	}()
+	return f.parseMetricTemplate(source)
+}
+
+// describeMapping renders a value spec as a single line of the form
+//`section: source -> target`, followed by type and default, if any
+func describeMapping(section string, spec map[string]string) string {
+	src := spec["src"]
+	if ptrn, gotPtrn := spec["ptrn"]; gotPtrn {
+		src = ptrn + "..." + src
+	}
+	line := fmt.Sprintf("%s: %s -> %s", section, src, spec["target"])
+	if typ, gotType := spec["type"]; gotType {
+		line += fmt.Sprintf(" [%s]", typ)
+	}
+	if def, gotDefault := spec["default"]; gotDefault {
+		line += fmt.Sprintf(" (default %s)", def)
+	}
+	return line
+}
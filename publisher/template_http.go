@@ -0,0 +1,118 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const templateFetchTimeout = 30 * time.Second
+
+// templateFetcher downloads export template from an http(s) URL, keeping
+//the last copy so it can be revalidated with ETag
+type templateFetcher struct {
+	client     *http.Client
+	authHeader string
+	// authHost is the host of configured template URL, the only one
+	//auth header is sent to
+	authHost string
+	// lock serializes fetches, which are done without the state lock
+	lock   sync.Mutex
+	url    string
+	etag   string
+	cached string
+}
+
+func isTemplateUrl(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+func newTemplateFetcher(authHeader, templateUrl string) *templateFetcher {
+	t := &templateFetcher{authHeader: authHeader}
+	if parsed, err := neturl.Parse(templateUrl); err == nil && isTemplateUrl(templateUrl) {
+		t.authHost = parsed.Host
+	}
+	t.client = &http.Client{Timeout: templateFetchTimeout, CheckRedirect: t.checkRedirect}
+	return t
+}
+
+// checkRedirect keeps auth header from leaking to hosts the template
+//server redirects to
+func (t *templateFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.URL.Host != t.authHost {
+		if kv := strings.SplitN(t.authHeader, ":", 2); len(kv) == 2 {
+			req.Header.Del(strings.TrimSpace(kv[0]))
+		}
+	}
+	return nil
+}
+
+// fetch returns template source found at url; cached copy is served if
+//the server reports it as not modified
+func (t *templateFetcher) fetch(url string) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if url != t.url {
+		t.url, t.etag, t.cached = url, "", ""
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	if t.authHeader != "" && req.URL.Host == t.authHost {
+		kv := strings.SplitN(t.authHeader, ":", 2)
+		if len(kv) != 2 {
+			// header holds credentials, so it's not echoed
+			return "", fmt.Errorf("Malformed auth header, expected 'Name: value'")
+		}
+		req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	if t.etag != "" {
+		req.Header.Set("If-None-Match", t.etag)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return t.cached, nil
+	case http.StatusOK:
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		t.etag = resp.Header.Get("ETag")
+		t.cached = string(body)
+		return t.cached, nil
+	default:
+		return "", fmt.Errorf("Failed to fetch template from %s: %s", url, resp.Status)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"sort"
+	"strings"
+)
+
+// sourceIndex finds source paths of a mapping which metric namespace ends
+//with, looking up suffixes of namespace instead of testing every source
+//path; namespace is matched element by element, so elements holding
+//separators are matched whole
+type sourceIndex struct {
+	// exact holds source paths starting at an element boundary, by their
+	//elements read from the last one
+	exact *suffixNode
+	// partial holds the remaining source paths, tested one by one
+	partial []partialSource
+	// wildcards holds keys of wildcard and regex value specs
+	wildcards []string
+}
+
+// suffixNode is a node of the tree of source paths' elements; sourcePath
+//is set if elements leading to the node form a source path
+type suffixNode struct {
+	children   map[string]*suffixNode
+	sourcePath string
+}
+
+// partialSource is a source path not starting with `/`, which its first
+//element may match the end of namespace element only
+type partialSource struct {
+	sourcePath string
+	elements   []string
+}
+
+// sourceElements splits source path into its elements
+func sourceElements(sourcePath string) []string {
+	return strings.Split(strings.TrimPrefix(sourcePath, "/"), "/")
+}
+
+// newSourceIndex indexes source paths of mapping; aliases are reached
+//through their root source paths only
+func newSourceIndex(mapping map[string]map[string]string, wildcards map[string]*sourcePattern) *sourceIndex {
+	aliases := map[string]bool{}
+	for _, spec := range mapping {
+		if aliasList, haveAliases := spec["aliases"]; haveAliases {
+			for _, alias := range strings.Split(aliasList, ":") {
+				aliases[alias] = true
+			}
+		}
+	}
+	index := &sourceIndex{exact: &suffixNode{}}
+	for key, spec := range mapping {
+		if _, isWildcard := wildcards[spec["src"]]; isWildcard {
+			index.wildcards = append(index.wildcards, key)
+			continue
+		}
+		switch {
+		case aliases[key]:
+		case strings.HasPrefix(key, "/"):
+			index.exact.add(sourceElements(key), key)
+		default:
+			index.partial = append(index.partial, partialSource{sourcePath: key, elements: sourceElements(key)})
+		}
+	}
+	sort.Sort(partialSources(index.partial))
+	sort.Strings(index.wildcards)
+	return index
+}
+
+func (n *suffixNode) add(elements []string, sourcePath string) {
+	for i := len(elements) - 1; i >= 0; i-- {
+		if n.children == nil {
+			n.children = map[string]*suffixNode{}
+		}
+		child, exists := n.children[elements[i]]
+		if !exists {
+			child = &suffixNode{}
+			n.children[elements[i]] = child
+		}
+		n = child
+	}
+	n.sourcePath = sourcePath
+}
+
+// lookup returns the longest source path namespace ends with; cost depends
+//on depth of namespace, not on size of the mapping
+func (x *sourceIndex) lookup(ns []string) (string, bool) {
+	if x == nil {
+		return "", false
+	}
+	longest, node := "", x.exact
+	for i := len(ns) - 1; i >= 0; i-- {
+		if node = node.children[ns[i]]; node == nil {
+			break
+		}
+		if node.sourcePath != "" {
+			longest = node.sourcePath
+		}
+	}
+	if longest != "" {
+		return longest, true
+	}
+	for _, partial := range x.partial {
+		if _, matched := endsWithElements(ns, partial.elements, false); matched {
+			return partial.sourcePath, true
+		}
+	}
+	return "", false
+}
+
+// endsWithElements tells if namespace ends with given source elements,
+//returning namespace elements matched by wildcards; unless anchored, the
+//first source element may match the end of namespace element only
+func endsWithElements(ns, elements []string, anchored bool) ([]string, bool) {
+	offset := len(ns) - len(elements)
+	if offset < 0 {
+		return nil, false
+	}
+	captured := []string{}
+	for i, element := range elements {
+		nsElement := ns[offset+i]
+		switch {
+		case element == wildcardElement:
+			captured = append(captured, nsElement)
+		case i == 0 && !anchored:
+			if !strings.HasSuffix(nsElement, element) {
+				return nil, false
+			}
+		case nsElement != element:
+			return nil, false
+		}
+	}
+	return captured, true
+}
+
+type partialSources []partialSource
+
+func (p partialSources) Len() int           { return len(p) }
+func (p partialSources) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p partialSources) Less(i, j int) bool { return p[i].sourcePath < p[j].sourcePath }
+
+// wildcardKeys returns keys of wildcard and regex value specs, in order
+func (x *sourceIndex) wildcardKeys() []string {
+	if x == nil {
+		return nil
+	}
+	return x.wildcards
+}
@@ -0,0 +1,281 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// wildcardElement in value spec source matches any single element
+	//of metric namespace; as the last element of target it's replaced by
+	//matched elements
+	wildcardElement = "*"
+	// regexSourcePrefix marks value spec source given as regular
+	//expression, matched against the end of metric namespace
+	regexSourcePrefix = "~"
+	// wildcardSep separates key of wildcard value spec from resolved
+	//target in source paths matched against the template
+	wildcardSep = "\x00"
+	// specStaticTarget names the part of resolved target found in the
+	//template, i.e. preceding the first dynamic element; elements below
+	//it are created as metrics arrive
+	specStaticTarget = "static_target"
+)
+
+// parseSourceExpr converts JSONPath-like source expression of a value
+//spec, e.g. `$.cgroups.cpu_stats.*` or `$..rx_bytes`, to the slash
+//separated form, where recursive descent (`..`) becomes the ellipsis;
+//sources not starting with `$` are returned intact
+func parseSourceExpr(src string) (string, error) {
+	if !strings.HasPrefix(src, "$") {
+		return src, nil
+	}
+	elements := []string{}
+	rest := src[1:]
+	for rest != "" {
+		if strings.HasPrefix(rest, "..") {
+			elements = append(elements, "...")
+			rest = rest[2:]
+		} else if rest[0] == '.' {
+			rest = rest[1:]
+		} else if rest[0] != '[' {
+			return "", fmt.Errorf("invalid source expression %q: expected '.' or '[' at %q", src, rest)
+		}
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return "", fmt.Errorf("invalid source expression %q: unterminated '['", src)
+			}
+			elements = append(elements, strings.Trim(rest[1:end], `'"`))
+			rest = rest[end+1:]
+			continue
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return "", fmt.Errorf("invalid source expression %q: empty element", src)
+		}
+		elements = append(elements, rest[:end])
+		rest = rest[end:]
+	}
+	if len(elements) == 0 || elements[len(elements)-1] == "..." {
+		return "", fmt.Errorf("invalid source expression %q: no element selected", src)
+	}
+	return "/" + strings.Join(elements, "/"), nil
+}
+
+// isRegexSource tells if value spec source is a regular expression
+func isRegexSource(src string) bool {
+	return strings.HasPrefix(src, regexSourcePrefix)
+}
+
+// isDynamicElement tells if target element is resolved from matched
+//metric namespace, being a wildcard or referring to capture groups
+func isDynamicElement(element string) bool {
+	return element == wildcardElement || strings.Contains(element, "$")
+}
+
+// dynamicRoot returns target up to its first dynamic element, inclusive,
+//telling whether target has any
+func dynamicRoot(target string) (string, bool) {
+	elements := strings.Split(target, "/")
+	for i, element := range elements {
+		if isDynamicElement(element) {
+			return strings.Join(elements[:i+1], "/"), true
+		}
+	}
+	return target, false
+}
+
+// isWildcardSource tells if value spec source has wildcard elements
+func isWildcardSource(src string) bool {
+	if isRegexSource(src) {
+		return false
+	}
+	for _, element := range strings.Split(src, "/") {
+		if element == wildcardElement {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWildcardSpec verifies that only the last element of target may be
+//a wildcard and that value spec with wildcard source has target ending
+//with wildcard, and vice versa; any elements of regex source's target
+//may refer to capture groups of the expression (`$1`, `${name}`)
+func checkWildcardSpec(spec map[string]string) error {
+	target, src := spec["target"], spec["src"]
+	leaf := path.Base(target)
+	_, dynamic := dynamicRoot(target)
+	switch {
+	case strings.Contains(path.Dir(target)+"/", "/"+wildcardElement+"/"):
+		return fmt.Errorf("only the last element of target may be a wildcard: %s", target)
+	case isRegexSource(src):
+		return nil
+	case isWildcardSource(src) && leaf != wildcardElement:
+		return fmt.Errorf("source %s has wildcard, but target %s doesn't end with it", src, target)
+	case isWildcardSource(src) && strings.Contains(target, "$"):
+		return fmt.Errorf("target %s refers to capture groups, but source %s is not a regular expression", target, src)
+	case dynamic && !isWildcardSource(src):
+		return fmt.Errorf("target %s is resolved dynamically, but source %s has no wildcard", target, src)
+	}
+	return nil
+}
+
+// sourcePattern matches metric namespace against wildcard or regex source;
+//wildcard sources are matched element by element, while regular
+//expressions are matched against namespace joined with `/`
+type sourcePattern struct {
+	elements []string
+	anchored bool
+	regex    *regexp.Regexp
+}
+
+// match tells if metric namespace matches the source, returning captured
+//parts of namespace (elements matched by wildcards, or groups of the
+//expression) and function expanding references to groups
+func (p *sourcePattern) match(metric *Metric) ([]string, func(string) string, bool) {
+	if p.regex == nil {
+		captured, matched := endsWithElements(metric.Namespace, p.elements, p.anchored)
+		return captured, nil, matched
+	}
+	ns := metric.NamespaceString()
+	indices := p.regex.FindStringSubmatchIndex(ns)
+	if indices == nil {
+		return nil, nil, false
+	}
+	captured := []string{}
+	for i := 2; i+1 < len(indices); i += 2 {
+		if indices[i] >= 0 {
+			captured = append(captured, ns[indices[i]:indices[i+1]])
+		}
+	}
+	expand := func(template string) string {
+		return string(p.regex.ExpandString(nil, template, ns, indices))
+	}
+	return captured, expand, true
+}
+
+// compileWildcards builds patterns matching metric namespaces against
+//wildcard and regex sources of given mappings, keyed by source
+func compileWildcards(mappings ...map[string]map[string]string) (map[string]*sourcePattern, error) {
+	wildcards := map[string]*sourcePattern{}
+	for _, mapping := range mappings {
+		for _, spec := range mapping {
+			if err := checkWildcardSpec(spec); err != nil {
+				return nil, err
+			}
+			src := spec["src"]
+			if _, compiled := wildcards[src]; compiled {
+				continue
+			}
+			if isRegexSource(src) {
+				matcher, err := regexp.Compile("(?:" + strings.TrimPrefix(src, regexSourcePrefix) + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("invalid source expression %s: %v", src, err)
+				}
+				wildcards[src] = &sourcePattern{regex: matcher}
+				continue
+			}
+			if !isWildcardSource(src) {
+				continue
+			}
+			wildcards[src] = &sourcePattern{elements: sourceElements(src), anchored: strings.HasPrefix(src, "/")}
+		}
+	}
+	return wildcards, nil
+}
+
+// matchWildcards returns source paths of wildcard and regex value specs
+//matching metric namespace, with resolved targets attached; wildcard leaf
+//is replaced by captured elements, joined with `_`, and elements referring
+//to capture groups are expanded
+func (f *processorContext) matchWildcards(metric *Metric, mapping map[string]map[string]string, index *sourceIndex) []string {
+	sourcePaths := []string{}
+	for _, key := range index.wildcardKeys() {
+		spec := mapping[key]
+		pattern, isWildcard := f.metricTemplate.wildcards[spec["src"]]
+		if !isWildcard {
+			continue
+		}
+		captured, expand, matched := pattern.match(metric)
+		if !matched {
+			continue
+		}
+		if ptrn, havePtrn := spec["ptrn"]; havePtrn {
+			if matched, err := regexp.MatchString(ptrn, metric.NamespaceString()); !matched || err != nil {
+				continue
+			}
+		}
+		if target, resolved := resolveTarget(spec["target"], captured, expand); resolved {
+			sourcePaths = append(sourcePaths, key+wildcardSep+target)
+		}
+	}
+	return sourcePaths
+}
+
+// resolveTarget resolves dynamic elements of target from captured parts
+//of metric namespace; target is not resolved if any element ends up empty
+//or would split into several
+func resolveTarget(target string, captured []string, expand func(string) string) (string, bool) {
+	elements := strings.Split(target, "/")
+	for i, element := range elements {
+		switch {
+		case element == wildcardElement:
+			element = strings.Join(captured, "_")
+		case isDynamicElement(element) && expand != nil:
+			element = expand(element)
+		default:
+			continue
+		}
+		if element == "" || strings.Contains(element, "/") {
+			return "", false
+		}
+		elements[i] = element
+	}
+	return strings.Join(elements, "/"), true
+}
+
+// lookupSpec returns value spec for the source path reported by
+//validateMetricWithMap; wildcard spec gets resolved target, along with
+//the part of it found in the template
+func lookupSpec(mapping map[string]map[string]string, sourcePath string) map[string]string {
+	sep := strings.Index(sourcePath, wildcardSep)
+	if sep < 0 {
+		return mapping[sourcePath]
+	}
+	spec := mapping[sourcePath[:sep]]
+	resolved := make(map[string]string, len(spec))
+	for k, v := range spec {
+		resolved[k] = v
+	}
+	resolved["target"] = sourcePath[sep+1:]
+	root, _ := dynamicRoot(spec["target"])
+	resolved[specStaticTarget] = path.Dir(root)
+	return resolved
+}
@@ -0,0 +1,132 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/intelsdi-x/snap/core/ctypes"
+)
+
+func TestCheckWildcardSpec(t *testing.T) {
+	valid := []map[string]string{
+		{"target": "/net/${1}/rx", "src": "~/network/([^/]+)/rx_bytes"},
+		{"target": "/${dev}/${1}_usage", "src": "~/(?P<dev>[^/]+)/([^/]+)/usage"},
+		{"target": "/cpu_stats/*", "src": "/cgroups/cpu_stats/*"},
+	}
+	for _, spec := range valid {
+		if err := checkWildcardSpec(spec); err != nil {
+			t.Errorf("valid spec %v rejected: %v", spec, err)
+		}
+	}
+	invalid := []map[string]string{
+		{"target": "/*/rx", "src": "~/network/([^/]+)/rx_bytes"},
+		{"target": "/net/${1}/rx", "src": "/network/*/rx_bytes"},
+		{"target": "/net/${1}/rx", "src": "/network/eth0/rx_bytes"},
+		{"target": "/cpu_stats/usage", "src": "/cgroups/cpu_stats/*"},
+	}
+	for _, spec := range invalid {
+		if err := checkWildcardSpec(spec); err == nil {
+			t.Errorf("invalid spec %v accepted", spec)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	regex := &sourcePattern{regex: regexp.MustCompile("(?:/(?P<dev>[^/]+)/([^/]*)/usage)$")}
+	wildcard := &sourcePattern{elements: sourceElements("/filesystem/*/*/usage"), anchored: true}
+	cases := []struct {
+		pattern  *sourcePattern
+		target   string
+		ns       []string
+		want     string
+		resolved bool
+	}{
+		{regex, "/fs/${dev}/${2}", []string{"filesystem", "sda", "root", "usage"}, "/fs/sda/root", true},
+		{regex, "/fs/${2}/usage", []string{"filesystem", "sda", "root", "usage"}, "/fs/root/usage", true},
+		{regex, "/fs/*", []string{"filesystem", "sda", "root", "usage"}, "/fs/sda_root", true},
+		{regex, "/fs/${2}/usage", []string{"filesystem", "sda", "", "usage"}, "", false},
+		{wildcard, "/fs/*", []string{"filesystem", "sda", "root", "usage"}, "/fs/sda_root", true},
+		{wildcard, "/fs/*", []string{"filesystem", "dev/sda", "root", "usage"}, "", false},
+	}
+	for _, c := range cases {
+		metric := &Metric{Namespace: c.ns}
+		captured, expand, matched := c.pattern.match(metric)
+		if !matched {
+			t.Fatalf("%s not matched", metric.NamespaceString())
+		}
+		got, resolved := resolveTarget(c.target, captured, expand)
+		if got != c.want || resolved != c.resolved {
+			t.Errorf("target %s of %v resolved to %q (%v), want %q (%v)", c.target, c.ns, got, resolved, c.want, c.resolved)
+		}
+	}
+}
+
+func TestSourceIndexMatchesElements(t *testing.T) {
+	mapping := map[string]map[string]string{
+		"/rx_bytes":         {"src": "/rx_bytes"},
+		"/network/rx_bytes": {"src": "/network/rx_bytes"},
+		"usage/total_usage": {"src": "usage/total_usage"},
+		"/cpu_stats/cpu/*":  {"src": "/cpu_stats/cpu/*"},
+	}
+	wildcards, err := compileWildcards(map[string]map[string]string{"/cpu_stats/cpu/*": {"src": "/cpu_stats/cpu/*", "target": "/cpu/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newSourceIndex(mapping, wildcards)
+	cases := []struct {
+		ns      []string
+		want    string
+		matched bool
+	}{
+		{[]string{"intel", "docker", "id", "network", "rx_bytes"}, "/network/rx_bytes", true},
+		{[]string{"intel", "docker", "id", "eth/network", "rx_bytes"}, "/rx_bytes", true},
+		{[]string{"intel", "docker", "id", "cpu_usage", "total_usage"}, "usage/total_usage", true},
+		{[]string{"intel", "docker", "id", "usage/total_usage"}, "", false},
+		{[]string{"intel", "docker", "id", "cpu_stats", "cpu", "0"}, "", false},
+	}
+	for _, c := range cases {
+		got, matched := index.lookup(c.ns)
+		if got != c.want || matched != c.matched {
+			t.Errorf("lookup of %v gave %q (%v), want %q (%v)", c.ns, got, matched, c.want, c.matched)
+		}
+	}
+	if keys := index.wildcardKeys(); len(keys) != 1 || keys[0] != "/cpu_stats/cpu/*" {
+		t.Errorf("wildcard keys %v, want [/cpu_stats/cpu/*]", keys)
+	}
+}
+
+func TestRegexResolverMetricIndex(t *testing.T) {
+	resolver, err := newRegexResolver(ConfigMap{
+		cfgResolverRegex: ctypes.ConfigValueStr{Value: "^/intel/docker/(?P<id>[^/]+)/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metric := &Metric{Namespace: []string{"intel", "docker", "abc", "network", "eth/0", "rx_bytes"}}
+	id, _, metricIdx, ok := resolver.(*regexResolver).resolveElements(metric)
+	if !ok || id != "abc" {
+		t.Fatalf("metric resolved to %q (%v), want abc", id, ok)
+	}
+	if metricIdx != 3 {
+		t.Errorf("metric starts at element %d, want 3", metricIdx)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// watchTemplate periodically checks if the template changed and reloads
+//it; template file is checked by its modification time, template URL
+//is fetched and compared with the loaded template
+func (f *core) watchTemplate(interval time.Duration) {
+	f.tick(interval, func(time.Time) {
+		f.reloadTemplateIfChanged()
+	})
+}
+
+// reloadTemplateIfChanged fetches template source once, compares it with
+// the loaded template and parses the same source if it changed; the state
+// is locked only to read the loaded template and to install the new one
+func (f *core) reloadTemplateIfChanged() {
+	f.state.Lock()
+	path := f.templateLocation
+	loaded := f.templateLoaded && f.exportTmplFile == path
+	rawSource, loadedModTime := f.metricTemplate.rawSource, f.templateModTime
+	f.state.Unlock()
+	if !loaded {
+		// initial load is still being retried, possibly with the builtin
+		//template serving as fallback meanwhile
+		return
+	}
+	var source string
+	var modTime time.Time
+	if isTemplateUrl(path) {
+		var err error
+		if source, err = f.templateFetcher.fetch(path); err != nil || source == rawSource {
+			return
+		}
+	} else {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(loadedModTime) {
+			return
+		}
+		modTime = info.ModTime()
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return
+		}
+		source = string(content)
+	}
+	prepared, err := f.prepareMetricTemplate(path, source, modTime)
+	f.state.Lock()
+	defer f.state.Unlock()
+	if f.exportTmplFile != path || f.metricTemplate.rawSource != rawSource || !f.templateModTime.Equal(loadedModTime) {
+		// template was replaced meanwhile
+		return
+	}
+	if err != nil {
+		// don't retry broken template file until it changes again
+		f.templateModTime = modTime
+		f.logger.Errorf("couldn't reload metric template, keeping the previous one: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "template_reload", err.Error())
+		return
+	}
+	f.installMetricTemplate(prepared)
+	f.publishReadModel()
+	f.logger.Infof("Reloaded metric template from %s", path)
+	f.state.Events.Record(exchange.SeverityInfo, "template_reload", "reloaded metric template from "+path)
+}
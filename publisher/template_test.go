@@ -0,0 +1,66 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"strings"
+	"testing"
+)
+
+const testCompactTotalSpec = `"total":"__tmpl|/cgroups/cpu_stats/cpu_usage/total_usage|0|int",`
+
+func testTemplateWithSpec(t *testing.T, objectSpec string) string {
+	if !strings.Contains(builtinMetricTemplate, testCompactTotalSpec) {
+		t.Fatal("builtin template lacks spec of cpu usage total")
+	}
+	return strings.Replace(builtinMetricTemplate, testCompactTotalSpec, `"total":`+objectSpec+`,`, 1)
+}
+
+func TestTemplateNumericScaleAndOffset(t *testing.T) {
+	f, _ := NewCore()
+	source := testTemplateWithSpec(t, `{"__tmpl":"", "src":"/cgroups/cpu_stats/cpu_usage/total_usage", "default":0, "type":"float64", "scale":0.001, "offset":-2}`)
+	metricTemplate, err := f.parseMetricTemplate(source)
+	if err != nil {
+		t.Fatalf("template with numeric scale and offset rejected: %v", err)
+	}
+	var spec map[string]string
+	for _, candidate := range metricTemplate.mapToStats {
+		if candidate["target"] == "/cpu/usage/total" {
+			spec = candidate
+		}
+	}
+	if spec == nil {
+		t.Fatal("no mapping of /cpu/usage/total")
+	}
+	if spec["scale"] != "0.001" || spec["offset"] != "-2" || spec["default"] != "0" {
+		t.Errorf("numeric flags read as %q, %q and %q", spec["scale"], spec["offset"], spec["default"])
+	}
+	if got := metricTemplate.convertValue(spec, 5000.0); got != 3.0 {
+		t.Errorf("5000 transformed to %v, want 3", got)
+	}
+}
+
+func TestTemplateRejectsUnsupportedFlagValue(t *testing.T) {
+	f, _ := NewCore()
+	source := testTemplateWithSpec(t, `{"__tmpl":"", "src":"/cgroups/cpu_stats/cpu_usage/total_usage", "type":"int", "scale":[1]}`)
+	if _, err := f.parseMetricTemplate(source); err == nil {
+		t.Error("template with list as scale accepted")
+	}
+}
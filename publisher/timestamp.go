@@ -0,0 +1,68 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// sources of stats timestamps
+const (
+	// tstampSourceMetric takes timestamp metric was stamped with by collector
+	tstampSourceMetric = "timestamp"
+	// tstampSourceAdvertised takes time metric was last advertised
+	tstampSourceAdvertised = "last_advertised"
+	// tstampSourceReceive takes time metrics were received by the publisher
+	tstampSourceReceive = "receive"
+)
+
+// parseTstampSource validates source of stats timestamps; unknown sources
+//are reported and replaced with the default
+func parseTstampSource(source string) string {
+	switch source {
+	case tstampSourceMetric, tstampSourceAdvertised, tstampSourceReceive:
+		return source
+	default:
+		log.Warnf("Unknown timestamp source '%s', using '%s'", source, defTstampSource)
+		return defTstampSource
+	}
+}
+
+// selectTimestamps replaces timestamps of metrics with the ones given by
+//configured timestamp source; metrics lacking the selected time keep
+//their own timestamps
+func (f *core) selectTimestamps(metrics []Metric, receivedAt time.Time) {
+	if f.tstampSource == "" || f.tstampSource == tstampSourceMetric {
+		return
+	}
+	for i := range metrics {
+		metric := &metrics[i]
+		switch f.tstampSource {
+		case tstampSourceAdvertised:
+			if !metric.LastAdvertisedTime.IsZero() {
+				metric.Timestamp = metric.LastAdvertisedTime
+			}
+		case tstampSourceReceive:
+			metric.Timestamp = receivedAt
+		}
+	}
+}
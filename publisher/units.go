@@ -0,0 +1,138 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// unitScale gives size of a unit in base unit of its dimension
+type unitScale struct {
+	dimension string
+	scale     float64
+}
+
+// units known to `convert` template flag
+var units = map[string]unitScale{
+	"bytes":     {"size", 1},
+	"kilobytes": {"size", 1e3},
+	"megabytes": {"size", 1e6},
+	"gigabytes": {"size", 1e9},
+	"kibibytes": {"size", 1 << 10},
+	"mebibytes": {"size", 1 << 20},
+	"gibibytes": {"size", 1 << 30},
+	"ns":        {"time", 1},
+	"us":        {"time", 1e3},
+	"ms":        {"time", 1e6},
+	"s":         {"time", 1e9},
+	"fraction":  {"ratio", 1},
+	"percent":   {"ratio", 1e-2},
+	"permille":  {"ratio", 1e-3},
+}
+
+// parseConversion parses `convert` template flag of the form `FROM->TO`,
+//returning factor the value should be multiplied by
+func parseConversion(convert string) (float64, error) {
+	fromTo := strings.Split(convert, "->")
+	if len(fromTo) != 2 {
+		return 0, fmt.Errorf("invalid unit conversion %q, expected FROM->TO", convert)
+	}
+	from, knownFrom := units[strings.TrimSpace(fromTo[0])]
+	to, knownTo := units[strings.TrimSpace(fromTo[1])]
+	switch {
+	case !knownFrom:
+		return 0, fmt.Errorf("invalid unit conversion %q: unknown unit %q", convert, fromTo[0])
+	case !knownTo:
+		return 0, fmt.Errorf("invalid unit conversion %q: unknown unit %q", convert, fromTo[1])
+	case from.dimension != to.dimension:
+		return 0, fmt.Errorf("invalid unit conversion %q: can't convert %s to %s", convert, from.dimension, to.dimension)
+	}
+	return from.scale / to.scale, nil
+}
+
+// specConversion names the entry of template conversions applying to
+//values of a spec, set only for specs which convert values
+const specConversion = "conversion"
+
+// valueConversion is the combined effect of `convert`, `scale` and
+//`offset` flags of a value spec: value is multiplied by factor, then
+//offset is added
+type valueConversion struct {
+	factor float64
+	offset float64
+}
+
+// parseConversions parses `convert`, `scale` and `offset` flags of value
+//specs in given mappings once, at template load, so invalid ones are
+//rejected with the template; specs converting values are given
+//specConversion naming their entry in returned conversions
+func parseConversions(mappings ...map[string]map[string]string) (map[string]valueConversion, error) {
+	conversions := map[string]valueConversion{}
+	for _, mapping := range mappings {
+		for _, spec := range mapping {
+			conversion := valueConversion{factor: 1}
+			if convert, haveConvert := spec["convert"]; haveConvert {
+				factor, err := parseConversion(convert)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", spec["target"], err)
+				}
+				conversion.factor = factor
+			}
+			if text, haveScale := spec["scale"]; haveScale {
+				scale, err := strconv.ParseFloat(text, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid scale %q", spec["target"], text)
+				}
+				conversion.factor *= scale
+			}
+			if text, haveOffset := spec["offset"]; haveOffset {
+				offset, err := strconv.ParseFloat(text, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid offset %q", spec["target"], text)
+				}
+				conversion.offset = offset
+			}
+			if conversion.factor != 1 || conversion.offset != 0 {
+				key := strconv.Itoa(len(conversions))
+				conversions[key] = conversion
+				spec[specConversion] = key
+			}
+		}
+	}
+	return conversions, nil
+}
+
+// convertValue converts numeric value as given by `convert`, `scale` and
+//`offset` flags of the spec, parsed with the template; other values, and
+//values of specs without those flags, are returned intact
+func (t *MetricTemplate) convertValue(spec map[string]string, value interface{}) interface{} {
+	key, converts := spec[specConversion]
+	if !converts {
+		return value
+	}
+	conversion := t.conversions[key]
+	if floatVal, isNumber := toFloat64(value); isNumber {
+		return floatVal*conversion.factor + conversion.offset
+	}
+	return value
+}
@@ -0,0 +1,47 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const specCreationTime = "creation_time"
+
+// deriveCreationTime keeps creation time in spec of container no later
+//than its earliest stats: containers reported without creation time get
+//the timestamp of their first stats
+func deriveCreationTime(dockerMap, statsObj map[string]interface{}) {
+	specMap, haveSpec := dockerMap["spec"].(map[string]interface{})
+	if !haveSpec {
+		return
+	}
+	stampStr, _ := statsObj["timestamp"].(string)
+	stamp, err := util.ParseTime(stampStr)
+	if err != nil {
+		return
+	}
+	if createdStr, _ := specMap[specCreationTime].(string); createdStr != "" {
+		if created, err := util.ParseTime(createdStr); err == nil && !created.After(stamp) {
+			return
+		}
+	}
+	specMap[specCreationTime] = stampStr
+}
@@ -0,0 +1,330 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+const (
+	walFileSuffix    = ".wal"
+	walFlushInterval = time.Second
+	walQueueSize     = 1024
+)
+
+// walRecord is a piece of write-ahead log of a single container; rewrite
+//records replace the whole log, remove records delete it
+type walRecord struct {
+	path    string
+	data    []byte
+	rewrite bool
+	remove  bool
+}
+
+// walLine is a single line of container's log: either the container
+//object without stats (always the first line), or a stats sample
+type walLine struct {
+	Container map[string]interface{} `json:"container,omitempty"`
+	Stats     map[string]interface{} `json:"stats,omitempty"`
+}
+
+// writeAheadLog keeps per-container append-only logs of merged stats
+//samples, written asynchronously; log of container is compacted once
+//it holds as many appended samples as the container retains. Records are
+//queued without blocking, as they're logged with the state locked: a
+//record which doesn't fit the queue is dropped and the log of container
+//is rewritten with its next sample
+type writeAheadLog struct {
+	dir     string
+	logger  *log.Logger
+	records chan walRecord
+	// appended counts samples appended to each log since its last rewrite
+	appended map[string]int
+	// unremoved holds containers whose remove record was dropped
+	unremoved map[string]bool
+	// overflows counts records dropped as the queue was full
+	overflows int
+	// done is closed once the log is written out and its files closed
+	done chan struct{}
+}
+
+func newWriteAheadLog(dir string, logger *log.Logger) (*writeAheadLog, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{
+		dir:       dir,
+		logger:    logger,
+		records:   make(chan walRecord, walQueueSize),
+		appended:  map[string]int{},
+		unremoved: map[string]bool{},
+		done:      make(chan struct{}),
+	}, nil
+}
+
+func walFileName(dir, path string) string {
+	return filepath.Join(dir, url.QueryEscape(path)+walFileSuffix)
+}
+
+// logStats records stats sample just merged into container object
+func (w *writeAheadLog) logStats(path string, dockerObj, statsObj map[string]interface{}) {
+	w.retryRemovals()
+	delete(w.unremoved, path)
+	statsList := dockerObj["stats"].([]interface{})
+	if appended, known := w.appended[path]; !known || appended >= len(statsList) {
+		if w.enqueue(walRecord{path: path, data: encodeWalContainer(dockerObj), rewrite: true}) {
+			w.appended[path] = 0
+		}
+		return
+	}
+	line, _ := json.Marshal(walLine{Stats: statsObj})
+	if w.enqueue(walRecord{path: path, data: append(line, '\n')}) {
+		w.appended[path]++
+	} else {
+		// log misses the sample now, so it's rewritten next time
+		delete(w.appended, path)
+	}
+}
+
+// invalidate makes the next logged sample rewrite the whole log of
+//container, e.g. after stats were changed other way than by appending
+func (w *writeAheadLog) invalidate(path string) {
+	delete(w.appended, path)
+}
+
+// forget removes the log of container dropped from publisher's state
+func (w *writeAheadLog) forget(path string) {
+	w.retryRemovals()
+	delete(w.appended, path)
+	if !w.enqueue(walRecord{path: path, remove: true}) {
+		w.unremoved[path] = true
+	}
+}
+
+// retryRemovals queues remove records dropped before
+func (w *writeAheadLog) retryRemovals() {
+	for path := range w.unremoved {
+		if !w.enqueue(walRecord{path: path, remove: true}) {
+			return
+		}
+		delete(w.unremoved, path)
+	}
+}
+
+// enqueue queues record unless the queue is full
+func (w *writeAheadLog) enqueue(record walRecord) bool {
+	select {
+	case w.records <- record:
+		return true
+	default:
+		w.overflows++
+		return false
+	}
+}
+
+func encodeWalContainer(dockerObj map[string]interface{}) []byte {
+	var buf bytes.Buffer
+	header := map[string]interface{}{}
+	for k, v := range dockerObj {
+		if k != "stats" {
+			header[k] = v
+		}
+	}
+	line, _ := json.Marshal(walLine{Container: header})
+	buf.Write(line)
+	buf.WriteByte('\n')
+	for _, statsObj := range dockerObj["stats"].([]interface{}) {
+		line, _ = json.Marshal(walLine{Stats: statsObj.(map[string]interface{})})
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// run writes queued records to log files, flushing them periodically;
+//once stop is closed, records queued so far are written, files closed
+//and done is closed
+func (w *writeAheadLog) run(stop <-chan struct{}) {
+	defer close(w.done)
+	files := map[string]*os.File{}
+	writers := map[string]*bufio.Writer{}
+	closeFile := func(path string) {
+		if file, open := files[path]; open {
+			if err := writers[path].Flush(); err != nil {
+				w.logger.WithField("container", path).WithError(err).Error("Couldn't flush write-ahead log")
+			}
+			file.Close()
+			delete(files, path)
+			delete(writers, path)
+		}
+	}
+	flush := func() {
+		for path, writer := range writers {
+			if err := writer.Flush(); err != nil {
+				w.logger.WithField("container", path).WithError(err).Error("Couldn't flush write-ahead log")
+			}
+		}
+	}
+	write := func(record walRecord) {
+		fileName := walFileName(w.dir, record.path)
+		switch {
+		case record.remove:
+			closeFile(record.path)
+			os.Remove(fileName)
+			return
+		case record.rewrite:
+			closeFile(record.path)
+			if err := writeFileAtomically(fileName, record.data); err != nil {
+				w.logger.WithField("file", fileName).WithError(err).Error("Couldn't rewrite write-ahead log")
+			}
+			return
+		}
+		writer, open := writers[record.path]
+		if !open {
+			file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				w.logger.WithField("file", fileName).WithError(err).Error("Couldn't open write-ahead log")
+				return
+			}
+			files[record.path] = file
+			writer = bufio.NewWriter(file)
+			writers[record.path] = writer
+		}
+		writer.Write(record.data)
+	}
+	ticker := time.NewTicker(walFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case record := <-w.records:
+			write(record)
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for {
+				select {
+				case record := <-w.records:
+					write(record)
+				default:
+					for path := range files {
+						closeFile(path)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeFileAtomically replaces the file with data; files hold container
+//state, so they're readable by owner only
+func writeFileAtomically(fileName string, data []byte) error {
+	tmpName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// replayWriteAheadLog loads containers from write-ahead logs found in dir;
+//log truncated by a crash is replayed up to its last complete sample,
+//unreadable logs are reported and skipped
+func replayWriteAheadLog(dir string, logger *log.Logger) map[string]map[string]interface{} {
+	containers := map[string]map[string]interface{}{}
+	fileNames, _ := filepath.Glob(filepath.Join(dir, "*"+walFileSuffix))
+	for _, fileName := range fileNames {
+		path, err := url.QueryUnescape(strings.TrimSuffix(filepath.Base(fileName), walFileSuffix))
+		if err != nil {
+			continue
+		}
+		dockerObj, err := readWalFile(fileName)
+		if err != nil {
+			logger.Warnf("Skipping write-ahead log %s: %v", fileName, err)
+			continue
+		}
+		containers[path] = dockerObj
+	}
+	return containers
+}
+
+func readWalFile(fileName string) (map[string]interface{}, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var dockerObj map[string]interface{}
+	statsList := []interface{}{}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// incomplete line, if any, was torn by a crash
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var decoded walLine
+		if err := json.Unmarshal(line, &decoded); err != nil {
+			break
+		}
+		if dockerObj == nil {
+			if decoded.Container == nil {
+				return nil, fmt.Errorf("log doesn't start with container object")
+			}
+			dockerObj = decoded.Container
+		} else if decoded.Stats != nil {
+			statsList = append(statsList, decoded.Stats)
+		}
+	}
+	if dockerObj == nil {
+		return nil, fmt.Errorf("log is empty")
+	}
+	dockerObj["stats"] = statsList
+	return dockerObj, nil
+}
+
+// startWriteAheadLog replays write-ahead logs left by previous instance
+//and starts logging merged stats
+func (f *core) startWriteAheadLog(dir string) {
+	wal, err := newWriteAheadLog(dir, f.logger)
+	if err != nil {
+		f.logger.Errorf("couldn't set up write-ahead log: %s", err)
+		f.state.Events.Record(exchange.SeverityError, "state_store", err.Error())
+		return
+	}
+	f.restoreStoredState(replayWriteAheadLog(dir, f.logger))
+	f.wal = wal
+	go wal.run(f.stopped)
+}
@@ -0,0 +1,114 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+const (
+	watchdogComponent      = "ingestion"
+	watchdogWebhookTimeout = 10 * time.Second
+)
+
+// watchdog notices when no metrics were published for a number of
+//expected intervals, flagging publisher as unhealthy until they arrive again
+type watchdog struct {
+	sync.Mutex
+	core        *core
+	interval    time.Duration
+	maxMissed   int
+	webhookUrl  string
+	lastPublish time.Time
+	stalled     bool
+}
+
+func newWatchdog(core *core, interval time.Duration, maxMissed int, webhookUrl string) *watchdog {
+	return &watchdog{
+		core:        core,
+		interval:    interval,
+		maxMissed:   maxMissed,
+		webhookUrl:  webhookUrl,
+		lastPublish: time.Now(),
+	}
+}
+
+// notePublish records arrival of metrics
+func (w *watchdog) notePublish() {
+	w.Lock()
+	defer w.Unlock()
+	w.lastPublish = time.Now()
+}
+
+func (w *watchdog) run() {
+	w.core.tick(w.interval, func(time.Time) {
+		w.check()
+	})
+}
+
+func (w *watchdog) check() {
+	w.Lock()
+	stalledFor := time.Since(w.lastPublish)
+	lastPublish := w.lastPublish
+	stalled := stalledFor > time.Duration(w.maxMissed)*w.interval
+	changed := stalled != w.stalled
+	w.stalled = stalled
+	w.Unlock()
+	if !changed {
+		return
+	}
+	if !stalled {
+		w.core.state.Health.SetReady(watchdogComponent)
+		w.core.state.Events.Record(exchange.SeverityInfo, "ingestion", "metrics are being published again")
+		w.core.logger.Infof("Metrics are being published again")
+		return
+	}
+	reason := fmt.Sprintf("no metrics published since %s", lastPublish.Format(time.RFC3339))
+	w.core.state.Health.SetDegraded(watchdogComponent, reason)
+	w.core.state.Events.Record(exchange.SeverityError, "ingestion", reason)
+	w.core.logger.Errorf("Ingestion stalled: %s", reason)
+	if w.webhookUrl != "" {
+		go w.notifyWebhook(lastPublish, stalledFor)
+	}
+}
+
+func (w *watchdog) notifyWebhook(lastPublish time.Time, stalledFor time.Duration) {
+	hostname, _ := os.Hostname()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"node":         hostname,
+		"last_publish": lastPublish,
+		"stalled_for":  stalledFor.String(),
+	})
+	client := &http.Client{Timeout: watchdogWebhookTimeout}
+	resp, err := client.Post(w.webhookUrl, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		w.core.logger.Warnf("Failed to notify watchdog webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
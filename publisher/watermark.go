@@ -0,0 +1,133 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// memoryRecoveryRatio tells how far below the watermark heap must fall
+//for regular retention to be restored
+const memoryRecoveryRatio = 0.8
+
+// memoryWatermark watches heap size, halving retention and trimming
+//stats when it exceeds configured threshold
+type memoryWatermark struct {
+	core      *core
+	threshold uint64
+	interval  time.Duration
+	// releaseOS tells to return freed memory to the OS once heap crosses
+	//the watermark
+	releaseOS bool
+	// pressure is set (to 1) while heap is above the watermark
+	pressure int32
+}
+
+func newMemoryWatermark(core *core, thresholdMb int, interval time.Duration, releaseOS bool) *memoryWatermark {
+	return &memoryWatermark{
+		core:      core,
+		threshold: uint64(thresholdMb) << 20,
+		interval:  interval,
+		releaseOS: releaseOS,
+	}
+}
+
+// underPressure tells if retention should be shrunk to save memory
+func (w *memoryWatermark) underPressure() bool {
+	return w != nil && atomic.LoadInt32(&w.pressure) != 0
+}
+
+func (w *memoryWatermark) run() {
+	w.core.tick(w.interval, func(time.Time) {
+		w.check()
+	})
+}
+
+func (w *memoryWatermark) check() {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	heap := memStats.HeapAlloc
+	if heap > w.threshold {
+		crossed := atomic.CompareAndSwapInt32(&w.pressure, 0, 1)
+		if crossed {
+			w.core.logger.WithField("heap_mb", heap>>20).Warn("Heap size exceeds watermark, shrinking retention")
+			w.core.state.Events.Record(exchange.SeverityWarning, "memory_watermark",
+				fmt.Sprintf("heap size %d MB exceeds watermark of %d MB, shrinking retention", heap>>20, w.threshold>>20))
+		}
+		w.core.trimAllStats()
+		if crossed && w.releaseOS {
+			// forced GC is costly, so it's done only on crossing
+			debug.FreeOSMemory()
+		}
+		return
+	}
+	if float64(heap) < float64(w.threshold)*memoryRecoveryRatio && atomic.CompareAndSwapInt32(&w.pressure, 1, 0) {
+		w.core.logger.WithField("heap_mb", heap>>20).Info("Heap size back below watermark, restoring retention")
+		w.core.state.Events.Record(exchange.SeverityInfo, "memory_watermark",
+			fmt.Sprintf("heap size %d MB back below watermark, restoring retention", heap>>20))
+	}
+}
+
+// trimAllStats applies current retention limits to stats of all
+//containers right away, rather than when next stats arrive
+func (f *core) trimAllStats() {
+	f.state.Lock()
+	defer f.state.Unlock()
+	for path, dockerObj := range f.state.DockerStorage {
+		f.trimStats(path, dockerObj.(map[string]interface{}))
+	}
+	f.publishReadModel()
+}
+
+func (f *core) trimStats(path string, dockerMap map[string]interface{}) {
+	statsList := dockerMap["stats"].([]interface{})
+	if len(statsList) == 0 {
+		return
+	}
+	lastStamp, _ := util.ParseTime(statsList[len(statsList)-1].(map[string]interface{})["timestamp"].(string))
+	validOfs := f.retainedOffset(path, statsList, lastStamp, 0)
+	if validOfs == 0 {
+		return
+	}
+	f.dropOldestStats(path, dockerMap, validOfs)
+}
+
+// dropOldestStats drops given number of the oldest stats of container;
+//it's shared by all kinds of eviction (watermark, memory budget, janitor)
+func (f *core) dropOldestStats(path string, dockerMap map[string]interface{}, count int) {
+	statsList := dockerMap["stats"].([]interface{})
+	// copy retained stats, so the memory of dropped ones can be released
+	dockerMap["stats"] = append([]interface{}(nil), statsList[count:]...)
+	f.reindexStats(path, dockerMap)
+	f.markDirty(path)
+	if f.wal != nil {
+		f.wal.invalidate(path)
+	}
+	if f.memoryBudget != nil {
+		f.accountContainer(path, dockerMap)
+	}
+}
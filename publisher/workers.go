@@ -0,0 +1,192 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package publisher
+
+import (
+	"runtime"
+	"sync"
+
+	cadv "github.com/google/cadvisor/info/v1"
+)
+
+// batchItem is a metric of container, along with objects of the container
+//allocated for it
+type batchItem struct {
+	metric         *Metric
+	id             string
+	path           string
+	metricIdx      int
+	dockerObj      map[string]interface{}
+	statsObj       map[string]interface{}
+	knownDocker    bool
+	isCustomMetric bool
+}
+
+// parseProcessingWorkers gives number of workers inserting metrics;
+//0 means one per cpu
+func parseProcessingWorkers(workers int) int {
+	if workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return workers
+}
+
+// redirectMergedItems points metrics of pod-scoped containers merged into
+//docker containers later in the batch to objects of the docker containers
+func (f *processorContext) redirectMergedItems(items []batchItem) {
+	for i := range items {
+		item := &items[i]
+		dockerPath, merged := f.podContainerPaths[item.path]
+		if !merged || dockerPath == item.path {
+			continue
+		}
+		item.id, item.path = f.state.DockerPaths[dockerPath], dockerPath
+		item.dockerObj, _ = f.fetchObjectForDocker(item.id, item.path, nil)
+		item.statsObj, _ = f.fetchObjectForStats(item.id, item.path, item.metric)
+	}
+}
+
+// insertContainerMetrics inserts metrics into objects of their containers;
+//with several workers configured, containers are spread among workers,
+//each container's metrics inserted in order by a single worker
+func (f *processorContext) insertContainerMetrics(items []batchItem, firstTimeDockers map[string]bool) {
+	partitions := map[string][]batchItem{}
+	paths := []string{}
+	for _, item := range items {
+		if _, seen := partitions[item.path]; !seen {
+			paths = append(paths, item.path)
+		}
+		partitions[item.path] = append(partitions[item.path], item)
+	}
+	workers := f.processingWorkers
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	if workers <= 1 {
+		for _, item := range items {
+			f.insertContainerMetric(item, firstTimeDockers[item.path])
+		}
+		return
+	}
+	// shared maps are only read by workers, so entries of all containers
+	//must exist beforehand
+	for _, path := range paths {
+		if _, haveSamples := f.rateSamples[path]; !haveSamples {
+			f.rateSamples[path] = map[string]rateSample{}
+		}
+	}
+	var pendingLock sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string, len(paths))
+	for _, path := range paths {
+		queue <- path
+	}
+	close(queue)
+	contexts := make([]*processorContext, workers)
+	for i := range contexts {
+		worker := acquireProcessorContext(f.core)
+		worker.pendingLock = &pendingLock
+		contexts[i] = worker
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				for _, item := range partitions[path] {
+					worker.insertContainerMetric(item, firstTimeDockers[path])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, worker := range contexts {
+		f.absorb(worker)
+		releaseProcessorContext(worker)
+	}
+}
+
+// absorb takes over bookkeeping of a worker; containers of workers are
+//disjoint, so are their written targets
+func (f *processorContext) absorb(worker *processorContext) {
+	for objKey, written := range worker.writtenTargets {
+		f.writtenTargets[objKey] = written
+		delete(worker.writtenTargets, objKey)
+	}
+	for path := range worker.stats_statsPcsdMap {
+		f.stats_statsPcsdMap[path] = true
+	}
+	for source, delta := range worker.sourceCounters {
+		counters := f.sourceCounters[source]
+		counters.Received += delta.Received
+		counters.Mapped += delta.Mapped
+		counters.Dropped += delta.Dropped
+		f.sourceCounters[source] = counters
+	}
+	f.regularStats += worker.regularStats
+}
+
+// insertContainerMetric inserts metric into the first of container's
+//objects it maps to
+func (f *processorContext) insertContainerMetric(item batchItem, firstTimeDocker bool) {
+	mt, path := item.metric, item.path
+	mapped := true
+	if f.insertIntoStats(path, item.statsObj, mt) {
+		f.stats_statsPcsdMap[path] = true
+		goto finish
+	}
+	if f.insertIntoIface(path, item.statsObj, mt) {
+		goto finish
+	}
+	if f.insertIntoFs(path, item.statsObj, mt) {
+		goto finish
+	}
+	if item.knownDocker && !f.disabledGroups[groupCustomMetrics] && f.insertIntoCustomMetrics(path, item.dockerObj, mt) {
+		goto finish
+	}
+	if f.insertIntoDocker(path, item.dockerObj, mt, firstTimeDocker) {
+		goto finish
+	}
+	if !item.isCustomMetric && f.unmappedAsCustom && !f.disabledGroups[groupCustomMetrics] && f.insertIntoUnmappedMetrics(path, item.dockerObj, mt, item.metricIdx) {
+		goto finish
+	}
+	// container-level fields are mapped only for containers
+	//discovered in the batch
+	_, mapped = f.validateDockerMetric(mt)
+finish:
+	if !item.isCustomMetric {
+		f.regularStats++
+	}
+	f.countSourceMetric(mt, mapped)
+}
+
+// pendingMetricsOf returns custom metric values of container waiting to
+//be merged into stats, allocating room for them if needed
+func (f *processorContext) pendingMetricsOf(dockerPath string) map[string][]cadv.MetricVal {
+	if f.pendingLock != nil {
+		f.pendingLock.Lock()
+		defer f.pendingLock.Unlock()
+	}
+	dockerValuesMap, gotDockerValuesMap := f.state.PendingMetrics[dockerPath]
+	if !gotDockerValuesMap {
+		dockerValuesMap = map[string][]cadv.MetricVal{}
+		f.state.PendingMetrics[dockerPath] = dockerValuesMap
+	}
+	return dockerValuesMap
+}
@@ -0,0 +1,114 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// stateDumpInterval is the minimum time between state dumps requested
+//through the API, as each one writes the entire state to disk
+const stateDumpInterval = 10 * time.Second
+
+func init() {
+	util.RegisterFeature(featureAdmin)
+	adminRoutes = append(adminRoutes,
+		route{methods: []string{"GET"}, path: "/debug/events", handler: DebugEvents, admin: true},
+		route{methods: []string{"POST"}, path: "/debug/template", handler: DebugTemplate, admin: true},
+		route{methods: []string{"GET"}, path: "/debug/stats", handler: DebugStats, admin: true},
+		route{methods: []string{"GET"}, path: "/debug/stats/history", handler: DebugStatsHistory, admin: true},
+		route{methods: []string{"POST"}, path: "/debug/state/dump", handler: DebugStateDump, admin: true})
+}
+
+func DebugEvents(server *server, w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, http.StatusOK, server.state.Events.Events())
+}
+
+// DebugStats serves publisher's own statistics, template info and config
+//in effect, along with statistics of served stats
+func DebugStats(server *server, w http.ResponseWriter, r *http.Request) {
+	res := map[string]interface{}{}
+	if server.debugStats != nil {
+		res = server.debugStats()
+	}
+	res["server"] = map[string]interface{}{
+		"stats_tx_max":   server.stats.statsTxMax,
+		"stats_tx_total": server.stats.statsTxTotal,
+		"stats_tx_last":  server.stats.statsTxLast,
+		"stats_dd_max":   server.stats.statsDdMax,
+		"stats_dd_total": server.stats.statsDdTotal,
+		"stats_dd_last":  server.stats.statsDdLast,
+		"port":           server.port,
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
+
+// DebugStatsHistory serves samples of publisher's statistics, oldest first
+func DebugStatsHistory(server *server, w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, http.StatusOK, server.state.StatsHistory.Samples())
+}
+
+// DebugTemplate reloads the metric template from its configured location;
+//location can't be given by clients, so the publisher can't be made to
+//fetch arbitrary URLs or read arbitrary files
+func DebugTemplate(server *server, w http.ResponseWriter, r *http.Request) {
+	if server.loadTemplate == nil {
+		http.Error(w, "Template reload not supported", http.StatusNotImplemented)
+		return
+	}
+	if err := server.loadTemplate(); err != nil {
+		http.Error(w, "Template not loaded: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, map[string]interface{}{"status": "loaded"})
+}
+
+// DebugStateDump writes the entire state of the publisher to a file in
+//the state dump directory, responding with name of the file; dumps
+//requested sooner than stateDumpInterval after the previous one are refused
+func DebugStateDump(server *server, w http.ResponseWriter, r *http.Request) {
+	if server.dumpState == nil {
+		http.Error(w, "State dump not configured", http.StatusNotImplemented)
+		return
+	}
+	server.dumpLock.Lock()
+	wait := server.lastStateDump.Add(stateDumpInterval).Sub(time.Now())
+	if wait <= 0 {
+		server.lastStateDump = time.Now()
+	}
+	server.dumpLock.Unlock()
+	if wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(wait/time.Second)+1))
+		http.Error(w, "State dumped recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+	fileName, err := server.dumpState()
+	if err != nil {
+		http.Error(w, "State not dumped: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, map[string]interface{}{"file": fileName})
+}
@@ -0,0 +1,134 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	// advertisedMarker marks the log line advertising the port bound, so
+	//it can be picked from logs by tools
+	advertisedMarker = "server_advertised"
+
+	registerTimeout      = 5 * time.Second
+	registerRetryInitial = time.Second
+	registerRetryMax     = time.Minute
+)
+
+// advertisement describes where the server listens; it's written to port
+//file and sent to registration endpoint
+type advertisement struct {
+	Addr           string `json:"addr"`
+	Port           int    `json:"port"`
+	ConfiguredPort int    `json:"configured_port"`
+	Hostname       string `json:"hostname"`
+	Pid            int    `json:"pid"`
+}
+
+// advertise makes the port bound known, e.g. when it was chosen by the
+//system for server_port 0: it's logged with advertisedMarker, written to
+//port file and registered at registration endpoint, if configured; port
+//file is removed and registration withdrawn on shutdown
+func (server *server) advertise(portFile, registerUrl string) {
+	ad := advertisement{Addr: server.addr, Port: server.port, ConfiguredPort: server.configuredPort, Pid: os.Getpid()}
+	ad.Hostname, _ = os.Hostname()
+	server.logger.WithFields(log.Fields{
+		"marker":          advertisedMarker,
+		"addr":            ad.Addr,
+		"port":            ad.Port,
+		"configured_port": ad.ConfiguredPort,
+	}).Info("Server port advertised")
+	content, _ := json.Marshal(ad)
+	if portFile != "" {
+		if err := writePortFile(portFile, content); err != nil {
+			server.logger.WithField("file", portFile).WithError(err).Error("Couldn't write port file")
+			server.state.Events.Record(exchange.SeverityError, "server", "couldn't write port file: "+err.Error())
+		} else {
+			server.onShutdown(func() { os.Remove(portFile) })
+		}
+	}
+	if registerUrl != "" {
+		go server.register(registerUrl, content)
+	}
+}
+
+// writePortFile replaces port file atomically, so readers never see it
+//partially written
+func writePortFile(fileName string, content []byte) error {
+	tmpName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpName, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// register posts advertisement to registration endpoint, retrying with
+//backoff until it's accepted or the server is shut down
+func (server *server) register(registerUrl string, content []byte) {
+	attempt := func() error {
+		if server.isStopping() {
+			return nil
+		}
+		return sendRegistration("POST", registerUrl, content)
+	}
+	util.RetryWithBackoff(registerRetryInitial, registerRetryMax, server.done, attempt, func(err error, delay time.Duration) {
+		server.logger.WithField("url", registerUrl).WithError(err).Warnf("Couldn't register server, retrying in %v", delay)
+		server.state.Events.Record(exchange.SeverityWarning, "server", "couldn't register server: "+err.Error())
+	})
+	if server.isStopping() {
+		// shut down before registration was accepted
+		return
+	}
+	server.onShutdown(func() {
+		if err := sendRegistration("DELETE", registerUrl, content); err != nil {
+			server.logger.WithField("url", registerUrl).WithError(err).Warn("Couldn't withdraw server registration")
+		}
+	})
+}
+
+func sendRegistration(method, registerUrl string, content []byte) error {
+	req, err := http.NewRequest(method, registerUrl, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := http.Client{Timeout: registerTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("registration endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const authRealm = "heapster-publisher"
+
+// authenticator checks credentials of requests: a bearer token and/or
+//basic-auth user and password; requests are let through if none is
+//configured
+type authenticator struct {
+	token    string
+	user     string
+	password string
+}
+
+func (a *authenticator) enabled() bool {
+	return a.token != "" || a.user != ""
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (a *authenticator) check(r *http.Request) bool {
+	if !a.enabled() {
+		return true
+	}
+	if a.token != "" {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") && secureEqual(strings.TrimPrefix(header, "Bearer "), a.token) {
+			return true
+		}
+	}
+	if a.user != "" {
+		if user, password, ok := r.BasicAuth(); ok && secureEqual(user, a.user) && secureEqual(password, a.password) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets credentials on request sent to other publishers
+func (a *authenticator) apply(req *http.Request) {
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	} else if a.user != "" {
+		req.SetBasicAuth(a.user, a.password)
+	}
+}
+
+// authenticated rejects requests lacking valid credentials
+func authenticated(fu func(*server, http.ResponseWriter, *http.Request)) func(*server, http.ResponseWriter, *http.Request) {
+	return func(server *server, w http.ResponseWriter, r *http.Request) {
+		if !server.auth.check(r) {
+			if server.auth.token != "" {
+				w.Header().Add("WWW-Authenticate", "Bearer realm=\""+authRealm+"\"")
+			}
+			if server.auth.user != "" {
+				w.Header().Add("WWW-Authenticate", "Basic realm=\""+authRealm+"\"")
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fu(server, w, r)
+	}
+}
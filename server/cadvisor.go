@@ -0,0 +1,253 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// cadvisorDefaultNumStats is the number of stats returned by cAdvisor API
+//if request doesn't ask otherwise
+const cadvisorDefaultNumStats = 60
+
+// parseContainerInfoRequest decodes optional ContainerInfoRequest from the
+//body, applying defaults of cAdvisor: 60 most recent stats, or all stats
+//within time range, if any of its bounds is given
+func parseContainerInfoRequest(w http.ResponseWriter, r *http.Request) (*exchange.StatsRequest, bool) {
+	stats := exchange.StatsRequest{NumStats: cadvisorDefaultNumStats}
+	if r.Body != nil {
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&stats)
+		if err != nil && err != io.EOF {
+			http.Error(w, "Invalid ContainerInfoRequest: "+err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if !stats.Start.IsZero() || !stats.End.IsZero() {
+		stats.NumStats = 0
+	}
+	if stats.End.IsZero() {
+		stats.End = time.Now()
+	}
+	return &stats, true
+}
+
+// cadvisorContainerName gets absolute name of container from request path
+func cadvisorContainerName(r *http.Request) string {
+	return path.Clean("/" + mux.Vars(r)["name"])
+}
+
+// cadvisorParent finds the closest known ancestor of container
+func cadvisorParent(storage map[string]interface{}, name string) (string, bool) {
+	for name != "/" {
+		name = path.Dir(name)
+		if _, known := storage[name]; known {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// cadvisorChildren lists names of containers nested in given container:
+//direct children only, or all descendants if recursive is set
+func cadvisorChildren(storage map[string]interface{}, name string, recursive bool) []string {
+	res := []string{}
+	for childName := range storage {
+		if childName == name {
+			continue
+		}
+		if recursive {
+			if name == "/" || strings.HasPrefix(childName, name+"/") {
+				res = append(res, childName)
+			}
+		} else if parent, haveParent := cadvisorParent(storage, childName); haveParent && parent == name {
+			res = append(res, childName)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// buildContainerInfo renders container in layout of cAdvisor's
+//ContainerInfo: with references to its subcontainers and requested stats
+//in order of timestamps
+func buildContainerInfo(model *exchange.ReadModel, name string, stats *exchange.StatsRequest) map[string]interface{} {
+	dockerCopy := copyFlat(model.DockerStorage[name].(map[string]interface{}))
+	statsList := dockerCopy["stats"].([]interface{})
+	var statsCopy []interface{}
+	if index, haveIndex := model.StatsIndex[name]; haveIndex && len(index) == len(statsList) {
+		statsCopy = selectIndexedStats(statsList, index, stats)
+	} else {
+		statsCopy = selectStats(statsList, stats)
+	}
+	// stats are selected most recent first
+	for i, j := 0, len(statsCopy)-1; i < j; i, j = i+1, j-1 {
+		statsCopy[i], statsCopy[j] = statsCopy[j], statsCopy[i]
+	}
+	dockerCopy["stats"] = statsCopy
+	subcontainers := []interface{}{}
+	for _, childName := range cadvisorChildren(model.DockerStorage, name, false) {
+		childMap := model.DockerStorage[childName].(map[string]interface{})
+		subcontainers = append(subcontainers, map[string]interface{}{
+			"name":    childName,
+			"aliases": childMap["aliases"],
+		})
+	}
+	dockerCopy["subcontainers"] = subcontainers
+	return dockerCopy
+}
+
+// CadvisorContainer serves /api/v1.3/containers: info of a single container
+func CadvisorContainer(server *server, w http.ResponseWriter, r *http.Request) {
+	stats, valid := parseContainerInfoRequest(w, r)
+	if !valid {
+		return
+	}
+	model := server.snapshot(w)
+	name := cadvisorContainerName(r)
+	if _, known := model.DockerStorage[name]; !known {
+		http.Error(w, "unknown container \""+name+"\"", http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, buildContainerInfo(model, name, stats))
+}
+
+// CadvisorSubcontainers serves /api/v1.3/subcontainers: info of container
+//and all containers nested in it, recursively
+func CadvisorSubcontainers(server *server, w http.ResponseWriter, r *http.Request) {
+	stats, valid := parseContainerInfoRequest(w, r)
+	if !valid {
+		return
+	}
+	model := server.snapshot(w)
+	name := cadvisorContainerName(r)
+	res := []interface{}{}
+	if _, known := model.DockerStorage[name]; known {
+		res = append(res, buildContainerInfo(model, name, stats))
+	}
+	for _, childName := range cadvisorChildren(model.DockerStorage, name, true) {
+		res = append(res, buildContainerInfo(model, childName, stats))
+	}
+	if len(res) == 0 {
+		http.Error(w, "unknown container \""+name+"\"", http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
+
+// CadvisorDocker serves /api/v1.3/docker: info of all Docker containers,
+//or of a single one if its id, name or alias is given, keyed by names
+func CadvisorDocker(server *server, w http.ResponseWriter, r *http.Request) {
+	stats, valid := parseContainerInfoRequest(w, r)
+	if !valid {
+		return
+	}
+	model := server.snapshot(w)
+	id := strings.Trim(mux.Vars(r)["name"], "/")
+	res := map[string]interface{}{}
+	for name, dockerObj := range model.DockerStorage {
+		if name == "/" {
+			continue
+		}
+		if id != "" && !matchesDockerId(name, dockerObj.(map[string]interface{}), id) {
+			continue
+		}
+		res[name] = buildContainerInfo(model, name, stats)
+	}
+	if id != "" && len(res) == 0 {
+		http.Error(w, "unable to find Docker container \""+id+"\"", http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
+
+// matchesDockerId tells if container is identified by given id, name
+//or one of its aliases
+func matchesDockerId(name string, dockerMap map[string]interface{}, id string) bool {
+	if dockerId, _ := dockerMap["id"].(string); dockerId == id || name == "/"+id {
+		return true
+	}
+	aliases, _ := dockerMap["aliases"].([]interface{})
+	for _, alias := range aliases {
+		if alias == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CadvisorMachine serves /api/v1.3/machine: info of the node; unless
+//given by node metrics, network devices are the interfaces of the root
+//container
+func CadvisorMachine(server *server, w http.ResponseWriter, r *http.Request) {
+	machine, haveMachine := buildMachineInfo(server.snapshot(w))
+	if !haveMachine {
+		http.Error(w, "Metric template not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, machine)
+}
+
+// buildMachineInfo returns info of the node, listing network devices of
+//the root container if none were reported; false is returned until the
+//metric template is loaded
+func buildMachineInfo(model *exchange.ReadModel) (map[string]interface{}, bool) {
+	if model.Machine == nil {
+		return nil, false
+	}
+	machine := copyFlat(model.Machine)
+	if devices, _ := machine["network_devices"].([]interface{}); len(devices) == 0 {
+		machine["network_devices"] = rootNetworkDevices(model)
+	}
+	return machine, true
+}
+
+// rootNetworkDevices lists network interfaces found in the most recent
+//stats of the root container
+func rootNetworkDevices(model *exchange.ReadModel) []interface{} {
+	res := []interface{}{}
+	rootObj, haveRoot := model.DockerStorage["/"].(map[string]interface{})
+	if !haveRoot {
+		return res
+	}
+	statsList, _ := rootObj["stats"].([]interface{})
+	if len(statsList) == 0 {
+		return res
+	}
+	statsMap := statsList[len(statsList)-1].(map[string]interface{})
+	network, _ := statsMap["network"].(map[string]interface{})
+	interfaces, _ := network["interfaces"].([]interface{})
+	for _, iface := range interfaces {
+		ifaceMap, _ := iface.(map[string]interface{})
+		if name, _ := ifaceMap["name"].(string); name != "" {
+			res = append(res, map[string]interface{}{"name": name})
+		}
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// acceptedEncoding picks compression accepted by client, preferring gzip;
+//empty string is returned if client accepts neither
+func acceptedEncoding(r *http.Request) string {
+	accepted := map[string]bool{}
+	for _, value := range r.Header["Accept-Encoding"] {
+		for _, elem := range strings.Split(value, ",") {
+			params := strings.Split(elem, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+			accepted[coding] = true
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if !strings.HasPrefix(param, "q=") {
+					continue
+				}
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q <= 0 {
+					accepted[coding] = false
+				}
+			}
+		}
+	}
+	for _, coding := range []string{encodingGzip, encodingDeflate} {
+		if accepted[coding] {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compressedWriter compresses response body on the fly; responses
+//without body are passed through
+type compressedWriter struct {
+	http.ResponseWriter
+	encoding    string
+	compressor  io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressedWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified {
+		c.Header().Del("Content-Length")
+		c.Header().Set("Content-Encoding", c.encoding)
+		if c.encoding == encodingGzip {
+			c.compressor = gzip.NewWriter(c.ResponseWriter)
+		} else {
+			c.compressor = zlib.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressedWriter) Write(data []byte) (int, error) {
+	if !c.wroteHeader {
+		// content type can't be sniffed from compressed body
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.compressor == nil {
+		return c.ResponseWriter.Write(data)
+	}
+	return c.compressor.Write(data)
+}
+
+// close flushes compressed body
+func (c *compressedWriter) close() {
+	if c.compressor != nil {
+		c.compressor.Close()
+	}
+}
+
+// compressing compresses responses with gzip or deflate if client accepts
+//any of them; WebSocket handshakes are left alone, as they take over
+//the connection
+func compressing(fu func(*server, http.ResponseWriter, *http.Request)) func(*server, http.ResponseWriter, *http.Request) {
+	return func(server *server, w http.ResponseWriter, r *http.Request) {
+		if headerContains(r.Header, "Connection", "upgrade") {
+			fu(server, w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r)
+		if encoding == "" {
+			fu(server, w, r)
+			return
+		}
+		cw := &compressedWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		fu(server, cw, r)
+	}
+}
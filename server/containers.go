@@ -0,0 +1,109 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+type containerEntry struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	LastSeen  time.Time  `json:"last_seen"`
+	Removed   bool       `json:"removed"`
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+type containerEntries []containerEntry
+
+func (c containerEntries) Len() int {
+	return len(c)
+}
+
+func (c containerEntries) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c containerEntries) Less(i, j int) bool {
+	return c[i].Name < c[j].Name
+}
+
+// buildContainersResponse lists known containers along with the time
+//of their most recent stats; removed containers are listed too
+//if includeRemoved is set, as long as their tombstones are kept
+func buildContainersResponse(model *exchange.ReadModel, includeRemoved bool) containerEntries {
+	res := containerEntries{}
+	for dockerName, dockerObj := range model.DockerStorage {
+		dockerMap := dockerObj.(map[string]interface{})
+		entry := containerEntry{Name: dockerName}
+		entry.Id, _ = dockerMap["id"].(string)
+		if statsList, _ := dockerMap["stats"].([]interface{}); len(statsList) > 0 {
+			lastStats := statsList[len(statsList)-1].(map[string]interface{})
+			entry.LastSeen, _ = util.ParseTime(lastStats["timestamp"].(string))
+		}
+		res = append(res, entry)
+	}
+	if includeRemoved {
+		for _, tombstone := range model.Tombstones {
+			removedAt := tombstone.RemovedAt
+			res = append(res, containerEntry{
+				Id:        tombstone.Id,
+				Name:      tombstone.Name,
+				LastSeen:  tombstone.LastSeen,
+				Removed:   true,
+				RemovedAt: &removedAt,
+				Reason:    tombstone.Reason,
+			})
+		}
+	}
+	sort.Sort(res)
+	return res
+}
+
+func Containers(server *server, w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	includeRemoved := r.URL.Query().Get("include_removed") == "1"
+	res := containerEntries{}
+	more := false
+	for _, entry := range buildContainersResponse(server.snapshot(w), includeRemoved) {
+		if !page.includes(entry.Name) {
+			continue
+		}
+		if page.full(len(res)) {
+			more = true
+			break
+		}
+		res = append(res, entry)
+	}
+	if len(res) > 0 {
+		writeContinueToken(w, res[len(res)-1].Name, more)
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
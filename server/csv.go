@@ -0,0 +1,159 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// csvKeyColumns lead columns of CSV rows, in that order
+var csvKeyColumns = []string{"container", "id", "key"}
+
+// csvSerializer renders responses as CSV table with columns named by
+//dotted paths of fields; containers' stats make one row per stats
+//object, other lists and maps one row per element
+type csvSerializer struct{}
+
+func (csvSerializer) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (csvSerializer) Serialize(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	rows := csvRows(generic)
+	columnSet := map[string]bool{}
+	for _, row := range rows {
+		for column := range row {
+			columnSet[column] = true
+		}
+	}
+	columns := []string{}
+	for _, column := range csvKeyColumns {
+		if columnSet[column] {
+			columns = append(columns, column)
+			delete(columnSet, column)
+		}
+	}
+	otherColumns := make([]string, 0, len(columnSet))
+	for column := range columnSet {
+		otherColumns = append(otherColumns, column)
+	}
+	sort.Strings(otherColumns)
+	columns = append(columns, otherColumns...)
+
+	writer := csv.NewWriter(w)
+	writer.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for idx, column := range columns {
+			record[idx] = row[column]
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvRows(generic interface{}) []map[string]string {
+	rows := []map[string]string{}
+	if storage, isStorage := asContainerStorage(generic); isStorage {
+		names := make([]string, 0, len(storage))
+		for name := range storage {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			objMap := storage[name].(map[string]interface{})
+			id, _ := objMap["id"].(string)
+			for _, statsObj := range objMap["stats"].([]interface{}) {
+				row := map[string]string{"container": name, "id": id}
+				flattenCsv(row, "", statsObj)
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	}
+	switch generic := generic.(type) {
+	case []interface{}:
+		for _, elem := range generic {
+			row := map[string]string{}
+			flattenCsv(row, "", elem)
+			rows = append(rows, row)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(generic))
+		for key := range generic {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			row := map[string]string{"key": key}
+			flattenCsv(row, "", generic[key])
+			rows = append(rows, row)
+		}
+	default:
+		row := map[string]string{}
+		flattenCsv(row, "", generic)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// flattenCsv sets row columns for leaf values of object, named by their
+//dotted paths; list elements are named by their indexes
+func flattenCsv(row map[string]string, prefix string, obj interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		for key, child := range obj {
+			flattenCsv(row, join(key), child)
+		}
+	case []interface{}:
+		for idx, child := range obj {
+			flattenCsv(row, join(strconv.Itoa(idx)), child)
+		}
+	case nil:
+		row[csvColumn(prefix)] = ""
+	case json.Number:
+		row[csvColumn(prefix)] = obj.String()
+	default:
+		row[csvColumn(prefix)] = fmt.Sprint(obj)
+	}
+}
+
+func csvColumn(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
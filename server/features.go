@@ -0,0 +1,62 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+)
+
+const (
+	featureAdmin        = "admin"
+	featureGrpc         = "grpc"
+	featureDerivedStats = "derived_stats"
+	featurePprof        = "pprof"
+)
+
+// adminRoutes are registered by admin APIs, unless excluded by build
+//profile (tag minimal)
+var adminRoutes []route
+
+// pprofRoutes serve profiles of the running plugin, if enabled by config;
+//they're excluded by build profile (tag minimal) along with admin APIs
+var pprofRoutes []route
+
+// featureRoutes are registered by optional APIs served to all consumers,
+//unless excluded by build profile
+var featureRoutes []route
+
+// grpcServerFunc serves gRPC API on given address; it's set only in builds
+//with gRPC support (tag grpc), keeping grpc-go out of default dependencies
+var grpcServerFunc func(server *server, listenAddr string) error
+
+// startGrpc launches gRPC listener in the background, if compiled in
+func startGrpc(server *server) {
+	listenAddr := fmt.Sprintf("%s:%d", server.addr, server.grpcPort)
+	if grpcServerFunc == nil {
+		server.logger.WithField("listen_addr", listenAddr).Error("gRPC support not compiled in (build with -tags grpc)")
+		return
+	}
+	server.logger.WithField("listen_addr", listenAddr).Info("gRPC server will now listen")
+	go func() {
+		if err := grpcServerFunc(server, listenAddr); err != nil && !server.isStopping() {
+			server.logger.WithField("listen_addr", listenAddr).Errorf("gRPC server failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,91 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+type containerGroup struct {
+	Containers []string           `json:"containers"`
+	Sum        map[string]float64 `json:"sum"`
+	Avg        map[string]float64 `json:"avg"`
+}
+
+// flattenNumbers collects numeric fields of json-like object, keyed by
+//their paths; lists are skipped, as their elements can't be matched
+//across containers
+func flattenNumbers(obj interface{}, path string, out map[string]float64) {
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		for key, child := range obj {
+			flattenNumbers(child, path+"/"+key, out)
+		}
+	default:
+		if value, isNumber := toFloat(obj); isNumber {
+			out[path] = value
+		}
+	}
+}
+
+// buildGroupsResponse aggregates the most recent stats of containers
+//grouped by value of given label
+func buildGroupsResponse(model *exchange.ReadModel, label string) map[string]*containerGroup {
+	groups := map[string]*containerGroup{}
+	for dockerName, dockerObj := range model.DockerStorage {
+		dockerMap := dockerObj.(map[string]interface{})
+		labels, _ := dockerMap["labels"].(map[string]interface{})
+		labelValue, haveLabel := labels[label].(string)
+		statsList, _ := dockerMap["stats"].([]interface{})
+		if !haveLabel || len(statsList) == 0 {
+			continue
+		}
+		group, haveGroup := groups[labelValue]
+		if !haveGroup {
+			group = &containerGroup{Containers: []string{}, Sum: map[string]float64{}, Avg: map[string]float64{}}
+			groups[labelValue] = group
+		}
+		group.Containers = append(group.Containers, dockerName)
+		values := map[string]float64{}
+		flattenNumbers(statsList[len(statsList)-1], "", values)
+		for path, value := range values {
+			group.Sum[path] += value
+		}
+	}
+	for _, group := range groups {
+		sort.Strings(group.Containers)
+		for path, sum := range group.Sum {
+			group.Avg[path] = sum / float64(len(group.Containers))
+		}
+	}
+	return groups
+}
+
+func Groups(server *server, w http.ResponseWriter, r *http.Request) {
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		http.Error(w, "Missing label parameter", http.StatusBadRequest)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, buildGroupsResponse(server.snapshot(w), label))
+}
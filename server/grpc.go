@@ -0,0 +1,180 @@
+// +build grpc
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	grpcServiceName = "heapster.publisher.StatsService"
+	// grpcStreamBuffer holds stats pending to be sent to a client; stats
+	//are dropped for clients not keeping up
+	grpcStreamBuffer = 256
+)
+
+func init() {
+	grpcServerFunc = serveGrpc
+	util.RegisterFeature(featureGrpc)
+}
+
+// statsService is the handler type of the service, as required by
+//grpc.ServiceDesc
+type statsService interface {
+	ListContainers(context.Context, *ListContainersRequest) (*ListContainersResponse, error)
+	WatchStats(*WatchStatsRequest, grpc.ServerStream) error
+}
+
+type statsServer struct {
+	server *server
+}
+
+// authorize checks credentials passed in "authorization" metadata the
+//same way as for REST requests
+func (s *statsServer) authorize(ctx context.Context) error {
+	if !s.server.auth.enabled() {
+		return nil
+	}
+	req := &http.Request{Header: http.Header{}}
+	if md, haveMd := metadata.FromContext(ctx); haveMd {
+		for _, value := range md["authorization"] {
+			req.Header.Add("Authorization", value)
+		}
+	}
+	if !s.server.auth.check(req) {
+		return grpc.Errorf(codes.Unauthenticated, "invalid or missing credentials")
+	}
+	return nil
+}
+
+func (s *statsServer) ListContainers(ctx context.Context, req *ListContainersRequest) (*ListContainersResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	s.server.state.Activity.Touch()
+	entries := buildContainersResponse(s.server.state.ReadModel.Get(), false)
+	res := &ListContainersResponse{Containers: make([]*Container, 0, len(entries))}
+	for _, entry := range entries {
+		container := &Container{
+			Id:       entry.Id,
+			Name:     entry.Name,
+			LastSeen: entry.LastSeen.Format(time.RFC3339),
+			Removed:  entry.Removed,
+			Reason:   entry.Reason,
+		}
+		if entry.RemovedAt != nil {
+			container.RemovedAt = entry.RemovedAt.Format(time.RFC3339)
+		}
+		res.Containers = append(res.Containers, container)
+	}
+	return res, nil
+}
+
+// WatchStats sends stats objects as they are produced, until client
+//cancels the call
+func (s *statsServer) WatchStats(req *WatchStatsRequest, stream grpc.ServerStream) error {
+	if err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	watched := map[string]bool{}
+	for _, container := range req.Containers {
+		watched[container] = true
+	}
+	feed := s.server.state.Feed
+	updates := feed.Subscribe(grpcStreamBuffer)
+	defer feed.Unsubscribe(updates)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case update := <-updates:
+			if len(watched) > 0 && !watched[update.Container] && !watched[update.Id] {
+				continue
+			}
+			s.server.state.Activity.Touch()
+			statsJson, err := json.Marshal(update.Stats)
+			if err != nil {
+				return grpc.Errorf(codes.Internal, "couldn't encode stats: %v", err)
+			}
+			if err := stream.SendMsg(&StatsUpdate{Container: update.Container, Id: update.Id, StatsJson: string(statsJson)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func listContainersHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(ListContainersRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(statsService).ListContainers(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + grpcServiceName + "/ListContainers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(statsService).ListContainers(ctx, req.(*ListContainersRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func watchStatsHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(WatchStatsRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(statsService).WatchStats(req, stream)
+}
+
+var statsServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*statsService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ListContainers", Handler: listContainersHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "WatchStats", Handler: watchStatsHandler, ServerStreams: true},
+	},
+}
+
+func serveGrpc(server *server, listenAddr string) error {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	grpcServer := grpc.NewServer()
+	grpcServer.RegisterService(&statsServiceDesc, &statsServer{server: server})
+	server.onShutdown(grpcServer.Stop)
+	return grpcServer.Serve(listener)
+}
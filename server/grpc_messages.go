@@ -0,0 +1,78 @@
+// +build grpc
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Messages of the service described by stats.proto, written the way
+//protoc-gen-go would generate them
+
+type ListContainersRequest struct {
+}
+
+func (m *ListContainersRequest) Reset()         { *m = ListContainersRequest{} }
+func (m *ListContainersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListContainersRequest) ProtoMessage()    {}
+
+type Container struct {
+	Id        string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Name      string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	LastSeen  string `protobuf:"bytes,3,opt,name=last_seen,json=lastSeen" json:"last_seen,omitempty"`
+	Removed   bool   `protobuf:"varint,4,opt,name=removed" json:"removed,omitempty"`
+	RemovedAt string `protobuf:"bytes,5,opt,name=removed_at,json=removedAt" json:"removed_at,omitempty"`
+	Reason    string `protobuf:"bytes,6,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *Container) Reset()         { *m = Container{} }
+func (m *Container) String() string { return proto.CompactTextString(m) }
+func (*Container) ProtoMessage()    {}
+
+type ListContainersResponse struct {
+	Containers []*Container `protobuf:"bytes,1,rep,name=containers" json:"containers,omitempty"`
+}
+
+func (m *ListContainersResponse) Reset()         { *m = ListContainersResponse{} }
+func (m *ListContainersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListContainersResponse) ProtoMessage()    {}
+
+// WatchStatsRequest restricts streamed stats to given container names
+//or ids; all containers are watched if the list is empty
+type WatchStatsRequest struct {
+	Containers []string `protobuf:"bytes,1,rep,name=containers" json:"containers,omitempty"`
+}
+
+func (m *WatchStatsRequest) Reset()         { *m = WatchStatsRequest{} }
+func (m *WatchStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchStatsRequest) ProtoMessage()    {}
+
+// StatsUpdate carries stats object encoded as JSON, as served by REST API
+type StatsUpdate struct {
+	Container string `protobuf:"bytes,1,opt,name=container" json:"container,omitempty"`
+	Id        string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	StatsJson string `protobuf:"bytes,3,opt,name=stats_json,json=statsJson" json:"stats_json,omitempty"`
+}
+
+func (m *StatsUpdate) Reset()         { *m = StatsUpdate{} }
+func (m *StatsUpdate) String() string { return proto.CompactTextString(m) }
+func (*StatsUpdate) ProtoMessage()    {}
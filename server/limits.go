@@ -0,0 +1,137 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// limitedWriter buffers response, replacing it with an error if it
+//exceeds the size limit
+type limitedWriter struct {
+	http.ResponseWriter
+	limit    int
+	status   int
+	buf      bytes.Buffer
+	exceeded bool
+}
+
+func (l *limitedWriter) WriteHeader(status int) {
+	if l.status == 0 {
+		l.status = status
+	}
+}
+
+func (l *limitedWriter) Write(data []byte) (int, error) {
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	if l.exceeded {
+		return len(data), nil
+	}
+	if l.buf.Len()+len(data) > l.limit {
+		l.exceeded = true
+		l.buf.Reset()
+		return len(data), nil
+	}
+	return l.buf.Write(data)
+}
+
+// flush sends the buffered response, or error telling how to narrow it
+//down if it was too big
+func (l *limitedWriter) flush() {
+	if l.exceeded {
+		l.Header().Del(continueTokenHeader)
+		http.Error(l.ResponseWriter, fmt.Sprintf("Response exceeds the limit of %d bytes, narrow it down with limit, count, name, id or since parameters", l.limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if l.status != 0 {
+		l.ResponseWriter.WriteHeader(l.status)
+	}
+	l.ResponseWriter.Write(l.buf.Bytes())
+}
+
+// limitingSize replies with 413 instead of responses larger than
+//maxResponseSize; WebSocket handshakes are left alone, as they take over
+//the connection
+func limitingSize(fu func(*server, http.ResponseWriter, *http.Request)) func(*server, http.ResponseWriter, *http.Request) {
+	return func(server *server, w http.ResponseWriter, r *http.Request) {
+		if headerContains(r.Header, "Connection", "upgrade") {
+			fu(server, w, r)
+			return
+		}
+		lw := &limitedWriter{ResponseWriter: w, limit: server.maxResponseSize}
+		defer lw.flush()
+		fu(server, lw, r)
+	}
+}
+
+// encodedObjects holds objects of a response already encoded in JSON,
+//keyed by their names, so they're written out without encoding them again
+type encodedObjects struct {
+	names   []string
+	encoded map[string][]byte
+}
+
+// MarshalJSON joins encoded objects, so serializers of other formats
+//still get the response
+func (e encodedObjects) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.writeTo(&buf)
+	return buf.Bytes(), nil
+}
+
+func (e encodedObjects) writeTo(buf *bytes.Buffer) {
+	buf.WriteByte('{')
+	for idx, name := range e.names {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		encodedName, _ := json.Marshal(name)
+		buf.Write(encodedName)
+		buf.WriteByte(':')
+		buf.Write(e.encoded[name])
+	}
+	buf.WriteByte('}')
+}
+
+// fitStatsResponse encodes containers of stats response in turn, until
+//the size of response would exceed the limit; containers encoded are
+//returned along with a flag telling if any were left out
+func fitStatsResponse(res map[string]map[string]interface{}, names []string, limit int) (encodedObjects, bool) {
+	fitted := encodedObjects{names: names, encoded: make(map[string][]byte, len(names))}
+	size := 2
+	for idx, name := range names {
+		out, err := json.Marshal(res[name])
+		if err != nil {
+			panic(err)
+		}
+		size += len(name) + len(out) + 4
+		if size > limit {
+			fitted.names = names[:idx]
+			return fitted, true
+		}
+		fitted.encoded[name] = out
+	}
+	return fitted, false
+}
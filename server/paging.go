@@ -0,0 +1,77 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// continueTokenHeader carries token of the next page of a paginated
+//response; it's absent on the last page
+const continueTokenHeader = "X-Continue-Token"
+
+// pageRequest picks a page of containers ordered by names: at most limit
+//of them (all if limit is 0), following the container named after
+type pageRequest struct {
+	limit int
+	after string
+}
+
+// parsePageRequest reads `limit` and `continue` query parameters
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	var page pageRequest
+	query := r.URL.Query()
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			return page, fmt.Errorf("Invalid limit: %s", limitStr)
+		}
+		page.limit = limit
+	}
+	if token := query.Get("continue"); token != "" {
+		after, err := base64.URLEncoding.DecodeString(token)
+		if err != nil || len(after) == 0 {
+			return page, fmt.Errorf("Invalid continue token: %s", token)
+		}
+		page.after = string(after)
+	}
+	return page, nil
+}
+
+// includes tells if container of given name falls after the page start
+func (p pageRequest) includes(name string) bool {
+	return p.after == "" || name > p.after
+}
+
+// full tells if page holding given number of containers can't take more
+func (p pageRequest) full(size int) bool {
+	return p.limit > 0 && size >= p.limit
+}
+
+// writeContinueToken announces the next page, starting after container
+//of given name, unless the page was the last one
+func writeContinueToken(w http.ResponseWriter, lastName string, more bool) {
+	if more {
+		w.Header().Set(continueTokenHeader, base64.URLEncoding.EncodeToString([]byte(lastName)))
+	}
+}
@@ -0,0 +1,58 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// buildPodStatsResponse picks aggregated stats of pods within requested
+//time range, the same way as for containers
+func buildPodStatsResponse(model *exchange.ReadModel, stats *exchange.StatsRequest) map[string]map[string]interface{} {
+	res := map[string]map[string]interface{}{}
+	for podKey, podObj := range model.PodStorage {
+		podCopy := copyFlat(podObj.(map[string]interface{}))
+		podCopy["stats"] = selectStats(podCopy["stats"].([]interface{}), stats)
+		res[podKey] = podCopy
+	}
+	return res
+}
+
+func PodStats(server *server, w http.ResponseWriter, r *http.Request) {
+	stats, valid := parseStatsRequest(w, r)
+	if !valid {
+		return
+	}
+	writeResponse(w, r, http.StatusOK, buildPodStatsResponse(server.snapshot(w), stats))
+}
+
+// Pods lists known pods along with their containers, without stats
+func Pods(server *server, w http.ResponseWriter, r *http.Request) {
+	model := server.snapshot(w)
+	res := map[string]map[string]interface{}{}
+	for podKey, podObj := range model.PodStorage {
+		podCopy := copyFlat(podObj.(map[string]interface{}))
+		delete(podCopy, "stats")
+		res[podKey] = podCopy
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
@@ -0,0 +1,47 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+func init() {
+	util.RegisterFeature(featurePprof)
+	pprofRoutes = append(pprofRoutes,
+		route{methods: []string{"GET"}, path: "/debug/pprof/", handler: pprofHandler(pprof.Index), admin: true},
+		route{methods: []string{"GET"}, path: "/debug/pprof/cmdline", handler: pprofHandler(pprof.Cmdline), admin: true},
+		route{methods: []string{"GET"}, path: "/debug/pprof/profile", handler: pprofHandler(pprof.Profile), admin: true},
+		route{methods: []string{"GET", "POST"}, path: "/debug/pprof/symbol", handler: pprofHandler(pprof.Symbol), admin: true},
+		route{methods: []string{"GET"}, path: "/debug/pprof/trace", handler: pprofHandler(pprof.Trace), admin: true},
+		// named profiles, e.g. heap or goroutine
+		route{methods: []string{"GET"}, path: "/debug/pprof/{profile}", handler: pprofHandler(pprof.Index), admin: true})
+}
+
+func pprofHandler(handler http.HandlerFunc) func(*server, http.ResponseWriter, *http.Request) {
+	return func(server *server, w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+const (
+	rootContainerName = "/"
+	defPressureTop    = 5
+)
+
+type containerUsage struct {
+	Container string  `json:"container"`
+	CpuCores  float64 `json:"cpu_cores"`
+	Memory    float64 `json:"memory_bytes"`
+}
+
+type resourcePressure struct {
+	Capacity   float64 `json:"capacity"`
+	Used       float64 `json:"used"`
+	Saturation float64 `json:"saturation"`
+}
+
+func newResourcePressure(capacity, used float64) resourcePressure {
+	res := resourcePressure{Capacity: capacity, Used: used}
+	if capacity > 0 {
+		res.Saturation = used / capacity
+	}
+	return res
+}
+
+type usageSorter struct {
+	usages []containerUsage
+	less   func(a, b containerUsage) bool
+}
+
+func (s usageSorter) Len() int {
+	return len(s.usages)
+}
+
+func (s usageSorter) Swap(i, j int) {
+	s.usages[i], s.usages[j] = s.usages[j], s.usages[i]
+}
+
+func (s usageSorter) Less(i, j int) bool {
+	return s.less(s.usages[i], s.usages[j])
+}
+
+// lookupNumber finds number at given path of json-like object
+func lookupNumber(obj interface{}, path string) float64 {
+	value, err := util.NewObjWalker(obj).Seek(path)
+	if err != nil {
+		return 0
+	}
+	number, _ := toFloat(value)
+	return number
+}
+
+// cpuCoresUsed computes cpu usage of container in cores from its two
+// most recent stats
+func cpuCoresUsed(statsList []interface{}) float64 {
+	if len(statsList) < 2 {
+		return 0
+	}
+	prev, last := statsList[len(statsList)-2], statsList[len(statsList)-1]
+	prevStamp, _ := util.ParseTime(prev.(map[string]interface{})["timestamp"].(string))
+	lastStamp, _ := util.ParseTime(last.(map[string]interface{})["timestamp"].(string))
+	interval := lastStamp.Sub(prevStamp).Nanoseconds()
+	usage := lookupNumber(last, "/cpu/usage/total") - lookupNumber(prev, "/cpu/usage/total")
+	if interval <= 0 || usage < 0 {
+		return 0
+	}
+	return usage / float64(interval)
+}
+
+// cpuCount counts cpus listed in mask like "0-3,6"
+func cpuCount(mask string) int {
+	count := 0
+	for _, part := range strings.Split(mask, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		count += last - first + 1
+	}
+	return count
+}
+
+// machineMemory reads total memory of the machine from /proc/meminfo
+func machineMemory() float64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseFloat(fields[1], 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// buildPressureResponse summarizes resource usage of containers against
+// capacity of the node; capacity is taken from spec of the root container,
+// or from the machine publisher runs on
+func buildPressureResponse(model *exchange.ReadModel, top int) map[string]interface{} {
+	cpuCapacity := float64(runtime.NumCPU())
+	memoryCapacity := machineMemory()
+	if rootObj, haveRoot := model.DockerStorage[rootContainerName]; haveRoot {
+		if mask, _ := util.NewObjWalker(rootObj).Seek("/spec/cpu/mask"); mask != nil {
+			if count := cpuCount(mask.(string)); count > 0 {
+				cpuCapacity = float64(count)
+			}
+		}
+		if limit := lookupNumber(rootObj, "/spec/memory/limit"); limit > 0 {
+			memoryCapacity = limit
+		}
+	}
+	usages := []containerUsage{}
+	var cpuUsed, memoryUsed float64
+	for dockerName, dockerObj := range model.DockerStorage {
+		if dockerName == rootContainerName {
+			continue
+		}
+		statsList, _ := dockerObj.(map[string]interface{})["stats"].([]interface{})
+		if len(statsList) == 0 {
+			continue
+		}
+		usage := containerUsage{
+			Container: dockerName,
+			CpuCores:  cpuCoresUsed(statsList),
+			Memory:    lookupNumber(statsList[len(statsList)-1], "/memory/usage"),
+		}
+		cpuUsed += usage.CpuCores
+		memoryUsed += usage.Memory
+		usages = append(usages, usage)
+	}
+	topBy := func(less func(a, b containerUsage) bool) []containerUsage {
+		sorted := append([]containerUsage(nil), usages...)
+		sort.Sort(usageSorter{sorted, less})
+		if len(sorted) > top {
+			sorted = sorted[:top]
+		}
+		return sorted
+	}
+	return map[string]interface{}{
+		"cpu":        newResourcePressure(cpuCapacity, cpuUsed),
+		"memory":     newResourcePressure(memoryCapacity, memoryUsed),
+		"top_cpu":    topBy(func(a, b containerUsage) bool { return a.CpuCores > b.CpuCores }),
+		"top_memory": topBy(func(a, b containerUsage) bool { return a.Memory > b.Memory }),
+	}
+}
+
+func Pressure(server *server, w http.ResponseWriter, r *http.Request) {
+	top := defPressureTop
+	if topStr := r.URL.Query().Get("top"); topStr != "" {
+		var err error
+		if top, err = strconv.Atoi(topStr); err != nil || top < 0 {
+			http.Error(w, "Invalid value of top: "+topStr, http.StatusBadRequest)
+			return
+		}
+	}
+	writeResponse(w, r, http.StatusOK, buildPressureResponse(server.snapshot(w), top))
+}
@@ -0,0 +1,239 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	cadv "github.com/google/cadvisor/info/v1"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+const (
+	prometheusMetricPrefix = "container"
+	sourceMetricPrefix     = "publisher_source_metrics"
+)
+
+var prometheusInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// prometheusListLabels tells which field identifies elements of lists
+//found in stats, and under which label it's exposed
+var prometheusListLabels = map[string]struct{ field, label string }{
+	"interfaces": {"name", "interface"},
+	"filesystem": {"device", "device"},
+}
+
+type prometheusSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// prometheusCollector flattens the most recent stats of containers into
+//samples grouped by metric name
+type prometheusCollector struct {
+	samples map[string][]prometheusSample
+}
+
+func (c *prometheusCollector) add(name string, labels map[string]string, value float64) {
+	c.samples[name] = append(c.samples[name], prometheusSample{labels: labels, value: value})
+}
+
+func (c *prometheusCollector) collect(name string, obj interface{}, labels map[string]string) {
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		for key, child := range obj {
+			c.collect(name+"_"+prometheusInvalidChars.ReplaceAllString(key, "_"), child, labels)
+		}
+	case []interface{}:
+		listLabel, isKnownList := prometheusListLabels[name[strings.LastIndex(name, "_")+1:]]
+		if !isKnownList {
+			return
+		}
+		for _, elem := range obj {
+			elemMap, isMap := elem.(map[string]interface{})
+			if !isMap {
+				continue
+			}
+			id, _ := elemMap[listLabel.field].(string)
+			elemLabels := withLabel(labels, listLabel.label, id)
+			for key, child := range elemMap {
+				if key != listLabel.field {
+					c.collect(name+"_"+prometheusInvalidChars.ReplaceAllString(key, "_"), child, elemLabels)
+				}
+			}
+		}
+	default:
+		if value, isNumber := toFloat(obj); isNumber {
+			c.add(name, labels, value)
+		}
+	}
+}
+
+// collectCustom exposes the most recent value of each custom metric
+func (c *prometheusCollector) collectCustom(customMetrics map[string]interface{}, labels map[string]string) {
+	for metricName, values := range customMetrics {
+		valueList, _ := values.([]interface{})
+		if len(valueList) == 0 {
+			continue
+		}
+		var value float64
+		switch last := valueList[len(valueList)-1].(type) {
+		case cadv.MetricVal:
+			value = last.FloatValue + float64(last.IntValue)
+		case map[string]interface{}:
+			floatValue, _ := toFloat(last["float_value"])
+			intValue, _ := toFloat(last["int_value"])
+			value = floatValue + intValue
+		default:
+			continue
+		}
+		c.add(prometheusMetricPrefix+"_custom_metric", withLabel(labels, "metric", metricName), value)
+	}
+}
+
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	res := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	res[name] = value
+	return res
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case uint32:
+		return float64(value), true
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case json.Number:
+		floatValue, err := value.Float64()
+		return floatValue, err == nil
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(labels[name])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// buildPrometheusResponse renders the most recent stats of all containers
+//in Prometheus text exposition format
+func buildPrometheusResponse(server *server, model *exchange.ReadModel) []byte {
+	res := renderPrometheus(model.DockerStorage)
+	return append(res, renderSourceCounters(server.state.Sources.Counters())...)
+}
+
+// renderSourceCounters renders counters of metrics received from every
+//source of metrics, so misbehaving collectors may be told apart
+func renderSourceCounters(counters map[string]exchange.SourceCounters) []byte {
+	collector := prometheusCollector{samples: map[string][]prometheusSample{}}
+	for source, counter := range counters {
+		labels := map[string]string{"source": source}
+		collector.add(sourceMetricPrefix+"_received", labels, float64(counter.Received))
+		collector.add(sourceMetricPrefix+"_mapped", labels, float64(counter.Mapped))
+		collector.add(sourceMetricPrefix+"_dropped", labels, float64(counter.Dropped))
+	}
+	return collector.render()
+}
+
+// renderPrometheus renders the most recent stats of given containers
+func renderPrometheus(storage map[string]interface{}) []byte {
+	collector := prometheusCollector{samples: map[string][]prometheusSample{}}
+	for dockerName, dockerObj := range storage {
+		dockerMap := dockerObj.(map[string]interface{})
+		statsList, _ := dockerMap["stats"].([]interface{})
+		if len(statsList) == 0 {
+			continue
+		}
+		// stats are kept in order of timestamps
+		statsMap := statsList[len(statsList)-1].(map[string]interface{})
+		id, _ := dockerMap["id"].(string)
+		labels := map[string]string{"container": dockerName, "id": id}
+		for group, groupObj := range statsMap {
+			switch group {
+			case "timestamp":
+			case "custom_metrics":
+				customMetrics, _ := groupObj.(map[string]interface{})
+				collector.collectCustom(customMetrics, labels)
+			default:
+				collector.collect(prometheusMetricPrefix+"_"+prometheusInvalidChars.ReplaceAllString(group, "_"), groupObj, labels)
+			}
+		}
+	}
+	return collector.render()
+}
+
+// render writes samples in text exposition format, sorted by names
+func (c *prometheusCollector) render() []byte {
+	names := make([]string, 0, len(c.samples))
+	for name := range c.samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "# TYPE %s untyped\n", name)
+		for _, sample := range c.samples[name] {
+			fmt.Fprintf(&buf, "%s%s %s\n", name, formatLabels(sample.labels),
+				strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+	}
+	return buf.Bytes()
+}
+
+func Metrics(server *server, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buildPrometheusResponse(server, server.snapshot(w)))
+}
@@ -0,0 +1,170 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+)
+
+const proxyRequestTimeout = 10 * time.Second
+
+// nodeProxy forwards stats requests to publishers running on other nodes,
+//caching their responses for a configured period; besides configured
+//nodes, those found by discovery are served
+type nodeProxy struct {
+	sync.Mutex
+	nodes    map[string]string
+	cacheTTL time.Duration
+	client   *http.Client
+	cache    map[string]proxyCacheEntry
+	auth     *authenticator
+	logger   *log.Logger
+
+	discover          func() (map[string]string, error)
+	discoveryInterval time.Duration
+	discoveryLock     sync.Mutex
+	discovered        map[string]string
+	discoveredAt      time.Time
+}
+
+type proxyCacheEntry struct {
+	status  int
+	body    []byte
+	expires time.Time
+}
+
+func newNodeProxy(nodes map[string]string, cacheTTL time.Duration, auth *authenticator, logger *log.Logger) *nodeProxy {
+	return &nodeProxy{
+		logger:   logger,
+		nodes:    nodes,
+		cacheTTL: cacheTTL,
+		client:   &http.Client{Timeout: proxyRequestTimeout},
+		cache:    map[string]proxyCacheEntry{},
+		auth:     auth,
+	}
+}
+
+// lookupNode returns base URL of given node's publisher; configured nodes
+//take precedence over discovered ones, which are refreshed once they're
+//older than discovery interval
+func (p *nodeProxy) lookupNode(node string) (string, bool) {
+	if baseUrl, configured := p.nodes[node]; configured {
+		return baseUrl, true
+	}
+	if p.discover == nil {
+		return "", false
+	}
+	p.discoveryLock.Lock()
+	defer p.discoveryLock.Unlock()
+	if p.discovered == nil || time.Since(p.discoveredAt) > p.discoveryInterval {
+		// failed discovery is retried no sooner than after the interval,
+		//nodes found previously are kept meanwhile
+		p.discoveredAt = time.Now()
+		if discovered, err := p.discover(); err != nil {
+			p.logger.Warnf("Failed to discover nodes: %v", err)
+		} else {
+			p.discovered = discovered
+		}
+	}
+	baseUrl, discovered := p.discovered[node]
+	return baseUrl, discovered
+}
+
+// fetch returns response of given node's publisher for the stats request,
+//served from cache if a fresh copy is available
+func (p *nodeProxy) fetch(node string, request []byte) (int, []byte, error) {
+	baseUrl, knownNode := p.lookupNode(node)
+	if !knownNode {
+		return http.StatusNotFound, nil, fmt.Errorf("Unknown node '%s'", node)
+	}
+	cacheKey := node + "\x00" + string(request)
+	p.Lock()
+	entry, cached := p.cache[cacheKey]
+	p.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.status, entry.body, nil
+	}
+	url := strings.TrimRight(baseUrl, "/") + "/stats/container/"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(request))
+	if err != nil {
+		return http.StatusBadGateway, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// other nodes are expected to share credentials of this one
+	p.auth.apply(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return http.StatusBadGateway, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return http.StatusBadGateway, nil, err
+	}
+	if p.cacheTTL > 0 && resp.StatusCode == http.StatusOK {
+		p.Lock()
+		p.dropExpired()
+		p.cache[cacheKey] = proxyCacheEntry{status: resp.StatusCode, body: body, expires: time.Now().Add(p.cacheTTL)}
+		p.Unlock()
+	}
+	return resp.StatusCode, body, nil
+}
+
+func (p *nodeProxy) dropExpired() {
+	now := time.Now()
+	for k, entry := range p.cache {
+		if now.After(entry.expires) {
+			delete(p.cache, k)
+		}
+	}
+}
+
+func NodeStats(server *server, w http.ResponseWriter, r *http.Request) {
+	node := mux.Vars(r)["node"]
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		panic(err)
+	}
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	status, res, err := server.proxy.fetch(node, body)
+	if err != nil {
+		server.logger.WithField("node", node).Warnf("Failed to fetch stats from node: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(res)
+}
@@ -0,0 +1,150 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+// queryRequest selects containers by names, ids or labels, along with
+//a time range of their stats and metrics of the stats to return
+type queryRequest struct {
+	// Containers lists names, ids or aliases of containers; all
+	//containers are selected if it's empty
+	Containers []string `json:"containers,omitempty"`
+	// Labels selects containers having all the given labels
+	Labels map[string]string `json:"labels,omitempty"`
+	// Metrics lists paths of stats fields to return, e.g. /cpu/usage/total;
+	//whole stats are returned if it's empty
+	Metrics []string `json:"metrics,omitempty"`
+	exchange.StatsRequest
+}
+
+// matches tells if container is selected by the query
+func (q *queryRequest) matches(dockerName string, dockerMap map[string]interface{}) bool {
+	if len(q.Containers) > 0 {
+		found := false
+		for _, container := range q.Containers {
+			if name, _ := dockerMap["name"].(string); container == dockerName || container == name || matchesDockerId(dockerName, dockerMap, container) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	labels, _ := dockerMap["labels"].(map[string]interface{})
+	for label, value := range q.Labels {
+		if labels[label] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// projectStats copies only selected metrics of stats object, along with
+//its timestamp
+func projectStats(statsMap map[string]interface{}, metrics []string) map[string]interface{} {
+	res := map[string]interface{}{"timestamp": statsMap["timestamp"]}
+	walker := util.NewObjWalker(statsMap)
+	for _, metric := range metrics {
+		value, err := walker.Seek(metric)
+		if err != nil || value == nil {
+			continue
+		}
+		elems := strings.Split(strings.Trim(metric, "/"), "/")
+		node := res
+		for _, elem := range elems[:len(elems)-1] {
+			child, isMap := node[elem].(map[string]interface{})
+			if !isMap {
+				child = map[string]interface{}{}
+				node[elem] = child
+			}
+			node = child
+		}
+		node[elems[len(elems)-1]] = value
+	}
+	return res
+}
+
+// parseQueryRequest decodes query from the body, replying with an error
+//if it's malformed
+func parseQueryRequest(w http.ResponseWriter, r *http.Request) (*queryRequest, bool) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		panic(err)
+	}
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+	var query queryRequest
+	if err := json.Unmarshal(body, &query); err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), 422)
+		return nil, false
+	}
+	var queryJson map[string]interface{}
+	json.Unmarshal(body, &queryJson)
+	if _, gotStart := queryJson["start"]; !gotStart {
+		query.Start = time.Time{}
+	}
+	if _, gotEnd := queryJson["end"]; !gotEnd {
+		query.End = time.Now()
+	}
+	return &query, true
+}
+
+// Query serves stats of all containers selected by the query in one
+//response, keyed by names, the same way as stats endpoint does
+func Query(server *server, w http.ResponseWriter, r *http.Request) {
+	query, valid := parseQueryRequest(w, r)
+	if !valid {
+		return
+	}
+	model := server.snapshot(w)
+	names := []string{}
+	for dockerName, dockerObj := range model.DockerStorage {
+		if query.matches(dockerName, dockerObj.(map[string]interface{})) {
+			names = append(names, dockerName)
+		}
+	}
+	sort.Strings(names)
+	res := buildStatsResponse(server, model, names, &query.StatsRequest, len(query.Metrics) == 0, "")
+	if len(query.Metrics) > 0 {
+		for _, dockerMap := range res.(map[string]map[string]interface{}) {
+			statsList := dockerMap["stats"].([]interface{})
+			projected := make([]interface{}, 0, len(statsList))
+			for _, statsObj := range statsList {
+				projected = append(projected, projectStats(statsObj.(map[string]interface{}), query.Metrics))
+			}
+			dockerMap["stats"] = projected
+		}
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
@@ -0,0 +1,247 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Serializer renders response objects in some output format
+type Serializer interface {
+	// ContentType is set as Content-Type of rendered responses
+	ContentType() string
+	Serialize(w io.Writer, v interface{}) error
+}
+
+const (
+	defaultFormat = "json"
+	// genericMetricPrefix starts names of metrics exposed for objects
+	//other than containers
+	genericMetricPrefix = "publisher"
+)
+
+var (
+	serializersLock sync.RWMutex
+	// serializersByFormat holds serializers by names accepted in format
+	//query parameter
+	serializersByFormat = map[string]Serializer{}
+	// serializersByType holds serializers by media types accepted in
+	//Accept header
+	serializersByType = map[string]Serializer{}
+)
+
+func init() {
+	RegisterSerializer("json", jsonSerializer{}, "application/json")
+	RegisterSerializer("msgpack", msgpackSerializer{}, "application/msgpack", "application/x-msgpack")
+	RegisterSerializer("csv", csvSerializer{}, "text/csv")
+	// text/plain is accepted by too many clients to pick Prometheus
+	//format, it has to be asked for explicitly
+	RegisterSerializer("prometheus", prometheusSerializer{})
+}
+
+// RegisterSerializer makes serializer available under given format name
+//and given media types accepted in Accept header; it replaces serializer
+//registered before under the same name or type
+func RegisterSerializer(format string, serializer Serializer, mediaTypes ...string) {
+	serializersLock.Lock()
+	defer serializersLock.Unlock()
+	serializersByFormat[format] = serializer
+	for _, contentType := range mediaTypes {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			serializersByType[mediaType] = serializer
+		}
+	}
+}
+
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+type acceptedTypes []acceptedType
+
+func (a acceptedTypes) Len() int {
+	return len(a)
+}
+
+func (a acceptedTypes) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a acceptedTypes) Less(i, j int) bool {
+	return a[i].quality > a[j].quality
+}
+
+// negotiateSerializer picks serializer by format query parameter or,
+//if it's absent, by the most preferred type in Accept header known to
+//the registry; JSON is the fallback
+func negotiateSerializer(r *http.Request) (Serializer, bool) {
+	serializersLock.RLock()
+	defer serializersLock.RUnlock()
+	if format := r.URL.Query().Get("format"); format != "" {
+		serializer, known := serializersByFormat[format]
+		return serializer, known
+	}
+	accepted := acceptedTypes{}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, haveQ := params["q"]; haveQ {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			accepted = append(accepted, acceptedType{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.Stable(accepted)
+	for _, acceptedType := range accepted {
+		if serializer, known := serializersByType[acceptedType.mediaType]; known {
+			return serializer, true
+		}
+	}
+	return serializersByFormat[defaultFormat], true
+}
+
+// writeResponse renders response object in format negotiated with client
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	serializer, known := negotiateSerializer(r)
+	if !known {
+		http.Error(w, "Unknown format: "+r.URL.Query().Get("format"), http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Set("Content-Type", serializer.ContentType())
+	w.WriteHeader(status)
+	if err := serializer.Serialize(w, v); err != nil {
+		panic(err)
+	}
+}
+
+// toGeneric turns response object into generic maps, lists and values,
+//as decoded from its JSON form; numbers are kept as json.Number
+func toGeneric(v interface{}) (interface{}, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	decoder.UseNumber()
+	var res interface{}
+	err = decoder.Decode(&res)
+	return res, err
+}
+
+// asContainerStorage tells if object holds container (or pod) objects
+//by their names, each having a list of stats
+func asContainerStorage(v interface{}) (map[string]interface{}, bool) {
+	var storage map[string]interface{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		storage = v
+	case map[string]map[string]interface{}:
+		// stats responses are built of generic objects already
+		storage = make(map[string]interface{}, len(v))
+		for name, obj := range v {
+			storage[name] = obj
+		}
+	}
+	if len(storage) == 0 {
+		return nil, false
+	}
+	for _, obj := range storage {
+		objMap, isMap := obj.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		if _, haveStats := objMap["stats"].([]interface{}); !haveStats {
+			return nil, false
+		}
+	}
+	return storage, true
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) ContentType() string {
+	return "application/json; charset=UTF-8"
+}
+
+func (jsonSerializer) Serialize(w io.Writer, v interface{}) error {
+	if encoded, isEncoded := v.(encodedObjects); isEncoded {
+		var buf bytes.Buffer
+		encoded.writeTo(&buf)
+		buf.WriteByte('\n')
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+type prometheusSerializer struct{}
+
+func (prometheusSerializer) ContentType() string {
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+// Serialize exposes the most recent stats of each container, if object
+//holds containers; numeric fields of other objects are exposed unlabeled
+func (prometheusSerializer) Serialize(w io.Writer, v interface{}) error {
+	if storage, isStorage := asContainerStorage(v); isStorage {
+		_, err := w.Write(renderPrometheus(storage))
+		return err
+	}
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	if storage, isStorage := asContainerStorage(generic); isStorage {
+		_, err = w.Write(renderPrometheus(storage))
+		return err
+	}
+	collector := prometheusCollector{samples: map[string][]prometheusSample{}}
+	if list, isList := generic.([]interface{}); isList {
+		// elements of lists are told apart by their names, if they have any
+		for idx, elem := range list {
+			labels := map[string]string{"index": strconv.Itoa(idx)}
+			if elemMap, isMap := elem.(map[string]interface{}); isMap {
+				if name, haveName := elemMap["name"].(string); haveName {
+					labels = map[string]string{"name": name}
+				}
+			}
+			collector.collect(genericMetricPrefix, elem, labels)
+		}
+	} else {
+		collector.collect(genericMetricPrefix, generic, map[string]string{})
+	}
+	_, err = w.Write(collector.render())
+	return err
+}
@@ -22,6 +22,7 @@ package server
 import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"net"
 	"net/http"
 
 	"encoding/json"
@@ -34,17 +35,125 @@ import (
 	"sync"
 	"time"
 	"sort"
-	"os"
+	"strconv"
+	"strings"
 )
 
-var logger *log.Logger
-var once sync.Once
+// snapshotVersionHeader tells version of the read model a response was
+//built from
+const snapshotVersionHeader = "X-Snapshot-Version"
 
 type server struct {
-	state *exchange.InnerState
-	addr string
-	port int
-	stats serverStats
+	state        *exchange.InnerState
+	addr         string
+	port         int
+	adminAddr    string
+	adminPort    int
+	stats        serverStats
+	proxy        *nodeProxy
+	auth         authenticator
+	grpcPort     int
+	loadTemplate func() error
+	compress     bool
+	debugStats   func() map[string]interface{}
+	dumpState    func() (string, error)
+	pprof        bool
+
+	// lastStateDump tells when state was last dumped through the API
+	dumpLock      sync.Mutex
+	lastStateDump time.Time
+
+	// maxResponseSize limits size of responses, in bytes, if positive
+	maxResponseSize int
+	// streamOrigins lists origins allowed to open stream connections
+	//besides the server's own one
+	streamOrigins []string
+	logger        *log.Logger
+
+	// configuredPort is the port requested in config, port is the one
+	//actually listened on
+	configuredPort int
+
+	// inFlight counts requests being served; done is closed on shutdown,
+	//ending long-lived streams, and releases close listeners and idle
+	//connections
+	inFlight  int64
+	done      chan struct{}
+	lifecycle sync.Mutex
+	stopping  bool
+	releases  []func()
+	conns     map[net.Conn]http.ConnState
+}
+
+// Config holds settings of the embedded REST server
+type Config struct {
+	Addr string
+	Port int
+	// ProxyNodes maps names of other nodes to base URLs of their publishers
+	ProxyNodes map[string]string
+	// ProxyCacheTTL defines how long responses from other nodes are cached
+	ProxyCacheTTL time.Duration
+	// DiscoverNodes finds publishers of other nodes, returning base URLs of
+	//them keyed by node names, in addition to ProxyNodes
+	DiscoverNodes func() (map[string]string, error)
+	// DiscoveryInterval defines how long discovered nodes are kept before
+	//discovering them again
+	DiscoveryInterval time.Duration
+	// AdminAddr and AdminPort define a separate listener serving the full
+	//surface, including admin and debug routes; if AdminPort is 0 admin
+	//routes aren't served at all
+	AdminAddr string
+	AdminPort int
+	// AuthToken is a bearer token required by all routes but probes
+	AuthToken string
+	// AuthUser and AuthPassword are basic-auth credentials required by all
+	//routes but probes, accepted alternatively to AuthToken
+	AuthUser     string
+	AuthPassword string
+	// GrpcPort enables gRPC streaming API on given port, listening on Addr
+	GrpcPort int
+	// LoadTemplate loads the metric template again at runtime from its
+	//configured location, keeping the previous one on error
+	LoadTemplate func() error
+	// PortFallback is the number of ports following Port tried in turn
+	//if Port is already bound; with 0 server fails if Port is taken
+	PortFallback int
+	// Compression enables gzip and deflate compression of responses for
+	//clients accepting them
+	Compression bool
+	// MaxResponseSize limits size of responses, in bytes, if positive;
+	//stats responses are truncated to fit it and continued on next pages
+	MaxResponseSize int
+	// DebugStats reports publisher's own statistics, template info and
+	//config in effect
+	DebugStats func() map[string]interface{}
+	// DumpState writes the entire state of the publisher to a file,
+	//returning its name
+	DumpState func() (string, error)
+	// Pprof enables profiling routes of net/http/pprof
+	Pprof bool
+	// PortFile names a file the port bound is written to, as JSON, e.g.
+	//when Port is 0 and the system chooses one
+	PortFile string
+	// RegisterUrl is an endpoint the port bound is posted to, as JSON, and
+	//withdrawn from with DELETE on shutdown
+	RegisterUrl string
+	// StreamOrigins lists origins (e.g. "https://dashboard:8080") allowed
+	//to open WebSocket streams besides the server's own one; "*" allows any
+	StreamOrigins []string
+	// Logger receives logs of the server; the standard logger is used if
+	//not given
+	Logger *log.Logger
+}
+
+type route struct {
+	methods []string
+	path    string
+	handler func(*server, http.ResponseWriter, *http.Request)
+	// admin routes are not served on stats-only listener
+	admin bool
+	// probe routes don't count as consumer activity
+	probe bool
 }
 
 type serverStats struct {
@@ -56,24 +165,164 @@ type serverStats struct {
 	statsDdLast	int
 }
 
-func EnsureStarted(state *exchange.InnerState, addr string, port int) error {
-        var err error
-	once.Do(func() {
-		server := server{state: state, addr: addr, port: port}
-                go func () { err = ServerFunc(&server) }()
+// Instance is a server started for a publisher instance; each serves its
+//own state on its own ports
+type Instance struct {
+	server *server
+}
+
+// Start binds server's port and starts serving state in background
+func Start(state *exchange.InnerState, config Config) (*Instance, error) {
+	server := &server{state: state, done: make(chan struct{}), addr: config.Addr, port: config.Port, configuredPort: config.Port,
+		adminAddr: config.AdminAddr, adminPort: config.AdminPort, grpcPort: config.GrpcPort, loadTemplate: config.LoadTemplate, compress: config.Compression,
+		maxResponseSize: config.MaxResponseSize, debugStats: config.DebugStats, dumpState: config.DumpState, pprof: config.Pprof,
+		streamOrigins: config.StreamOrigins, logger: config.Logger,
+		auth: authenticator{token: config.AuthToken, user: config.AuthUser, password: config.AuthPassword}}
+	if server.logger == nil {
+		server.logger = log.StandardLogger()
+	}
+	if len(config.ProxyNodes) > 0 || config.DiscoverNodes != nil {
+		server.proxy = newNodeProxy(config.ProxyNodes, config.ProxyCacheTTL, &server.auth, server.logger)
+		server.proxy.discover, server.proxy.discoveryInterval = config.DiscoverNodes, config.DiscoveryInterval
+	}
+	listener, err := server.listen(config.PortFallback)
+	if err != nil {
+		state.Events.Record(exchange.SeverityError, "server", err.Error())
+		return nil, err
+	}
+	// listener is closed by shutdown even if serving didn't start yet, so
+	//its port is free once shutdown returns
+	server.onShutdown(func() {
+		listener.Close()
 	})
+	server.advertise(config.PortFile, config.RegisterUrl)
+	go func() {
+		if err := ServerFunc(server, listener); err != nil && !server.isStopping() {
+			server.logger.WithField("listen_addr", listener.Addr().String()).Errorf("Server failed: %v", err)
+		}
+	}()
+	return &Instance{server: server}, nil
+}
+
+// Port tells the port server listens on
+func (i *Instance) Port() int {
+	return i.server.port
+}
+
+// listen binds the configured port or, if it's taken, the first free one
+//of fallback ports following it; port 0 lets the system choose a free
+//one. The port bound is recorded in the server
+func (server *server) listen(fallback int) (net.Listener, error) {
+	if server.configuredPort == 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:0", server.addr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind ephemeral server port: %v", err)
+		}
+		server.port = listener.Addr().(*net.TCPAddr).Port
+		return listener, nil
+	}
+	var firstErr error
+	for port := server.configuredPort; port <= server.configuredPort+fallback; port++ {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", server.addr, port))
+		if err == nil {
+			server.port = port
+			if port != server.configuredPort {
+				message := fmt.Sprintf("port %d is taken, listening on port %d instead", server.configuredPort, port)
+				server.logger.WithField("server_port", server.configuredPort).Warnf("Server %s", message)
+				server.state.Events.Record(exchange.SeverityWarning, "server", message)
+			}
+			return listener, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, fmt.Errorf("failed to bind server port %d (with %d fallback ports): %v", server.configuredPort, fallback, firstErr)
+}
+
+func ServerFunc(server *server, listener net.Listener) error {
+	// admin routes are served only by the admin listener, never by the
+	//main one, which is usually reachable over the pod network
+	if server.adminPort > 0 && !util.HasFeature(featureAdmin) {
+		server.logger.WithField("admin_port", server.adminPort).Warnf("Admin listener disabled, admin APIs not compiled in")
+	} else if server.adminPort > 0 {
+		adminAddr := fmt.Sprintf("%s:%d", server.adminAddr, server.adminPort)
+		server.logger.WithField("listen_addr", adminAddr).Info("Admin server will now listen")
+		go func() {
+			listener, err := net.Listen("tcp", adminAddr)
+			if err == nil {
+				err = server.serve(listener, newRouter(server, true))
+			}
+			if err != nil && !server.isStopping() {
+				server.logger.WithField("listen_addr", adminAddr).Errorf("Admin server failed: %v", err)
+			}
+		}()
+	}
+	if server.grpcPort > 0 {
+		startGrpc(server)
+	}
+	router := newRouter(server, false)
+	server.logger.WithField("listen_addr", listener.Addr().String()).Info("Server will now listen")
+        err := server.serve(listener, router)
         return err
 }
 
-func ServerFunc(server *server) error {
-	log.SetOutput(os.Stderr)
-	logger = log.New()
+func (server *server) routes() []route {
+	routes := []route{
+		{methods: []string{"POST"}, path: "/stats/container/", handler: Stats},
+		{methods: []string{"POST"}, path: "/query", handler: Query},
+		{methods: []string{"GET"}, path: "/readyz", handler: Readyz, probe: true},
+		{methods: []string{"GET"}, path: "/healthz", handler: Healthz, probe: true},
+		{methods: []string{"GET"}, path: "/spec", handler: Spec},
+		{methods: []string{"GET"}, path: "/spec/machine", handler: MachineSpec},
+		{methods: []string{"GET"}, path: "/spec/{id:.+}", handler: Spec},
+		{methods: []string{"GET"}, path: "/schema", handler: Schema},
+		{methods: []string{"GET"}, path: "/metrics", handler: Metrics},
+		{methods: []string{"GET"}, path: "/pressure", handler: Pressure},
+		{methods: []string{"GET"}, path: "/groups", handler: Groups},
+		{methods: []string{"GET"}, path: "/containers", handler: Containers},
+		{methods: []string{"POST"}, path: "/stats/pod/", handler: PodStats},
+		{methods: []string{"GET"}, path: "/pods", handler: Pods},
+		{methods: []string{"GET"}, path: "/stream", handler: Stream},
+		{methods: []string{"GET", "POST"}, path: "/api/v1.3/containers{name:(?:/.*)?}", handler: CadvisorContainer},
+		{methods: []string{"GET", "POST"}, path: "/api/v1.3/subcontainers{name:(?:/.*)?}", handler: CadvisorSubcontainers},
+		{methods: []string{"GET", "POST"}, path: "/api/v1.3/docker{name:(?:/.*)?}", handler: CadvisorDocker},
+		{methods: []string{"GET"}, path: "/api/v1.3/machine", handler: CadvisorMachine},
+	}
+	routes = append(routes, featureRoutes...)
+	routes = append(routes, adminRoutes...)
+	if server.pprof {
+		routes = append(routes, pprofRoutes...)
+	}
+	if server.proxy != nil {
+		routes = append(routes, route{methods: []string{"GET", "POST"}, path: "/nodes/{node}/stats", handler: NodeStats})
+	}
+	return routes
+}
+
+func newRouter(server *server, withAdmin bool) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
-	router.Methods("POST").Path("/stats/container/").HandlerFunc(wrapper(server, Stats))
-	listenAddr := fmt.Sprintf("%s:%d", server.addr, server.port)
-	log.WithField("listen_addr", listenAddr).Info("Server will now listen")
-        err := http.ListenAndServe(listenAddr, router)
-        return err
+	for _, r := range server.routes() {
+		if r.admin && !withAdmin {
+			continue
+		}
+		handler := r.handler
+		if !r.probe {
+			handler = touching(handler)
+			if server.auth.enabled() {
+				handler = authenticated(handler)
+			}
+		}
+		if server.maxResponseSize > 0 {
+			handler = limitingSize(handler)
+		}
+		if server.compress {
+			handler = compressing(handler)
+		}
+		handler = draining(handler)
+		router.Methods(r.methods...).Path(r.path).HandlerFunc(wrapper(server, handler))
+	}
+	return router
 }
 
 func copyFlat(data map[string]interface{}) map[string]interface{} {
@@ -103,37 +352,78 @@ func (s statsListType) Less(i, j int) bool {
 	return !a.Before(b)
 }
 
-func buildStatsResponse(server *server, stats *exchange.StatsRequest) (interface{}) {
-	state := server.state
-	state.RLock()
-	defer state.RUnlock()
-	ref := state.DockerStorage
+// snapshot returns the read model a response is built from, announcing
+//its version in the response headers; a response must be built from
+//a single snapshot, so that it reflects one point in time
+func (server *server) snapshot(w http.ResponseWriter) *exchange.ReadModel {
+	model := server.state.ReadModel.Get()
+	w.Header().Set(snapshotVersionHeader, strconv.FormatUint(model.Version, 10))
+	return model
+}
+
+// containerFilter narrows stats response to containers of given name
+//or id; empty fields match any container
+type containerFilter struct {
+	name string
+	id   string
+}
+
+func (f containerFilter) matches(dockerName string, dockerMap map[string]interface{}) bool {
+	if f.name != "" {
+		if name, _ := dockerMap["name"].(string); name != f.name && dockerName != f.name {
+			return false
+		}
+	}
+	if f.id != "" && !matchesDockerId(dockerName, dockerMap, f.id) {
+		return false
+	}
+	return true
+}
+
+// selectContainers lists names of containers passing the filter which
+//fall into requested page, in order of names; it tells also if more
+//containers follow the page
+func selectContainers(model *exchange.ReadModel, filter containerFilter, page pageRequest) ([]string, bool) {
+	names := []string{}
+	for dockerName, dockerObj := range model.DockerStorage {
+		if page.includes(dockerName) && filter.matches(dockerName, dockerObj.(map[string]interface{})) {
+			names = append(names, dockerName)
+		}
+	}
+	sort.Strings(names)
+	if page.limit > 0 && len(names) > page.limit {
+		return names[:page.limit], true
+	}
+	return names, false
+}
+
+// buildStatsResponse picks stats of given containers within requested
+//time range; with resolution given, stats are picked from the downsampled
+//tier of that resolution instead of the full history
+func buildStatsResponse(server *server, model *exchange.ReadModel, names []string, stats *exchange.StatsRequest, withSpec bool, resolution string) (interface{}) {
+	ref := model.DockerStorage
 	res := map[string]map[string]interface{}{}
 	stats_statsTx := 0
 	stats_statsDd := 0
-	for dockerName, dockerObj := range ref {
+	for _, dockerName := range names {
+		dockerObj := ref[dockerName]
 		dockerCopy := copyFlat(dockerObj.(map[string]interface{}))
 		statsList := dockerCopy["stats"].([]interface{})
-		statsSorted := make([]interface{}, 0, len(statsList))
-		for _, statsObj := range statsList {
-			statsSorted = append(statsSorted, statsObj)
-		}
-		sort.Sort(statsListType(statsSorted))
-		statsCopy := make([]interface{}, 0, len(statsSorted))
-		for _, statsObj := range statsSorted {
-			statsMap := statsObj.(map[string]interface{})
-			ckStamp, _ := util.ParseTime(statsMap["timestamp"].(string))
-			if ckStamp.Before(stats.Start) || ckStamp.After(stats.End) {
-				stats_statsDd++
-				continue
-			}
-			statsCopy = append(statsCopy, statsObj)
-			stats_statsTx++
-			if stats.NumStats > 0 && len(statsCopy) >= stats.NumStats {
-				break
-			}
+		var statsCopy []interface{}
+		if resolution != "" {
+			statsList = model.Downsampled[dockerName][resolution]
+			statsCopy = selectStats(statsList, stats)
+		} else if index, haveIndex := model.StatsIndex[dockerName]; haveIndex && len(index) == len(statsList) {
+			statsCopy = selectIndexedStats(statsList, index, stats)
+		} else {
+			statsCopy = selectStats(statsList, stats)
 		}
+		stats_statsDd += len(statsList) - len(statsCopy)
+		stats_statsTx += len(statsCopy)
 		dockerCopy["stats"] = statsCopy
+		if !withSpec {
+			delete(dockerCopy, "spec")
+		}
 		res[dockerName] = dockerCopy
 	}
 	// update the statistics
@@ -150,7 +440,123 @@ func buildStatsResponse(server *server, stats *exchange.StatsRequest) (interface
 	return res
 }
 
+// selectIndexedStats picks stats within requested time range, most recent
+//first, using binary search over the timestamp index
+func selectIndexedStats(statsList []interface{}, index exchange.StatsIndex, stats *exchange.StatsRequest) []interface{} {
+	lo, hi := index.Range(stats.Start, stats.End)
+	if stats.NumStats > 0 && hi-lo > stats.NumStats {
+		lo = hi - stats.NumStats
+	}
+	statsCopy := make([]interface{}, 0, hi-lo)
+	for i := hi - 1; i >= lo; i-- {
+		statsCopy = append(statsCopy, statsList[i])
+	}
+	return statsCopy
+}
+
+// selectStats picks stats within requested time range, most recent first,
+//for stats lacking valid index
+func selectStats(statsList []interface{}, stats *exchange.StatsRequest) []interface{} {
+	statsSorted := make([]interface{}, 0, len(statsList))
+	for _, statsObj := range statsList {
+		statsSorted = append(statsSorted, statsObj)
+	}
+	sort.Sort(statsListType(statsSorted))
+	statsCopy := make([]interface{}, 0, len(statsSorted))
+	for _, statsObj := range statsSorted {
+		statsMap := statsObj.(map[string]interface{})
+		ckStamp, _ := util.ParseTime(statsMap["timestamp"].(string))
+		if ckStamp.Before(stats.Start) || ckStamp.After(stats.End) {
+			continue
+		}
+		statsCopy = append(statsCopy, statsObj)
+		if stats.NumStats > 0 && len(statsCopy) >= stats.NumStats {
+			break
+		}
+	}
+	return statsCopy
+}
+
+func hasResolution(resolutions []string, resolution string) bool {
+	for _, known := range resolutions {
+		if known == resolution {
+			return true
+		}
+	}
+	return false
+}
+
 func Stats(server *server, w http.ResponseWriter, r *http.Request) {
+	stats, valid := parseStatsRequest(w, r)
+	if !valid {
+		return
+	}
+	query := r.URL.Query()
+	withSpec := query.Get("spec") != "0"
+	filter := containerFilter{name: query.Get("name"), id: query.Get("id")}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if countStr := query.Get("count"); countStr != "" {
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 0 {
+			http.Error(w, "Invalid count: "+countStr, http.StatusBadRequest)
+			return
+		}
+		if count > 0 && (stats.NumStats <= 0 || count < stats.NumStats) {
+			stats.NumStats = count
+		}
+	}
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		since, err := util.ParseTime(sinceStr)
+		if err != nil {
+			http.Error(w, "Invalid since: "+sinceStr, http.StatusBadRequest)
+			return
+		}
+		// only stats newer than since are picked
+		if since = since.Add(time.Nanosecond); since.After(stats.Start) {
+			stats.Start = since
+		}
+	}
+	resolution := ""
+	if resolutionStr := query.Get("resolution"); resolutionStr != "" {
+		parsed, err := time.ParseDuration(resolutionStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid resolution: "+resolutionStr, http.StatusBadRequest)
+			return
+		}
+		resolution = parsed.String()
+		if !hasResolution(server.state.Resolutions, resolution) {
+			http.Error(w, fmt.Sprintf("Unknown resolution: %s, downsampled tiers: %s", resolutionStr, strings.Join(server.state.Resolutions, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	model := server.snapshot(w)
+	names, more := selectContainers(model, filter, page)
+	res := buildStatsResponse(server, model, names, stats, withSpec, resolution)
+	if server.maxResponseSize > 0 {
+		// containers are encoded once, to fit them into the limit, and
+		//written out as they are
+		fitted, truncated := fitStatsResponse(res.(map[string]map[string]interface{}), names, server.maxResponseSize)
+		names, res = fitted.names, fitted
+		if truncated && len(names) == 0 {
+			http.Error(w, fmt.Sprintf("Stats of a single container exceed the limit of %d bytes, narrow them down with count or since parameters", server.maxResponseSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		more = more || truncated
+	}
+	if len(names) > 0 {
+		writeContinueToken(w, names[len(names)-1], more)
+	}
+	//server.logger.Infof("Received request: %+v; current time in seconds: %v, current time: %s, processing stats: %+v", stats, time.Now().Unix(), time.Now(), server.stats)
+	writeResponse(w, r, http.StatusOK, res)
+}
+
+// parseStatsRequest decodes stats request from the body, replying with
+//an error if it's malformed
+func parseStatsRequest(w http.ResponseWriter, r *http.Request) (*exchange.StatsRequest, bool) {
 	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 	if err != nil {
 		panic(err)
@@ -165,7 +571,7 @@ func Stats(server *server, w http.ResponseWriter, r *http.Request) {
 		if err := json.NewEncoder(w).Encode(err); err != nil {
 			panic(err)
 		}
-		return
+		return nil, false
 	}
 	var stats exchange.StatsRequest
 	json.Unmarshal(body, &stats)
@@ -175,17 +581,65 @@ func Stats(server *server, w http.ResponseWriter, r *http.Request) {
 	if _, gotEnd := statsJson["end"]; !gotEnd {
 		stats.End = time.Now()
 	}
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	return &stats, true
+}
+
+func Readyz(server *server, w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, server.state.Readiness, "ready", nil)
+}
+
+// Healthz reports health of components along with the port server listens
+//on, which differs from the configured one after falling back
+func Healthz(server *server, w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, server.state.Health, "ok", map[string]interface{}{
+		"port":            server.port,
+		"configured_port": server.configuredPort,
+	})
+}
+
+func Schema(server *server, w http.ResponseWriter, r *http.Request) {
+	schema := server.snapshot(w).Schema
+	if schema == nil {
+		http.Error(w, "Metric template not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
-	res := buildStatsResponse(server, &stats)
-	//logger.Infof("Received request: %+v; current time in seconds: %v, current time: %s, processing stats: %+v", stats, time.Now().Unix(), time.Now(), server.stats)
+	w.Write(schema)
+}
+
+func writeStatus(w http.ResponseWriter, board *exchange.StatusBoard, okStatus string, extra map[string]interface{}) {
+	ok, degraded := board.Status()
+	res := map[string]interface{}{"status": okStatus}
+	for k, v := range extra {
+		res[k] = v
+	}
+	if impaired := board.Impaired(); len(impaired) > 0 {
+		res["impaired"] = impaired
+	}
+	status := http.StatusOK
+	if !ok {
+		res["status"] = "degraded"
+		res["components"] = degraded
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		panic(err)
 	}
 }
 
+// touching records consumer activity before handling the request
+func touching(fu func(*server, http.ResponseWriter, *http.Request)) func(*server, http.ResponseWriter, *http.Request) {
+	return func(server *server, w http.ResponseWriter, r *http.Request) {
+		server.state.Activity.Touch()
+		fu(server, w, r)
+	}
+}
+
 func wrapper(server *server, fu func(*server, http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		Stats(server, w, r)
+		fu(server, w, r)
 	}
 }
@@ -0,0 +1,141 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// shutdownPollInterval is how often in-flight requests are checked while
+//the server is drained
+const shutdownPollInterval = 10 * time.Millisecond
+
+// onShutdown registers function releasing a resource of the server, e.g.
+//closing a listener, to be called on shutdown
+func (server *server) onShutdown(release func()) {
+	server.lifecycle.Lock()
+	defer server.lifecycle.Unlock()
+	if server.stopping {
+		release()
+		return
+	}
+	server.releases = append(server.releases, release)
+}
+
+// serve serves HTTP on listener until shutdown; connections are tracked,
+//so idle keep-alive ones can be closed then
+func (server *server) serve(listener net.Listener, handler http.Handler) error {
+	httpServer := &http.Server{Handler: handler, ConnState: server.trackConn}
+	server.onShutdown(func() {
+		httpServer.SetKeepAlivesEnabled(false)
+		listener.Close()
+		server.closeIdleConns()
+	})
+	return httpServer.Serve(listener)
+}
+
+// trackConn records state of connection; connections becoming idle during
+//shutdown are closed right away
+func (server *server) trackConn(conn net.Conn, state http.ConnState) {
+	server.lifecycle.Lock()
+	defer server.lifecycle.Unlock()
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(server.conns, conn)
+	case http.StateIdle:
+		if server.stopping {
+			conn.Close()
+			delete(server.conns, conn)
+			return
+		}
+		fallthrough
+	default:
+		if server.conns == nil {
+			server.conns = map[net.Conn]http.ConnState{}
+		}
+		server.conns[conn] = state
+	}
+}
+
+func (server *server) closeIdleConns() {
+	server.lifecycle.Lock()
+	defer server.lifecycle.Unlock()
+	for conn, state := range server.conns {
+		if state == http.StateIdle || state == http.StateNew {
+			conn.Close()
+			delete(server.conns, conn)
+		}
+	}
+}
+
+// isStopping tells if the server is being shut down, so errors of closed
+//listeners are expected
+func (server *server) isStopping() bool {
+	server.lifecycle.Lock()
+	defer server.lifecycle.Unlock()
+	return server.stopping
+}
+
+// draining counts requests being served, so shutdown can wait for them
+func draining(fu func(*server, http.ResponseWriter, *http.Request)) func(*server, http.ResponseWriter, *http.Request) {
+	return func(server *server, w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&server.inFlight, 1)
+		defer atomic.AddInt64(&server.inFlight, -1)
+		fu(server, w, r)
+	}
+}
+
+// Shutdown stops the server: listeners are closed, so their ports can be
+//bound again, streams are ended and requests in flight are given timeout
+//to complete
+func (i *Instance) Shutdown(timeout time.Duration) error {
+	server := i.server
+	server.lifecycle.Lock()
+	if server.stopping {
+		server.lifecycle.Unlock()
+		return nil
+	}
+	server.stopping = true
+	releases := server.releases
+	server.releases = nil
+	server.lifecycle.Unlock()
+	close(server.done)
+	for _, release := range releases {
+		release()
+	}
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&server.inFlight) > 0 {
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("server shut down with %d requests still in flight after %v", atomic.LoadInt64(&server.inFlight), timeout)
+			server.state.Events.Record(exchange.SeverityWarning, "server", err.Error())
+			return err
+		}
+		time.Sleep(shutdownPollInterval)
+	}
+	server.state.Events.Record(exchange.SeverityInfo, "server", "server shut down")
+	return nil
+}
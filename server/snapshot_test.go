@@ -0,0 +1,130 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+var testStart = time.Date(2016, 10, 16, 10, 0, 0, 0, time.UTC)
+
+// testReadModel builds snapshot of given version, in which each container
+//holds as many stats as the version tells
+func testReadModel(version uint64, names ...string) *exchange.ReadModel {
+	model := &exchange.ReadModel{
+		Version:       version,
+		DockerStorage: map[string]interface{}{},
+		StatsIndex:    map[string]exchange.StatsIndex{},
+	}
+	for _, name := range names {
+		statsList := []interface{}{}
+		index := exchange.StatsIndex{}
+		for seq := 0; seq < int(version); seq++ {
+			stamp := testStart.Add(time.Duration(seq) * time.Second)
+			statsList = append(statsList, map[string]interface{}{
+				"timestamp": stamp.Format(time.RFC3339),
+				"memory":    map[string]interface{}{"usage": seq},
+			})
+			index = append(index, stamp)
+		}
+		model.DockerStorage[name] = map[string]interface{}{"id": name, "name": name, "stats": statsList}
+		model.StatsIndex[name] = index
+	}
+	return model
+}
+
+func newTestServer() *server {
+	state := &exchange.InnerState{Activity: exchange.NewConsumerActivity()}
+	state.ReadModel.Publish(testReadModel(1, "/a", "/b"))
+	return &server{state: state, done: make(chan struct{})}
+}
+
+func getStats(t *testing.T, srv *server) (uint64, map[string]struct {
+	Stats []interface{} `json:"stats"`
+}) {
+	req, _ := http.NewRequest("POST", "/stats/container/", strings.NewReader("{}"))
+	rec := httptest.NewRecorder()
+	Stats(srv, rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stats request failed: %d %s", rec.Code, rec.Body.String())
+	}
+	version, err := strconv.ParseUint(rec.Header().Get(snapshotVersionHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid %s header: %v", snapshotVersionHeader, err)
+	}
+	var res map[string]struct {
+		Stats []interface{} `json:"stats"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return version, res
+}
+
+// TestStatsResponseFromSingleSnapshot checks that stats responses served
+//while snapshots are being replaced are built from exactly the snapshot
+//named by their version header
+func TestStatsResponseFromSingleSnapshot(t *testing.T) {
+	const rounds = 200
+	srv := newTestServer()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for version := uint64(2); version <= rounds; version++ {
+			srv.state.ReadModel.Publish(testReadModel(version, "/a", "/b"))
+		}
+	}()
+	for round := 0; round < rounds; round++ {
+		version, res := getStats(t, srv)
+		for _, name := range []string{"/a", "/b"} {
+			if got := len(res[name].Stats); got != int(version) {
+				t.Fatalf("response of snapshot %d has %d stats of %s", version, got, name)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+// TestStatsResponseNotAlteringSnapshot checks that building a response
+//leaves the snapshot intact, so it can be served again
+func TestStatsResponseNotAlteringSnapshot(t *testing.T) {
+	srv := newTestServer()
+	model := testReadModel(3, "/a")
+	srv.state.ReadModel.Publish(model)
+	req, _ := http.NewRequest("POST", "/stats/container/?spec=0&count=1", strings.NewReader("{}"))
+	Stats(srv, httptest.NewRecorder(), req)
+	dockerMap := model.DockerStorage["/a"].(map[string]interface{})
+	if got := len(dockerMap["stats"].([]interface{})); got != 3 {
+		t.Errorf("snapshot has %d stats after response, want 3", got)
+	}
+	if _, haveName := dockerMap["name"]; !haveName {
+		t.Errorf("snapshot lost fields of container after response")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/exchange"
+)
+
+// specMaxAge tells consumers how long spec may be cached, as it changes
+//rarely compared to stats
+const specMaxAge = 300
+
+// specFields lists the container object fields served by spec endpoint
+var specFields = []string{"id", "name", "aliases", "labels", "spec"}
+
+func extractSpec(dockerObj map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, field := range specFields {
+		if value, haveValue := dockerObj[field]; haveValue {
+			res[field] = value
+		}
+	}
+	return res
+}
+
+// buildSpecResponse returns json-encoded spec of all containers or, if
+//id is not empty, of single container with matching id or name
+func buildSpecResponse(model *exchange.ReadModel, id string) ([]byte, bool) {
+	if id == "" {
+		res := map[string]interface{}{}
+		for dockerName, dockerObj := range model.DockerStorage {
+			res[dockerName] = extractSpec(dockerObj.(map[string]interface{}))
+		}
+		out, _ := json.Marshal(res)
+		return out, true
+	}
+	for dockerName, dockerObj := range model.DockerStorage {
+		dockerMap := dockerObj.(map[string]interface{})
+		if dockerName == id || dockerName == "/"+id || dockerMap["id"] == id {
+			out, _ := json.Marshal(extractSpec(dockerMap))
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+func Spec(server *server, w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(mux.Vars(r)["id"], "/")
+	res, found := buildSpecResponse(server.snapshot(w), id)
+	if !found {
+		http.Error(w, fmt.Sprintf("Unknown container '%s'", id), http.StatusNotFound)
+		return
+	}
+	writeSpec(w, r, res)
+}
+
+// MachineSpec serves info of the node, in layout of cAdvisor's MachineInfo,
+//cacheable like container specs
+func MachineSpec(server *server, w http.ResponseWriter, r *http.Request) {
+	machine, haveMachine := buildMachineInfo(server.snapshot(w))
+	if !haveMachine {
+		http.Error(w, "Metric template not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	res, _ := json.Marshal(machine)
+	writeSpec(w, r, res)
+}
+
+// writeSpec writes json-encoded spec with headers letting consumers cache
+//it, responding with 304 Not Modified if consumer's copy is current
+func writeSpec(w http.ResponseWriter, r *http.Request, res []byte) {
+	etag := fmt.Sprintf("\"%x\"", sha1.Sum(res))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", specMaxAge))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
@@ -0,0 +1,143 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBuffer holds stats pending to be sent to a client; stats are
+	//dropped for clients not keeping up
+	streamBuffer = 256
+	// streamPingInterval defines how often idle clients are pinged, so
+	//dead connections are noticed
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamConn serializes frames written to WebSocket connection
+type streamConn struct {
+	lock sync.Mutex
+	bw   *bufio.Writer
+	conn net.Conn
+}
+
+func (c *streamConn) write(opcode byte, payload []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return writeWebsocketFrame(c.bw, opcode, payload)
+}
+
+// Stream pushes stats objects to WebSocket client as they are merged,
+//each as {"container", "id", "stats"} text message; container query
+//parameters (names or ids) restrict stream to given containers
+func Stream(server *server, w http.ResponseWriter, r *http.Request) {
+	watched := map[string]bool{}
+	for _, container := range r.URL.Query()["container"] {
+		watched[container] = true
+	}
+	if !server.originAllowed(r) {
+		http.Error(w, "Origin not allowed: "+r.Header.Get("Origin"), http.StatusForbidden)
+		return
+	}
+	conn, rw, upgraded := upgradeWebsocket(w, r)
+	if !upgraded {
+		return
+	}
+	defer conn.Close()
+	feed := server.state.Feed
+	updates := feed.Subscribe(streamBuffer)
+	defer feed.Unsubscribe(updates)
+	out := &streamConn{bw: rw.Writer, conn: conn}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := readWebsocketFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case websocketOpClose:
+				out.write(websocketOpClose, payload)
+				return
+			case websocketOpPing:
+				out.write(websocketOpPong, payload)
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-server.done:
+			out.write(websocketOpClose, nil)
+			return
+		case <-ping.C:
+			if err := out.write(websocketOpPing, nil); err != nil {
+				return
+			}
+		case update := <-updates:
+			if len(watched) > 0 && !watched[update.Container] && !watched[update.Id] {
+				continue
+			}
+			message, err := json.Marshal(update)
+			if err != nil {
+				server.logger.WithField("container", update.Container).Errorf("Failed to encode streamed stats: %v", err)
+				continue
+			}
+			server.state.Activity.Touch()
+			if err := out.write(websocketOpText, message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// originAllowed tells if WebSocket handshake comes from an allowed origin;
+//browsers send Origin with every handshake, so pages of other sites can't
+//open streams with credentials of the user, unless the origin is listed.
+//Clients other than browsers usually don't send Origin at all
+func (server *server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range server.streamOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	originUrl, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(originUrl.Host, r.Host)
+}
@@ -0,0 +1,239 @@
+// +build !minimal
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/intelsdi-x/kubesnap-plugin-publisher-heapster/util"
+)
+
+func init() {
+	util.RegisterFeature(featureDerivedStats)
+	featureRoutes = append(featureRoutes,
+		route{methods: []string{"GET"}, path: "/api/v2.0/summary{name:(?:/.*)?}", handler: Summary})
+}
+
+// percentiles summarizes samples of a resource usage within a time window,
+//in layout of cAdvisor's v2 Percentiles
+type percentiles struct {
+	Present    bool   `json:"present"`
+	Mean       uint64 `json:"mean"`
+	Max        uint64 `json:"max"`
+	Fifty      uint64 `json:"fifty"`
+	Ninety     uint64 `json:"ninety"`
+	NinetyFive uint64 `json:"ninetyfive"`
+}
+
+// usage holds percentiles of cpu (millicores) and memory (bytes) usage
+//within a time window; PercentComplete tells how much of the window
+//is covered by stats
+type usage struct {
+	PercentComplete int32       `json:"percent_complete"`
+	Cpu             percentiles `json:"cpu"`
+	Memory          percentiles `json:"memory"`
+}
+
+type instantUsage struct {
+	Cpu    uint64 `json:"cpu"`
+	Memory uint64 `json:"memory"`
+}
+
+// derivedStats is the summary of container's usage, in layout of
+//cAdvisor's v2 DerivedStats; uptime (in seconds) is measured from
+//creation time of container to its latest stats
+type derivedStats struct {
+	Timestamp    time.Time    `json:"timestamp"`
+	LatestUsage  instantUsage `json:"latest_usage"`
+	MinuteUsage  usage        `json:"minute_usage"`
+	HourUsage    usage        `json:"hour_usage"`
+	DayUsage     usage        `json:"day_usage"`
+	CreationTime *time.Time   `json:"creation_time,omitempty"`
+	Uptime       float64      `json:"uptime"`
+}
+
+// usageSample is cpu and memory usage of a container at a point in time
+type usageSample struct {
+	timestamp time.Time
+	cpu       float64
+	haveCpu   bool
+	memory    float64
+	haveMem   bool
+}
+
+// usageSamples extracts usage from stats kept in order of timestamps;
+//cpu usage is derived from consecutive samples of cumulative cpu time
+func usageSamples(statsList []interface{}) []usageSample {
+	samples := make([]usageSample, 0, len(statsList))
+	var prevStamp time.Time
+	var prevCpu float64
+	havePrevCpu := false
+	for _, statsObj := range statsList {
+		statsMap, _ := statsObj.(map[string]interface{})
+		stampStr, _ := statsMap["timestamp"].(string)
+		stamp, err := util.ParseTime(stampStr)
+		if err != nil {
+			continue
+		}
+		sample := usageSample{timestamp: stamp}
+		if memory, haveMem := statsField(statsMap, "memory", "working_set"); haveMem && memory > 0 {
+			sample.memory, sample.haveMem = memory, true
+		} else {
+			sample.memory, sample.haveMem = statsField(statsMap, "memory", "usage")
+		}
+		cpu, haveCpu := statsField(statsMap, "cpu", "usage", "total")
+		if haveCpu && havePrevCpu && cpu >= prevCpu && stamp.After(prevStamp) {
+			// cumulative nanoseconds into millicores
+			sample.cpu = (cpu - prevCpu) / stamp.Sub(prevStamp).Seconds() / 1e6
+			sample.haveCpu = true
+		}
+		prevStamp, prevCpu, havePrevCpu = stamp, cpu, haveCpu
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// statsField gets numeric field of stats at given path
+func statsField(statsMap map[string]interface{}, path ...string) (float64, bool) {
+	var node interface{} = statsMap
+	for _, name := range path {
+		nodeMap, isMap := node.(map[string]interface{})
+		if !isMap {
+			return 0, false
+		}
+		node = nodeMap[name]
+	}
+	return toFloat(node)
+}
+
+// computePercentiles summarizes values using nearest-rank percentiles
+func computePercentiles(values []float64) percentiles {
+	if len(values) == 0 {
+		return percentiles{}
+	}
+	sort.Float64s(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	rank := func(p float64) uint64 {
+		idx := int(math.Ceil(p/100*float64(len(values)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return uint64(values[idx])
+	}
+	return percentiles{
+		Present:    true,
+		Mean:       uint64(sum / float64(len(values))),
+		Max:        uint64(values[len(values)-1]),
+		Fifty:      rank(50),
+		Ninety:     rank(90),
+		NinetyFive: rank(95),
+	}
+}
+
+// windowUsage summarizes samples within window ending at the latest one
+func windowUsage(samples []usageSample, window time.Duration) usage {
+	latest := samples[len(samples)-1].timestamp
+	since := latest.Add(-window)
+	cpu, memory := []float64{}, []float64{}
+	oldest := latest
+	for _, sample := range samples {
+		if sample.timestamp.Before(since) {
+			continue
+		}
+		if sample.timestamp.Before(oldest) {
+			oldest = sample.timestamp
+		}
+		if sample.haveCpu {
+			cpu = append(cpu, sample.cpu)
+		}
+		if sample.haveMem {
+			memory = append(memory, sample.memory)
+		}
+	}
+	complete := int32(latest.Sub(oldest) * 100 / window)
+	if complete > 100 {
+		complete = 100
+	}
+	return usage{PercentComplete: complete, Cpu: computePercentiles(cpu), Memory: computePercentiles(memory)}
+}
+
+// buildDerivedStats summarizes usage of container over its stats; false
+//is returned if container has no stats
+func buildDerivedStats(dockerMap map[string]interface{}) (derivedStats, bool) {
+	statsList, _ := dockerMap["stats"].([]interface{})
+	samples := usageSamples(statsList)
+	if len(samples) == 0 {
+		return derivedStats{}, false
+	}
+	last := samples[len(samples)-1]
+	res := derivedStats{
+		Timestamp:   last.timestamp,
+		LatestUsage: instantUsage{Cpu: uint64(last.cpu), Memory: uint64(last.memory)},
+		MinuteUsage: windowUsage(samples, time.Minute),
+		HourUsage:   windowUsage(samples, time.Hour),
+		DayUsage:    windowUsage(samples, 24*time.Hour),
+	}
+	specMap, _ := dockerMap["spec"].(map[string]interface{})
+	createdStr, _ := specMap["creation_time"].(string)
+	if created, err := util.ParseTime(createdStr); err == nil {
+		res.CreationTime = &created
+		if last.timestamp.After(created) {
+			res.Uptime = last.timestamp.Sub(created).Seconds()
+		}
+	}
+	return res, true
+}
+
+// Summary serves percentiles of cpu and memory usage over the last
+//minute, hour and day of a container, or of all containers if name is
+//omitted, keyed by names
+func Summary(server *server, w http.ResponseWriter, r *http.Request) {
+	model := server.snapshot(w)
+	names := []string{}
+	if name := mux.Vars(r)["name"]; name != "" {
+		name = path.Clean(name)
+		if _, known := model.DockerStorage[name]; !known {
+			http.Error(w, "unknown container \""+name+"\"", http.StatusNotFound)
+			return
+		}
+		names = append(names, name)
+	} else {
+		for name := range model.DockerStorage {
+			names = append(names, name)
+		}
+	}
+	res := map[string]derivedStats{}
+	for _, name := range names {
+		if summary, haveStats := buildDerivedStats(model.DockerStorage[name].(map[string]interface{})); haveStats {
+			res[name] = summary
+		}
+	}
+	writeResponse(w, r, http.StatusOK, res)
+}
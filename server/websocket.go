@@ -0,0 +1,154 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// minimal server side of WebSocket protocol (RFC 6455), enough to push
+//messages to clients and handle control frames sent by them
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// websocketMaxPayload limits size of frames accepted from clients,
+	//which aren't expected to send anything but control frames
+	websocketMaxPayload = 65536
+
+	websocketOpText  = 0x1
+	websocketOpClose = 0x8
+	websocketOpPing  = 0x9
+	websocketOpPong  = 0xa
+)
+
+var errWebsocketPayload = errors.New("websocket frame too large")
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, elem := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(elem), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebsocket completes opening handshake, taking over connection
+//of the request; it replies with an error if request isn't a valid
+//WebSocket handshake
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, bool) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "WebSocket handshake expected", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, nil, false
+	}
+	hijacker, canHijack := w.(http.Hijacker)
+	if !canHijack {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, false
+	}
+	return conn, rw, true
+}
+
+// writeWebsocketFrame writes single unmasked, final frame
+func writeWebsocketFrame(bw *bufio.Writer, opcode byte, payload []byte) error {
+	bw.WriteByte(0x80 | opcode)
+	switch size := len(payload); {
+	case size < 126:
+		bw.WriteByte(byte(size))
+	case size <= 0xffff:
+		bw.WriteByte(126)
+		binary.Write(bw, binary.BigEndian, uint16(size))
+	default:
+		bw.WriteByte(127)
+		binary.Write(bw, binary.BigEndian, uint64(size))
+	}
+	bw.Write(payload)
+	return bw.Flush()
+}
+
+// readWebsocketFrame reads single frame sent by client, unmasking its
+//payload; fragmented messages are returned frame by frame
+func readWebsocketFrame(br *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	size := uint64(head[1] & 0x7f)
+	switch size {
+	case 126:
+		var size16 uint16
+		if err := binary.Read(br, binary.BigEndian, &size16); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(size16)
+	case 127:
+		if err := binary.Read(br, binary.BigEndian, &size); err != nil {
+			return 0, nil, err
+		}
+	}
+	if size > websocketMaxPayload {
+		return 0, nil, errWebsocketPayload
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(br, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for idx := range payload {
+			payload[idx] ^= mask[idx%4]
+		}
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,53 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"time"
+)
+
+// RetryWithBackoff calls attempt until it succeeds, sleeping between
+// consecutive calls for exponentially growing period, starting with initial
+// and capped at max. Retrying is given up once stop is closed; result tells
+// whether attempt succeeded.
+//
+// Function onFailure (if given) is notified about every failed attempt
+// along with delay before the next one.
+func RetryWithBackoff(initial, max time.Duration, stop <-chan struct{}, attempt func() error, onFailure func(error, time.Duration)) bool {
+	delay := initial
+	for {
+		err := attempt()
+		if err == nil {
+			return true
+		}
+		if onFailure != nil {
+			onFailure(err, delay)
+		}
+		select {
+		case <-stop:
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > max {
+			delay = max
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"sort"
+	"sync"
+)
+
+// Optional subsystems register themselves as features from files which
+// are excluded by build profiles, e.g. `go build -tags minimal` leaves out
+// sinks, Kubernetes enrichment and admin APIs. Code relying on a feature
+// checks whether it's compiled in with HasFeature.
+var (
+	featuresLock sync.RWMutex
+	features     = map[string]bool{}
+)
+
+// RegisterFeature marks feature as compiled in
+func RegisterFeature(name string) {
+	featuresLock.Lock()
+	defer featuresLock.Unlock()
+	features[name] = true
+}
+
+// HasFeature tells if feature is compiled in
+func HasFeature(name string) bool {
+	featuresLock.RLock()
+	defer featuresLock.RUnlock()
+	return features[name]
+}
+
+// Features lists names of features compiled in, sorted
+func Features() []string {
+	featuresLock.RLock()
+	defer featuresLock.RUnlock()
+	res := make([]string, 0, len(features))
+	for name := range features {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,138 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidateSchema checks generic JSON object against JSON Schema, returning
+// list of violations, each prefixed with path to offending element.
+//
+// Only the subset of JSON Schema produced for publisher's container objects
+// is supported: `type`, `properties`, `required`, `items` and
+// `additionalProperties`. Object is expected to be decoded with
+// `json.Decoder.UseNumber()`.
+func ValidateSchema(schema map[string]interface{}, obj interface{}) []string {
+	violations := []string{}
+	validateNode(schema, obj, "/", &violations)
+	return violations
+}
+
+func validateNode(schema map[string]interface{}, obj interface{}, path string, violations *[]string) {
+	if schemaType, haveType := schema["type"].(string); haveType && !matchesType(schemaType, obj) {
+		*violations = append(*violations, fmt.Sprintf("%s: expected %s, got %s", path, schemaType, typeName(obj)))
+		return
+	}
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for _, req := range stringList(schema["required"]) {
+			if _, present := v[req]; !present {
+				*violations = append(*violations, fmt.Sprintf("%s: missing required property '%s'", path, req))
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if propSchema, known := props[k].(map[string]interface{}); known {
+				validateNode(propSchema, v[k], filepath.Join(path, k), violations)
+			} else if additional != nil {
+				validateNode(additional, v[k], filepath.Join(path, k), violations)
+			}
+		}
+	case []interface{}:
+		if items, haveItems := schema["items"].(map[string]interface{}); haveItems {
+			for i, item := range v {
+				validateNode(items, item, filepath.Join(path, strconv.Itoa(i)), violations)
+			}
+		}
+	}
+}
+
+func matchesType(schemaType string, obj interface{}) bool {
+	switch schemaType {
+	case "object":
+		_, ok := obj.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := obj.([]interface{})
+		return ok
+	case "string":
+		_, ok := obj.(string)
+		return ok
+	case "boolean":
+		_, ok := obj.(bool)
+		return ok
+	case "number":
+		_, ok := obj.(json.Number)
+		return ok
+	case "integer":
+		num, ok := obj.(json.Number)
+		return ok && !strings.ContainsAny(string(num), ".eE")
+	}
+	return true
+}
+
+func typeName(obj interface{}) string {
+	switch v := obj.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return "number"
+		}
+		return "integer"
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+func stringList(val interface{}) []string {
+	switch v := val.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		res := []string{}
+		for _, item := range v {
+			if str, isStr := item.(string); isStr {
+				res = append(res, str)
+			}
+		}
+		return res
+	}
+	return nil
+}
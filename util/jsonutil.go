@@ -23,7 +23,9 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"time"
 	"fmt"
@@ -51,6 +53,10 @@ sys   interface{}
 
 var NotFound = errors.New("Path not found")
 
+// AppendIndex used as the last element of path given to `Set` appends
+//value to the list
+const AppendIndex = "-"
+
 func NewValueProvider() *ValueProvider {
 	provider := ValueProvider{
 		formatters: map[string]ValueFormatter {},
@@ -357,39 +363,248 @@ func NewObjWalker(root interface{}) *JsonWalker {
 }
 
 // Walk implements similar behavior to `filepath.Walk`.
+//
+// Path may hold glob patterns (see `SeekAll`); each match is walked then.
 func (w *JsonWalker) Walk(path string, walkFunc filepath.WalkFunc) error {
-	node, err := seek(w.fs, path)
+	if !isGlob(path) {
+		node, err := seek(w.fs, path)
+		if err != nil {
+			return err
+		}
+		walk(node, path, walkFunc)
+		return nil
+	}
+	matches, err := w.SeekAll(path)
 	if err != nil {
 		return err
 	}
-	walk(node, path, walkFunc)
+	if len(matches) == 0 {
+		return NotFound
+	}
+	for _, match := range matches {
+		walk(match.Value, "/"+strings.Join(match.Keys, "/"), walkFunc)
+	}
 	return nil
 }
 
 // Seek walks through walker's target object until specific path is reached,
 // returning handle to data at that location.
 //
-// Seek tries its best to find value at given path. Failure to reach the path
-// is indicated with error value of `NotFound`.
+// Elements of lists are addressed by their index, e.g. `/stats/0`.
+// Failure to reach the path is indicated with error value of `NotFound`.
 func (w *JsonWalker) Seek(seekPath string) (interface{}, error) {
 	return seek(w.fs, seekPath)
 }
 
-func seek(root interface{}, seekPath string) (interface{}, error) {
-	var result interface{}
-	resultSet := false
-	walk(root, "/", func(path string, info os.FileInfo, _ error) error {
-		if result != nil {
-			return filepath.SkipDir
-		} else if path == seekPath {
-			result = info.Sys()
-			resultSet = true
-			return filepath.SkipDir
+// GlobMatch is data found at a path matching glob pattern, along with
+// the map keys and list indices leading to it.
+type GlobMatch struct {
+	Keys  []string
+	Value interface{}
+}
+
+// SeekAll returns data at all paths matching given pattern, ordered by
+// their keys. Each element of the pattern may be a glob, as understood by
+// `path.Match`, matched against map keys and list indices, e.g.
+// `/stats/*/timestamp` or `/network/interfaces/eth*`; element `*` matches
+// any key, even one holding `/`, which is why keys are returned apart.
+// No match yields empty result; malformed pattern is reported as
+// `path.ErrBadPattern`.
+func (w *JsonWalker) SeekAll(pattern string) ([]GlobMatch, error) {
+	matches := []GlobMatch{}
+	if err := seekAll(w.fs, nil, pathElements(pattern), &matches); err != nil {
+		return nil, err
+	}
+	sort.Sort(globMatches(matches))
+	return matches, nil
+}
+
+// globMatches sorts matches by their keys, element by element
+type globMatches []GlobMatch
+
+func (m globMatches) Len() int      { return len(m) }
+func (m globMatches) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m globMatches) Less(i, j int) bool {
+	a, b := m[i].Keys, m[j].Keys
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// Set puts value at given path, replacing map entry or list element found
+// there; index `AppendIndex` appends value to the list. Parent of the path
+// must exist, otherwise `NotFound` is returned.
+func (w *JsonWalker) Set(setPath string, value interface{}) error {
+	return w.update(setPath, value, updateSet)
+}
+
+// SetCreating puts value at given path like `Set`, creating maps missing
+// along the path; lists are not created.
+func (w *JsonWalker) SetCreating(setPath string, value interface{}) error {
+	return w.update(setPath, value, updateSetCreating)
+}
+
+// Delete removes map entry or list element found at given path; following
+// elements of the list are shifted.
+func (w *JsonWalker) Delete(deletePath string) error {
+	return w.update(deletePath, nil, updateDelete)
+}
+
+func (w *JsonWalker) update(updatePath string, value interface{}, op updateOp) error {
+	root, err := update(w.fs, pathElements(updatePath), value, op)
+	if err == nil {
+		w.fs = root
+	}
+	return err
+}
+
+func pathElements(path string) []string {
+	elements := []string{}
+	for _, element := range strings.Split(path, "/") {
+		if element != "" && element != "." {
+			elements = append(elements, element)
 		}
+	}
+	return elements
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[\\")
+}
+
+func seekAll(node interface{}, keys []string, elements []string, matches *[]GlobMatch) error {
+	if len(elements) == 0 {
+		*matches = append(*matches, GlobMatch{Keys: append([]string(nil), keys...), Value: node})
 		return nil
-	})
-	if resultSet {
-		return result, nil
+	}
+	element, rest := elements[0], elements[1:]
+	if !isGlob(element) {
+		child, err := seek(node, element)
+		if err != nil {
+			return nil
+		}
+		return seekAll(child, append(keys, element), rest, matches)
+	}
+	visit := func(key string, child interface{}) error {
+		if element != "*" {
+			if matched, err := pathpkg.Match(element, key); err != nil || !matched {
+				return err
+			}
+		}
+		return seekAll(child, append(keys, key), rest, matches)
+	}
+	switch container := node.(type) {
+	case map[string]interface{}:
+		for key, child := range container {
+			if err := visit(key, child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for idx, child := range container {
+			if err := visit(strconv.Itoa(idx), child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func listIndex(list []interface{}, element string) (int, bool) {
+	idx, err := strconv.Atoi(element)
+	if err != nil || idx < 0 || idx >= len(list) {
+		return 0, false
+	}
+	return idx, true
+}
+
+func seek(root interface{}, seekPath string) (interface{}, error) {
+	node := root
+	for _, element := range pathElements(seekPath) {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			child, found := container[element]
+			if !found {
+				return nil, NotFound
+			}
+			node = child
+		case []interface{}:
+			idx, found := listIndex(container, element)
+			if !found {
+				return nil, NotFound
+			}
+			node = container[idx]
+		default:
+			return nil, NotFound
+		}
+	}
+	return node, nil
+}
+
+// updateOp tells what update does at the path
+type updateOp int
+
+const (
+	updateSet updateOp = iota
+	updateSetCreating
+	updateDelete
+)
+
+// update sets or removes value at the path below given node, returning
+//the node to store in place of given one, as lists may be reallocated
+func update(node interface{}, elements []string, value interface{}, op updateOp) (interface{}, error) {
+	remove := op == updateDelete
+	if len(elements) == 0 {
+		return value, nil
+	}
+	element, rest := elements[0], elements[1:]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			if remove {
+				delete(container, element)
+			} else {
+				container[element] = value
+			}
+			return container, nil
+		}
+		child, found := container[element]
+		if !found && op == updateSetCreating {
+			child, found = map[string]interface{}{}, true
+		}
+		if !found {
+			return nil, NotFound
+		}
+		child, err := update(child, rest, value, op)
+		if err != nil {
+			return nil, err
+		}
+		container[element] = child
+		return container, nil
+	case []interface{}:
+		if len(rest) == 0 && element == AppendIndex && !remove {
+			return append(container, value), nil
+		}
+		idx, found := listIndex(container, element)
+		if !found {
+			return nil, NotFound
+		}
+		if len(rest) == 0 {
+			if remove {
+				return append(container[:idx:idx], container[idx+1:]...), nil
+			}
+			container[idx] = value
+			return container, nil
+		}
+		child, err := update(container[idx], rest, value, op)
+		if err != nil {
+			return nil, err
+		}
+		container[idx] = child
+		return container, nil
 	}
 	return nil, NotFound
 }
@@ -434,3 +649,24 @@ func walk(node interface{}, path string, walkFunc filepath.WalkFunc) error {
 	}
 	return nil
 }
+
+// DeepCopy makes a copy of json-like tree of maps and lists; other values
+//are shared with the source
+func DeepCopy(data interface{}) interface{} {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			res[k] = DeepCopy(v)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(data))
+		for i, v := range data {
+			res[i] = DeepCopy(v)
+		}
+		return res
+	default:
+		return data
+	}
+}
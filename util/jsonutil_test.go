@@ -0,0 +1,62 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeekAllReturnsMatchedKeys(t *testing.T) {
+	obj := map[string]interface{}{
+		"filesystem": map[string]interface{}{
+			"/dev/sdb": map[string]interface{}{"usage": 2},
+			"/dev/sda": map[string]interface{}{"usage": 1},
+		},
+		"stats": []interface{}{
+			map[string]interface{}{"timestamp": "t0"},
+			map[string]interface{}{"timestamp": "t1"},
+		},
+	}
+	walker := NewObjWalker(obj)
+	matches, err := walker.SeekAll("/filesystem/*/usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GlobMatch{
+		{Keys: []string{"filesystem", "/dev/sda", "usage"}, Value: 1},
+		{Keys: []string{"filesystem", "/dev/sdb", "usage"}, Value: 2},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("got %v, want %v", matches, want)
+	}
+	matches, err = walker.SeekAll("/stats/[1-9]/timestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []GlobMatch{{Keys: []string{"stats", "1", "timestamp"}, Value: "t1"}}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("got %v, want %v", matches, want)
+	}
+	if _, err := walker.SeekAll("/stats/[/timestamp"); err == nil {
+		t.Errorf("malformed pattern accepted")
+	}
+}